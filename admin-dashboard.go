@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// How many seconds the message rate is averaged over.
+const messageRateWindow = 10
+
+// How many recent errors are kept for the dashboard.
+const recentErrorLimit = 20
+
+// How often the dashboard receives a new snapshot.
+const adminEventInterval = time.Second
+
+// ActivityMonitor keeps track of the message traffic and the recent errors of the signaling server.
+type ActivityMonitor struct {
+	mux            sync.Mutex
+	messagesByType map[string]uint64
+	// Per-second message counts, indexed by the unix second modulo the window size.
+	buckets      [messageRateWindow]uint64
+	bucketSecond [messageRateWindow]int64
+	recentErrors []AdminError
+}
+
+// A single error shown on the dashboard.
+type AdminError struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
+// A room and its members shown on the dashboard.
+type AdminRoom struct {
+	ID      string   `json:"room_id"`
+	Owner   string   `json:"owner"`
+	Members []string `json:"members"`
+}
+
+// The state of the server pushed to the dashboard.
+type AdminSnapshot struct {
+	Time           time.Time         `json:"time"`
+	UserCount      int               `json:"user_count"`
+	RoomCount      int               `json:"room_count"`
+	Rooms          []AdminRoom       `json:"rooms"`
+	MessageRate    float64           `json:"message_rate"`
+	MessagesByType map[string]uint64 `json:"messages_by_type"`
+	RecentErrors   []AdminError      `json:"recent_errors"`
+}
+
+// Creates a new ActivityMonitor.
+func NewActivityMonitor() *ActivityMonitor {
+	return &ActivityMonitor{
+		messagesByType: make(map[string]uint64),
+		recentErrors:   []AdminError{},
+	}
+}
+
+// Records an incoming socket message of the given type.
+func (am *ActivityMonitor) RecordMessage(messageType string) {
+	am.mux.Lock()
+	defer am.mux.Unlock()
+
+	am.messagesByType[messageType]++
+
+	now := time.Now().Unix()
+	i := now % messageRateWindow
+	if am.bucketSecond[i] != now {
+		am.bucketSecond[i] = now
+		am.buckets[i] = 0
+	}
+	am.buckets[i]++
+}
+
+// Records an error. Only the most recent errors are kept.
+func (am *ActivityMonitor) RecordError(source string, err error) {
+	am.mux.Lock()
+	defer am.mux.Unlock()
+
+	am.recentErrors = append(am.recentErrors, AdminError{Time: time.Now(), Source: source, Message: err.Error()})
+	if len(am.recentErrors) > recentErrorLimit {
+		am.recentErrors = am.recentErrors[len(am.recentErrors)-recentErrorLimit:]
+	}
+}
+
+// Returns the average number of messages per second over the rate window.
+func (am *ActivityMonitor) MessageRate() float64 {
+	am.mux.Lock()
+	defer am.mux.Unlock()
+
+	now := time.Now().Unix()
+	var total uint64
+	for i := range am.buckets {
+		if now-am.bucketSecond[i] < messageRateWindow {
+			total += am.buckets[i]
+		}
+	}
+	return float64(total) / messageRateWindow
+}
+
+// Builds a snapshot of the current server state for the dashboard.
+func (ss *SignalingServer) AdminSnapshot() (AdminSnapshot, error) {
+	rooms, err := ss.rooms.List()
+	if err != nil {
+		return AdminSnapshot{}, err
+	}
+
+	snapshot := AdminSnapshot{
+		Time:        time.Now(),
+		UserCount:   ss.UserCount(),
+		RoomCount:   len(rooms),
+		Rooms:       make([]AdminRoom, 0, len(rooms)),
+		MessageRate: ss.activity.MessageRate(),
+	}
+	for _, room := range rooms {
+		adminRoom := AdminRoom{ID: room.ID, Members: []string{}}
+		if room.Owner != nil {
+			adminRoom.Owner = room.Owner.Name
+		}
+		for _, user := range room.Users {
+			adminRoom.Members = append(adminRoom.Members, user.Name)
+		}
+		snapshot.Rooms = append(snapshot.Rooms, adminRoom)
+	}
+
+	ss.activity.mux.Lock()
+	snapshot.MessagesByType = make(map[string]uint64, len(ss.activity.messagesByType))
+	for messageType, count := range ss.activity.messagesByType {
+		snapshot.MessagesByType[messageType] = count
+	}
+	snapshot.RecentErrors = append([]AdminError{}, ss.activity.recentErrors...)
+	ss.activity.mux.Unlock()
+
+	return snapshot, nil
+}
+
+// A handler for the /admin/events endpoint that streams server snapshots as server-sent events.
+func (ss *SignalingServer) AdminEventsHandler(c echo.Context) error {
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(adminEventInterval)
+	defer ticker.Stop()
+
+	for {
+		snapshot, err := ss.AdminSnapshot()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(response, "event: snapshot\ndata: %s\n\n", data); err != nil {
+			return nil
+		}
+		response.Flush()
+
+		// The stream ends when the server drains, so it does not hold up the shutdown.
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			if ss.Draining() {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminDashboardAuth(t *testing.T) {
+	get := func(env map[string]string, user, password string) int {
+		e, _ := newTestApp(t, env)
+		request := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if user != "" {
+			request.SetBasicAuth(user, password)
+		}
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	if code := get(nil, "", ""); code != http.StatusNotFound {
+		t.Errorf("the dashboard without a password answered %d, want %d", code, http.StatusNotFound)
+	}
+	env := map[string]string{"ADMIN_PASSWORD": "secret"}
+	for _, tt := range []struct {
+		user, password string
+		want           int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"admin", "wrong", http.StatusUnauthorized},
+		{"root", "secret", http.StatusUnauthorized},
+		{"admin", "secret", http.StatusOK},
+	} {
+		if code := get(env, tt.user, tt.password); code != tt.want {
+			t.Errorf("the dashboard as %q:%q answered %d, want %d", tt.user, tt.password, code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// An ICE server handed to the browsers' RTCPeerConnection.
+type ICEServer struct {
+	URLs       []string `yaml:"urls" json:"urls"`
+	Username   string   `yaml:"username" json:"username,omitempty"`
+	Credential string   `yaml:"credential" json:"credential,omitempty"`
+}
+
+// The configuration the page needs at runtime.
+type ClientConfig struct {
+	WebSocketURL string `json:"websocket_url"`
+	// The WebSocket subprotocols of the server, in order of preference.
+	Protocols []string `json:"protocols"`
+	// The fallback when the WebSocket can't be opened: the server messages are streamed from
+	// the event stream URL and the client messages are posted to the signal URL.
+	EventStreamURL string          `json:"event_stream_url"`
+	SignalURL      string          `json:"signal_url"`
+	ICEServers     []ICEServer     `json:"ice_servers"`
+	Features       map[string]bool `json:"features"`
+	Limits         ClientLimits    `json:"limits"`
+	// The token the page sends when opening the WebSocket. Empty when no token is required.
+	UpgradeToken string `json:"upgrade_token,omitempty"`
+	// The WebTransport URL, tried before the WebSocket. Empty when WebTransport is disabled.
+	WebTransportURL string `json:"webtransport_url,omitempty"`
+	// The base64 encoded SHA-256 hashes of the self-signed WebTransport certificate, for
+	// serverCertificateHashes. Empty when the certificate is signed by a CA.
+	WebTransportCertHashes []string `json:"webtransport_cert_hashes,omitempty"`
+}
+
+// The limits the page needs to know about. Zero means unlimited.
+type ClientLimits struct {
+	MaxRoomSize    int   `json:"max_room_size"`
+	MaxMessageSize int64 `json:"max_message_size"`
+}
+
+// The data passed to the page templates.
+type PageData struct {
+	// The client configuration as JSON, safe to embed in a script tag.
+	ClientConfig string
+}
+
+// Builds the client configuration for a request. The WebSocket URL is derived from the
+// public URL when it is configured, otherwise from the scheme and host of the request.
+func (config *Config) ClientConfig(c echo.Context) ClientConfig {
+	scheme, host := c.Scheme(), c.Request().Host
+	if config.PublicURL != "" {
+		// The public URL has been validated at startup.
+		publicURL, _ := url.Parse(config.PublicURL)
+		scheme, host = publicURL.Scheme, publicURL.Host
+	}
+	wsScheme := "ws"
+	if scheme == "https" {
+		wsScheme = "wss"
+	}
+
+	features := make(map[string]bool, len(config.Features))
+	for feature, enabled := range config.Features {
+		features[feature] = enabled
+	}
+
+	webTransportURL := ""
+	if config.WebTransport.ListenAddress != "" {
+		// The listen address has been validated at startup.
+		_, port, _ := net.SplitHostPort(config.WebTransport.ListenAddress)
+		hostname := (&url.URL{Host: host}).Hostname()
+		webTransportURL = (&url.URL{Scheme: "https", Host: net.JoinHostPort(hostname, port), Path: "/webtransport"}).String()
+	}
+
+	return ClientConfig{
+		WebSocketURL:    (&url.URL{Scheme: wsScheme, Host: host, Path: "/websocket"}).String(),
+		Protocols:       supportedProtocols,
+		EventStreamURL:  (&url.URL{Scheme: scheme, Host: host, Path: "/signal/events"}).String(),
+		SignalURL:       (&url.URL{Scheme: scheme, Host: host, Path: "/signal"}).String(),
+		WebTransportURL: webTransportURL,
+		ICEServers:      config.ICEServers,
+		Features:        features,
+		Limits: ClientLimits{
+			MaxRoomSize:    config.Limits.MaxRoomSize,
+			MaxMessageSize: config.Limits.MaxMessageSize,
+		},
+	}
+}
+
+// Builds the client configuration for a request with a new upgrade token, unless tokens is nil,
+// and the hashes of the WebTransport certificate, unless webTransport is nil.
+func (config *Config) clientConfigWithToken(c echo.Context, tokens *UpgradeTokens, webTransport *WebTransportServer) (ClientConfig, error) {
+	clientConfig := config.ClientConfig(c)
+	if webTransport != nil {
+		hashes, err := webTransport.CertHashes()
+		if err != nil {
+			return clientConfig, err
+		}
+		clientConfig.WebTransportCertHashes = hashes
+	}
+	if tokens != nil {
+		token, err := tokens.Issue(c)
+		if err != nil {
+			return clientConfig, err
+		}
+		clientConfig.UpgradeToken = token
+	}
+	return clientConfig, nil
+}
+
+// A handler for the /api/client-config endpoint.
+func clientConfigHandler(config *Config, tokens *UpgradeTokens, webTransport *WebTransportServer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		clientConfig, err := config.clientConfigWithToken(c, tokens, webTransport)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, clientConfig)
+	}
+}
+
+// Renders a template with the client configuration embedded in the page.
+func clientConfigRender(template string, config *Config, tokens *UpgradeTokens, webTransport *WebTransportServer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data, err := config.clientConfigWithToken(c, tokens, webTransport)
+		if err != nil {
+			return err
+		}
+		// json.Marshal escapes <, > and &, so the result can't close the script tag.
+		clientConfig, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, template, PageData{ClientConfig: string(clientConfig)})
+	}
+}
+
+// Returns whether the URL is a valid ICE server URL.
+func validICEServerURL(iceURL string) bool {
+	for _, scheme := range []string{"stun:", "stuns:", "turn:", "turns:"} {
+		if strings.HasPrefix(iceURL, scheme) && len(iceURL) > len(scheme) {
+			return true
+		}
+	}
+	return false
+}
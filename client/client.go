@@ -0,0 +1,522 @@
+// Package client is a Go client of the piirtul.io signaling server, for bots and integration tests.
+// It speaks the same messages as the server, from the protocol package.
+//
+//	c, err := client.Dial(ctx, "wss://piirtul.io/websocket", client.Options{
+//		Name:      "bot",
+//		Reconnect: true,
+//		Handlers: client.Handlers{
+//			OnOffer: func(from string, offer protocol.Offer) { ... },
+//		},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	participants, err := c.JoinRoom(ctx, "ABCD")
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"signaling/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// Defaults of the Options.
+const (
+	defaultReconnectDelay    = 500 * time.Millisecond
+	defaultMaxReconnectDelay = 30 * time.Second
+	// How long a reconnect may take to dial, initiate and rejoin.
+	reconnectTimeout = 30 * time.Second
+)
+
+var (
+	// Returned by the requests of a closed client.
+	ErrClosed = errors.New("client closed")
+	// Returned by the requests waiting for a response when the connection is lost.
+	ErrDisconnected = errors.New("disconnected from the server")
+)
+
+// The callbacks of the messages the server sends on its own. They run on the goroutine reading
+// the connection, so they must not block or wait for a request of the same client.
+type Handlers struct {
+	OnOffer     func(from string, offer protocol.Offer)
+	OnAnswer    func(from string, answer protocol.Answer)
+	OnCandidate func(from string, candidate protocol.Candidate)
+	// A peer left the room. When the peer was the owner, the room is gone.
+	OnPeerLeft func(name string, roomDestroyed bool)
+	// The server is shutting down and asks the clients to reconnect after the delay.
+	OnDraining func(reconnectAfter time.Duration)
+	// A failed relay or another error not answering a request.
+	OnError func(err *Error)
+	// The client reconnected. The error is set when the room could not be rejoined.
+	OnReconnect func(err error)
+	// The connection was lost and the client is not reconnecting.
+	OnDisconnect func(err error)
+}
+
+// The options of a Client.
+type Options struct {
+	// The user name sent in the initiation.
+	Name string
+	// The subprotocol, protocol.V2 by default. protocol.V1 is also supported.
+	Protocol string
+	// The upgrade token. When empty, a token is fetched from /api/client-config on every connect.
+	Token string
+	// Reconnect when the connection is lost, initiate again and rejoin the room.
+	Reconnect bool
+	// The delay before the first reconnect attempt, doubled after every failed attempt
+	// up to MaxReconnectDelay. A draining server decides the first delay itself.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	// Extra headers of the upgrade request.
+	Header     http.Header
+	Dialer     *websocket.Dialer
+	HTTPClient *http.Client
+	Handlers   Handlers
+	Logger     *slog.Logger
+}
+
+// A failed request, with the error code of the server.
+type Error struct {
+	// One of the protocol.Code constants.
+	Code    string
+	Message string
+	// The invalid fields of an invalid_payload error.
+	Fields []protocol.FieldError
+	// When the request may be retried after a rate_limited error.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	message := e.Code + ": " + e.Message
+	for _, field := range e.Fields {
+		message += "; " + field.Field + " " + field.Message
+	}
+	return message
+}
+
+// A client connected to the signaling server. The methods are safe for concurrent use.
+type Client struct {
+	url     string
+	options Options
+
+	mux  sync.Mutex
+	conn *websocket.Conn
+	// Whether the user of conn is initiated. Only initiated connections reconnect when lost,
+	// failures before are up to the caller of connect.
+	ready   bool
+	pending map[string]chan result
+	nextID  uint64
+	roomID  string
+	role    string
+	// The delay a draining server asked for.
+	drainDelay time.Duration
+	closed     bool
+	done       chan struct{}
+
+	// Serializes writes to the connection.
+	writeMux sync.Mutex
+}
+
+// The outcome of a request.
+type result struct {
+	message serverMessage
+	err     error
+}
+
+// Connects to the WebSocket URL of the server and sends the initiation with the name.
+func Dial(ctx context.Context, serverURL string, options Options) (*Client, error) {
+	if options.Name == "" {
+		return nil, errors.New("a name is required")
+	}
+	if options.Protocol == "" {
+		options.Protocol = protocol.V2
+	}
+	if options.Protocol != protocol.V1 && options.Protocol != protocol.V2 {
+		return nil, fmt.Errorf("unsupported protocol %q", options.Protocol)
+	}
+	if options.ReconnectDelay <= 0 {
+		options.ReconnectDelay = defaultReconnectDelay
+	}
+	if options.MaxReconnectDelay <= 0 {
+		options.MaxReconnectDelay = defaultMaxReconnectDelay
+	}
+	if options.Dialer == nil {
+		options.Dialer = websocket.DefaultDialer
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.Logger == nil {
+		options.Logger = slog.New(slog.DiscardHandler)
+	}
+
+	c := &Client{url: serverURL, options: options, pending: make(map[string]chan result), done: make(chan struct{})}
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Returns the user name of the client.
+func (c *Client) Name() string {
+	return c.options.Name
+}
+
+// Returns the ID of the room the client is in, or an empty string.
+func (c *Client) RoomID() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.roomID
+}
+
+// Creates a room with the ID and joins it as the owner.
+func (c *Client) CreateRoom(ctx context.Context, roomID string) error {
+	_, err := c.request(ctx, protocol.SocketMessage{Type: protocol.TypeRoomInitiation, Name: c.options.Name, RoomID: roomID, Role: protocol.RoleCreator})
+	if err != nil {
+		return err
+	}
+	c.setRoom(roomID, protocol.RoleCreator)
+	return nil
+}
+
+// Joins the room with the ID and returns the names of the other users in it.
+func (c *Client) JoinRoom(ctx context.Context, roomID string) ([]string, error) {
+	response, err := c.request(ctx, protocol.SocketMessage{Type: protocol.TypeRoomInitiation, Name: c.options.Name, RoomID: roomID, Role: protocol.RoleParticipant})
+	if err != nil {
+		return nil, err
+	}
+	c.setRoom(roomID, protocol.RoleParticipant)
+	return response.Participants, nil
+}
+
+// Sends an offer to a user of the room. Failures are reported to Handlers.OnError.
+func (c *Client) SendOffer(to string, offer protocol.Offer) error {
+	return c.send(protocol.SocketMessage{Type: protocol.TypeOffer, Name: to, Offer: &offer})
+}
+
+// Sends an answer to a user of the room. Failures are reported to Handlers.OnError.
+func (c *Client) SendAnswer(to string, answer protocol.Answer) error {
+	return c.send(protocol.SocketMessage{Type: protocol.TypeAnswer, Name: to, Answer: &answer})
+}
+
+// Sends an ICE candidate to a user of the room. Failures are reported to Handlers.OnError.
+func (c *Client) SendCandidate(to string, candidate protocol.Candidate) error {
+	return c.send(protocol.SocketMessage{Type: protocol.TypeCandidate, Name: to, Candidate: &candidate})
+}
+
+// Leaves the room. The server forgets the user as well, so Leave is usually followed by Close.
+func (c *Client) Leave(ctx context.Context) error {
+	if _, err := c.request(ctx, protocol.SocketMessage{Type: protocol.TypeLeaveRoom}); err != nil {
+		return err
+	}
+	c.setRoom("", "")
+	return nil
+}
+
+// Closes the connection and stops reconnecting. The server removes the user from its room.
+func (c *Client) Close() error {
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.mux.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	c.writeMux.Lock()
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMux.Unlock()
+	return conn.Close()
+}
+
+func (c *Client) setRoom(roomID, role string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.roomID, c.role = roomID, role
+}
+
+// Dials the server, starts reading the connection and sends the initiation.
+func (c *Client) connect(ctx context.Context) error {
+	upgradeURL, err := url.Parse(c.url)
+	if err != nil {
+		return err
+	}
+	token := c.options.Token
+	if token == "" {
+		// Servers that don't require a token don't mint one either.
+		token, err = c.fetchToken(ctx, upgradeURL)
+		if err != nil {
+			c.options.Logger.Debug("Could not fetch an upgrade token", "error", err)
+		}
+	}
+	if token != "" {
+		query := upgradeURL.Query()
+		query.Set("token", token)
+		upgradeURL.RawQuery = query.Encode()
+	}
+
+	dialer := *c.options.Dialer
+	dialer.Subprotocols = []string{c.options.Protocol}
+	conn, response, err := dialer.DialContext(ctx, upgradeURL.String(), c.options.Header)
+	if err != nil {
+		if response != nil {
+			return fmt.Errorf("connecting to the server: %w (%s)", err, response.Status)
+		}
+		return fmt.Errorf("connecting to the server: %w", err)
+	}
+
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	c.conn = conn
+	c.mux.Unlock()
+	go c.readLoop(conn)
+
+	if _, err := c.request(ctx, protocol.SocketMessage{Type: protocol.TypeInitiation, Name: c.options.Name}); err != nil {
+		conn.Close()
+		return err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.conn != conn {
+		return ErrDisconnected
+	}
+	c.ready = true
+	return nil
+}
+
+// Fetches an upgrade token from the client configuration of the server.
+func (c *Client) fetchToken(ctx context.Context, upgradeURL *url.URL) (string, error) {
+	config, err := FetchConfig(ctx, c.options.HTTPClient, upgradeURL.String())
+	if err != nil {
+		return "", err
+	}
+	return config.UpgradeToken, nil
+}
+
+// Sends a message and waits for the response with its request ID. Failed requests return an *Error.
+func (c *Client) request(ctx context.Context, message protocol.SocketMessage) (serverMessage, error) {
+	responses := make(chan result, 1)
+	c.mux.Lock()
+	c.nextID++
+	message.RequestID = strconv.FormatUint(c.nextID, 10)
+	c.pending[message.RequestID] = responses
+	c.mux.Unlock()
+	defer func() {
+		c.mux.Lock()
+		delete(c.pending, message.RequestID)
+		c.mux.Unlock()
+	}()
+
+	if err := c.send(message); err != nil {
+		return serverMessage{}, err
+	}
+	select {
+	case res := <-responses:
+		if res.err != nil {
+			return serverMessage{}, res.err
+		}
+		if !res.message.Success {
+			return res.message, res.message.error()
+		}
+		return res.message, nil
+	case <-ctx.Done():
+		return serverMessage{}, ctx.Err()
+	case <-c.done:
+		return serverMessage{}, ErrClosed
+	}
+}
+
+// Encodes the message in the protocol of the client and writes it to the connection.
+func (c *Client) send(message protocol.SocketMessage) error {
+	c.mux.Lock()
+	conn, closed := c.conn, c.closed
+	c.mux.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if conn == nil {
+		return ErrDisconnected
+	}
+
+	frame, err := encode(c.options.Protocol, message)
+	if err != nil {
+		return err
+	}
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+// Reads the connection until it fails, then reconnects or reports the disconnect.
+func (c *Client) readLoop(conn *websocket.Conn) {
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			c.disconnected(conn, err)
+			return
+		}
+		message, err := decode(c.options.Protocol, frame)
+		if err != nil {
+			c.options.Logger.Warn("Received a message with incorrect format", "error", err)
+			continue
+		}
+		c.dispatch(message)
+	}
+}
+
+// Passes a message to the request waiting for it or to the handlers.
+func (c *Client) dispatch(message serverMessage) {
+	if message.RequestID != "" {
+		c.mux.Lock()
+		responses, ok := c.pending[message.RequestID]
+		delete(c.pending, message.RequestID)
+		c.mux.Unlock()
+		if ok {
+			responses <- result{message: message}
+			return
+		}
+	}
+
+	handlers := c.options.Handlers
+	switch message.Type {
+	case protocol.TypeOffer:
+		if handlers.OnOffer != nil && message.Offer != nil {
+			handlers.OnOffer(message.Name, *message.Offer)
+		}
+	case protocol.TypeAnswer:
+		if handlers.OnAnswer != nil && message.Answer != nil {
+			handlers.OnAnswer(message.Name, *message.Answer)
+		}
+	case protocol.TypeCandidate:
+		if handlers.OnCandidate != nil && message.Candidate != nil {
+			handlers.OnCandidate(message.Name, *message.Candidate)
+		}
+	case protocol.TypePeerLeavingRoom:
+		if message.RoomDestroy {
+			c.setRoom("", "")
+		}
+		if handlers.OnPeerLeft != nil {
+			handlers.OnPeerLeft(message.Name, message.RoomDestroy)
+		}
+	case protocol.TypeServerDraining:
+		delay := time.Duration(message.ReconnectAfterMs) * time.Millisecond
+		c.mux.Lock()
+		c.drainDelay = delay
+		c.mux.Unlock()
+		if handlers.OnDraining != nil {
+			handlers.OnDraining(delay)
+		}
+	case protocol.TypeError:
+		if handlers.OnError != nil {
+			handlers.OnError(message.error())
+		}
+	default:
+		c.options.Logger.Debug("Ignored a message", "type", message.Type)
+	}
+}
+
+// Fails the waiting requests and starts reconnecting, unless the client was closed.
+func (c *Client) disconnected(conn *websocket.Conn, cause error) {
+	c.mux.Lock()
+	current := c.conn == conn
+	ready := c.ready && current
+	if current {
+		c.conn, c.ready = nil, false
+		for id, responses := range c.pending {
+			responses <- result{err: ErrDisconnected}
+			delete(c.pending, id)
+		}
+	}
+	closed := c.closed
+	c.mux.Unlock()
+	if closed || !ready {
+		return
+	}
+
+	c.options.Logger.Info("Disconnected from the server", "error", cause)
+	if c.options.Reconnect {
+		go c.reconnect()
+	} else if c.options.Handlers.OnDisconnect != nil {
+		c.options.Handlers.OnDisconnect(cause)
+	}
+}
+
+// Reconnects with a growing delay until the client is initiated again, then rejoins the room.
+func (c *Client) reconnect() {
+	c.mux.Lock()
+	delay := c.options.ReconnectDelay
+	if c.drainDelay > 0 {
+		delay, c.drainDelay = c.drainDelay, 0
+	}
+	c.mux.Unlock()
+
+	for {
+		select {
+		case <-time.After(delay):
+		case <-c.done:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+		err := c.connect(ctx)
+		if err == nil {
+			err = c.rejoin(ctx)
+			cancel()
+			c.options.Logger.Info("Reconnected to the server", "error", err)
+			if c.options.Handlers.OnReconnect != nil {
+				c.options.Handlers.OnReconnect(err)
+			}
+			return
+		}
+		cancel()
+		if errors.Is(err, ErrClosed) {
+			return
+		}
+		// The server may not have noticed the old connection yet, so name_taken is retried as well.
+		c.options.Logger.Warn("Failed to reconnect", "error", err, "retry_in", delay)
+		delay = min(delay*2, c.options.MaxReconnectDelay)
+	}
+}
+
+// Joins the room the client was in before reconnecting. The owner's room was destroyed when the
+// owner disconnected, so the owner creates it again.
+func (c *Client) rejoin(ctx context.Context) error {
+	c.mux.Lock()
+	roomID, role := c.roomID, c.role
+	c.mux.Unlock()
+
+	switch role {
+	case protocol.RoleCreator:
+		err := c.CreateRoom(ctx, roomID)
+		var requestErr *Error
+		if errors.As(err, &requestErr) && requestErr.Code == protocol.CodeRoomExists {
+			_, err = c.JoinRoom(ctx, roomID)
+		}
+		return err
+	case protocol.RoleParticipant:
+		_, err := c.JoinRoom(ctx, roomID)
+		return err
+	}
+	return nil
+}
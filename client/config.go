@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// An ICE server of the client configuration.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// The parts of the server's /api/client-config a Go client needs.
+type Config struct {
+	WebSocketURL string      `json:"websocket_url"`
+	Protocols    []string    `json:"protocols"`
+	ICEServers   []ICEServer `json:"ice_servers"`
+	// Empty when the server requires no token.
+	UpgradeToken string `json:"upgrade_token,omitempty"`
+}
+
+// Fetches the client configuration of the server. The server URL may be the WebSocket URL
+// or the address of the site. A nil httpClient uses http.DefaultClient.
+func FetchConfig(ctx context.Context, httpClient *http.Client, serverURL string) (Config, error) {
+	var config Config
+	configURL, err := url.Parse(serverURL)
+	if err != nil {
+		return config, err
+	}
+	switch configURL.Scheme {
+	case "ws":
+		configURL.Scheme = "http"
+	case "wss":
+		configURL.Scheme = "https"
+	}
+	configURL.Path, configURL.RawQuery = "/api/client-config", ""
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, configURL.String(), nil)
+	if err != nil {
+		return config, err
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return config, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return config, fmt.Errorf("client configuration: %s", response.Status)
+	}
+	err = json.NewDecoder(response.Body).Decode(&config)
+	return config, err
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"signaling/protocol"
+)
+
+// A message from the server, with the fields of every message type the server sends.
+type serverMessage struct {
+	Type             string                `json:"type"`
+	Success          bool                  `json:"success"`
+	Error            string                `json:"error,omitempty"`
+	Message          string                `json:"message,omitempty"`
+	Fields           []protocol.FieldError `json:"fields,omitempty"`
+	RetryAfterMs     int64                 `json:"retry_after_ms,omitempty"`
+	RequestID        string                `json:"request_id,omitempty"`
+	RoomID           string                `json:"room_id,omitempty"`
+	Participants     []string              `json:"participants,omitempty"`
+	Name             string                `json:"name,omitempty"`
+	Offer            *protocol.Offer       `json:"offer,omitempty"`
+	Answer           *protocol.Answer      `json:"answer,omitempty"`
+	Candidate        *protocol.Candidate   `json:"candidate,omitempty"`
+	RoomDestroy      bool                  `json:"room_destroy,omitempty"`
+	ReconnectAfterMs int64                 `json:"reconnect_after_ms,omitempty"`
+	Trace            map[string]string     `json:"trace,omitempty"`
+}
+
+// Returns the error of a failed response.
+func (m serverMessage) error() *Error {
+	return &Error{
+		Code:       m.Error,
+		Message:    m.Message,
+		Fields:     m.Fields,
+		RetryAfter: time.Duration(m.RetryAfterMs) * time.Millisecond,
+	}
+}
+
+// An envelope from the server, with the payload left encoded.
+type inboundEnvelope struct {
+	Version int                     `json:"v"`
+	Type    string                  `json:"type"`
+	ID      string                  `json:"id,omitempty"`
+	OK      *bool                   `json:"ok,omitempty"`
+	Error   *protocol.EnvelopeError `json:"error,omitempty"`
+	Data    json.RawMessage         `json:"data,omitempty"`
+	Trace   map[string]string       `json:"trace,omitempty"`
+}
+
+// Encodes a message in the format of the subprotocol.
+func encode(subprotocol string, message protocol.SocketMessage) ([]byte, error) {
+	if subprotocol == protocol.V1 {
+		return json.Marshal(message)
+	}
+	envelope := protocol.Envelope{Version: 2, Type: message.Type, ID: message.RequestID, Trace: message.Trace}
+	payload := protocol.Payload{
+		Name: message.Name, RoomID: message.RoomID, Role: message.Role,
+		Offer: message.Offer, Answer: message.Answer, Candidate: message.Candidate,
+	}
+	if payload != (protocol.Payload{}) {
+		envelope.Data = payload
+	}
+	return json.Marshal(envelope)
+}
+
+// Decodes a frame in the format of the subprotocol into the flat message.
+func decode(subprotocol string, frame []byte) (serverMessage, error) {
+	var message serverMessage
+	if subprotocol == protocol.V1 {
+		err := json.Unmarshal(frame, &message)
+		return message, err
+	}
+
+	var envelope inboundEnvelope
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		return message, err
+	}
+	if len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, &message); err != nil {
+			return message, err
+		}
+	}
+	message.Type, message.RequestID, message.Trace = envelope.Type, envelope.ID, envelope.Trace
+	message.Success = envelope.OK != nil && *envelope.OK
+	if envelope.Error != nil {
+		message.Error, message.Message = envelope.Error.Code, envelope.Error.Message
+		message.Fields, message.RetryAfterMs = envelope.Error.Fields, envelope.Error.RetryAfterMs
+	}
+	return message, nil
+}
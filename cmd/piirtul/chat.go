@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"signaling/client"
+	"signaling/peer"
+	"signaling/protocol"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// How long the requests to the server may take.
+const requestTimeout = 10 * time.Second
+
+// The answer of /initiate.
+type initiation struct {
+	NameSuccess bool `json:"name_success"`
+	RoomSuccess bool `json:"room_success"`
+	// Set when the request was rate limited or invalid.
+	Error        string                `json:"error"`
+	RetryAfterMs int64                 `json:"retry_after_ms"`
+	Fields       []protocol.FieldError `json:"fields"`
+}
+
+// The members of the room as shown to the user.
+type chatRoom struct {
+	console *console
+	name    string
+	// Closed when the owner leaves and the room is gone.
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mux     sync.Mutex
+	members []string
+}
+
+// Runs "piirtul chat".
+func chatCommand(args []string) error {
+	flags := flag.NewFlagSet("chat", flag.ExitOnError)
+	name := flags.String("name", os.Getenv("USER"), "the user name")
+	subprotocol := flags.String("protocol", protocol.V2, "the signaling protocol, "+protocol.V1+" or "+protocol.V2)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: piirtul chat [options] <server> <room>")
+		fmt.Fprintln(flags.Output(), "\nJoins the room, or creates it if it does not exist, and chats with its users.\n\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *name == "" {
+		return errors.New("a name is required, use -name")
+	}
+	site, err := siteURL(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	roomID := strings.ToUpper(flags.Arg(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	config, err := client.FetchConfig(ctx, nil, site.String())
+	if err != nil {
+		return err
+	}
+	check, err := initiate(ctx, site, *name, roomID)
+	if err != nil {
+		return err
+	}
+	if !check.NameSuccess {
+		return fmt.Errorf("the name %s is taken", *name)
+	}
+
+	console, err := newConsole(roomID + "> ")
+	if err != nil {
+		return err
+	}
+	defer console.Close()
+	room := &chatRoom{console: console, name: *name, closed: make(chan struct{}), members: []string{*name}}
+
+	iceServers := []webrtc.ICEServer{}
+	for _, server := range config.ICEServers {
+		iceServers = append(iceServers, webrtc.ICEServer{URLs: server.URLs, Username: server.Username, Credential: server.Credential})
+	}
+	p, err := peer.Dial(ctx, config.WebSocketURL, peer.Options{
+		Client: client.Options{
+			Name:      *name,
+			Protocol:  *subprotocol,
+			Reconnect: true,
+			Handlers: client.Handlers{
+				OnError:      room.onError,
+				OnDraining:   room.onDraining,
+				OnReconnect:  room.onReconnect,
+				OnDisconnect: room.onDisconnect,
+			},
+		},
+		ICEServers: iceServers,
+		Handlers: peer.Handlers{
+			OnChat:     room.onChat,
+			OnOpen:     room.onJoined,
+			OnPeerLeft: room.onLeft,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	if check.RoomSuccess {
+		participants, err := p.JoinRoom(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		console.Printf("Joined room %s", roomID)
+		room.add(participants...)
+	} else {
+		if err := p.CreateRoom(ctx, roomID); err != nil {
+			return err
+		}
+		console.Printf("Created room %s, others can join it with: piirtul chat %s %s", roomID, flags.Arg(0), roomID)
+	}
+	room.printMembers()
+	console.Printf("Type a message and press enter. /members lists the members, /quit or Ctrl-D leaves.")
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := console.ReadLine()
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+	for {
+		select {
+		case <-room.closed:
+			return nil
+		case line, ok := <-lines:
+			if !ok || line == "/quit" {
+				ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+				defer cancel()
+				return p.Leave(ctx)
+			}
+			room.command(p, line)
+		}
+	}
+}
+
+// Handles a line typed by the user.
+func (r *chatRoom) command(p *peer.Peer, line string) {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+	case line == "/members":
+		r.printMembers()
+	case strings.HasPrefix(line, "/"):
+		r.console.Printf("Unknown command %s, try /members or /quit", line)
+	case len(p.Peers()) == 0:
+		r.console.Printf("Nobody is connected yet, the message was not sent")
+	default:
+		if err := p.SendChat(line); err != nil {
+			r.console.Printf("Failed to send the message: %v", err)
+		}
+		r.printChat(r.name, line)
+	}
+}
+
+func (r *chatRoom) onChat(from string, chat peer.Chat) {
+	// The sender in the message is chosen by the peer, the user of the channel is not.
+	r.printChat(from, chat.Message)
+}
+
+func (r *chatRoom) onJoined(name string) {
+	if r.add(name) {
+		r.console.Printf("* %s joined", name)
+		r.printMembers()
+	}
+}
+
+func (r *chatRoom) onLeft(name string, roomDestroyed bool) {
+	r.mux.Lock()
+	r.members = slices.DeleteFunc(r.members, func(member string) bool { return member == name })
+	r.mux.Unlock()
+	if roomDestroyed {
+		r.console.Printf("* %s, the owner, left and closed the room", name)
+		r.closeOnce.Do(func() { close(r.closed) })
+		return
+	}
+	r.console.Printf("* %s left", name)
+	r.printMembers()
+}
+
+func (r *chatRoom) onError(err *client.Error) {
+	if err.Code == protocol.CodeRateLimited {
+		r.console.Printf("! Too many messages, wait %s", err.RetryAfter.Round(time.Second))
+		return
+	}
+	r.console.Printf("! %v", err)
+}
+
+func (r *chatRoom) onDraining(reconnectAfter time.Duration) {
+	r.console.Printf("! The server is restarting, reconnecting in %s. The chat keeps working meanwhile.", reconnectAfter.Round(time.Second))
+}
+
+func (r *chatRoom) onReconnect(err error) {
+	if err != nil {
+		r.console.Printf("! Reconnected to the server but could not rejoin the room: %v", err)
+		return
+	}
+	r.console.Printf("! Reconnected to the server")
+}
+
+func (r *chatRoom) onDisconnect(err error) {
+	r.console.Printf("! Disconnected from the server: %v", err)
+}
+
+// Adds the users to the members. Returns false if they were all members already.
+func (r *chatRoom) add(names ...string) bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	added := false
+	for _, name := range names {
+		if !slices.Contains(r.members, name) {
+			r.members = append(r.members, name)
+			added = true
+		}
+	}
+	return added
+}
+
+func (r *chatRoom) printMembers() {
+	r.mux.Lock()
+	members := slices.Clone(r.members)
+	r.mux.Unlock()
+	slices.Sort(members)
+	r.console.Printf("Members: %s", strings.Join(members, ", "))
+}
+
+// Prints a chat message. The control characters are removed, so the peers can't send escape
+// sequences to the terminal.
+func (r *chatRoom) printChat(sender, message string) {
+	r.console.Printf("[%s] %s: %s", time.Now().Format("15:04"), printable(sender), printable(message))
+}
+
+// Returns the text without control characters.
+func printable(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// Returns the address of the site from the server argument, which may be a host name,
+// a site URL or the WebSocket URL. Host names are served over HTTPS, except for localhost.
+func siteURL(server string) (*url.URL, error) {
+	if !strings.Contains(server, "://") {
+		if strings.HasPrefix(server, "localhost") || strings.HasPrefix(server, "127.0.0.1") {
+			server = "http://" + server
+		} else {
+			server = "https://" + server
+		}
+	}
+	site, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	switch site.Scheme {
+	case "http", "https":
+	case "ws":
+		site.Scheme = "http"
+	case "wss":
+		site.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s", site.Scheme)
+	}
+	site.Path, site.RawQuery = "", ""
+	return site, nil
+}
+
+// Checks with /initiate whether the name is free and whether the room exists.
+func initiate(ctx context.Context, site *url.URL, name, roomID string) (initiation, error) {
+	var check initiation
+	initiateURL := *site
+	initiateURL.Path = "/initiate"
+	initiateURL.RawQuery = url.Values{"name": {name}, "roomID": {roomID}}.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, initiateURL.String(), nil)
+	if err != nil {
+		return check, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return check, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return check, err
+	}
+	if err := json.Unmarshal(body, &check); err != nil {
+		return check, fmt.Errorf("initiate: %s", response.Status)
+	}
+	if check.Error == protocol.CodeRateLimited {
+		return check, fmt.Errorf("too many attempts, try again in %d seconds", (check.RetryAfterMs+999)/1000)
+	}
+	if check.Error == protocol.CodeInvalidPayload {
+		problems := make([]string, len(check.Fields))
+		for i, field := range check.Fields {
+			problems[i] = "the " + field.Field + " " + field.Message
+		}
+		return check, errors.New(strings.Join(problems, ", "))
+	}
+	if response.StatusCode != http.StatusOK {
+		return check, fmt.Errorf("initiate: %s", response.Status)
+	}
+	return check, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// The screen of the chat: lines printed above a prompt on a terminal, or plain lines when
+// the input is piped.
+type console struct {
+	terminal *term.Terminal
+	restore  func()
+
+	// Used when the input is not a terminal.
+	scanner  *bufio.Scanner
+	writeMux sync.Mutex
+}
+
+// Creates a console on the standard input and output. Close restores the terminal.
+func newConsole(prompt string) (*console, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return &console{scanner: bufio.NewScanner(os.Stdin), restore: func() {}}, nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		terminal.SetSize(width, height)
+	}
+	return &console{terminal: terminal, restore: func() { term.Restore(fd, state) }}, nil
+}
+
+// Prints a line above the prompt.
+func (c *console) Printf(format string, args ...any) {
+	line := fmt.Sprintf(format, args...) + "\n"
+	if c.terminal != nil {
+		c.terminal.Write([]byte(line))
+		return
+	}
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	os.Stdout.WriteString(line)
+}
+
+// Reads a line typed by the user. Returns io.EOF on Ctrl-C, Ctrl-D or the end of the input.
+func (c *console) ReadLine() (string, error) {
+	if c.terminal != nil {
+		return c.terminal.ReadLine()
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return c.scanner.Text(), nil
+}
+
+// Restores the terminal.
+func (c *console) Close() {
+	c.restore()
+}
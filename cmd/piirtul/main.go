@@ -0,0 +1,39 @@
+// Piirtul is the command line client of piirtul.io.
+//
+//	piirtul chat [-name alice] piirtul.io ABCD
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: piirtul <command> [arguments]
+
+Commands:
+  chat <server> <room>   chat with the users of a room, creating the room if it does not exist
+
+Run "piirtul <command> -h" for the options of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch command := os.Args[1]; command {
+	case "chat":
+		err = chatCommand(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "piirtul: unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "piirtul:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encodes and decodes the frames of a protocol. Both codecs use the json struct tags, so the
+// messages have the same fields whatever the encoding.
+type Codec interface {
+	// The suffix of the subprotocol name, empty for JSON.
+	Name() string
+	// The WebSocket message type of the frames, websocket.TextMessage or websocket.BinaryMessage.
+	FrameType() int
+	Marshal(v any) ([]byte, error)
+	// Decodes strictly, like decodeStrict.
+	Unmarshal(raw []byte, v any, fieldPrefix string) error
+}
+
+// JSON text frames.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return ""
+}
+
+func (jsonCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(raw []byte, v any, fieldPrefix string) error {
+	return decodeStrict(raw, v, fieldPrefix)
+}
+
+// MessagePack binary frames, for native clients and rooms with heavy candidate traffic.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	// Numbers that went through the generic maps of the envelope are floats, send them as integers.
+	encoder.UseCompactInts(true)
+	encoder.UseCompactFloats(true)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(raw []byte, v any, fieldPrefix string) error {
+	reader := bytes.NewReader(raw)
+	decoder := msgpack.NewDecoder(reader)
+	decoder.SetCustomStructTag("json")
+	decoder.DisallowUnknownFields(true)
+	if err := decoder.Decode(v); err != nil {
+		// The decoder only reports unknown fields in the error text.
+		if field, ok := strings.CutPrefix(err.Error(), "msgpack: unknown field "); ok {
+			validationErr := &ValidationError{}
+			validationErr.add(fieldPrefix+strings.Trim(field, `"`), "is not a known field")
+			return validationErr
+		}
+		return err
+	}
+	if reader.Len() > 0 {
+		return errors.New("unexpected data after the message")
+	}
+	return nil
+}
+
+// A value left encoded, to be decoded later with the codec it came in.
+type rawValue []byte
+
+func (rv *rawValue) UnmarshalJSON(raw []byte) error {
+	*rv = append((*rv)[:0], raw...)
+	return nil
+}
+
+func (rv *rawValue) DecodeMsgpack(decoder *msgpack.Decoder) error {
+	raw, err := decoder.DecodeRaw()
+	*rv = rawValue(raw)
+	return err
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"signaling/protocol"
+)
+
+// A browser offer with one data channel and a few candidates.
+const benchmarkSDP = "v=0\r\n" +
+	"o=- 4611731400430051336 2 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=group:BUNDLE 0\r\n" +
+	"a=extmap-allow-mixed\r\n" +
+	"a=msid-semantic: WMS\r\n" +
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0\r\n" +
+	"a=candidate:1467250027 1 tcp 1518280447 192.168.0.196 9 typ host tcptype active generation 0\r\n" +
+	"a=candidate:435653019 1 udp 1845501695 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243 generation 0\r\n" +
+	"a=ice-ufrag:ZuSG\r\n" +
+	"a=ice-pwd:kyyD6pVr6f2qsUXn2ZQr4GJ+\r\n" +
+	"a=ice-options:trickle\r\n" +
+	"a=fingerprint:sha-256 5D:93:8B:EB:5C:2A:0E:1B:63:B2:3F:7E:1A:0C:7F:2D:61:76:AB:51:3F:1C:4D:02:63:17:CE:2E:D0:31:5C:1A\r\n" +
+	"a=setup:actpass\r\n" +
+	"a=mid:0\r\n" +
+	"a=sctp-port:5000\r\n" +
+	"a=max-message-size:262144\r\n"
+
+var benchmarkMessages = map[string]SocketMessage{
+	"candidate": {
+		Type: "candidate",
+		Name: "alice",
+		Candidate: &Candidate{
+			Candidate:        "candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0",
+			SdpMid:           "0",
+			UsernameFragment: "ZuSG",
+		},
+		RequestID: "r42",
+	},
+	"offer": {
+		Type:      "offer",
+		Name:      "alice",
+		Offer:     &Offer{Type: "offer", Sdp: benchmarkSDP},
+		RequestID: "r43",
+	},
+}
+
+var benchmarkProtocols = []string{protocolV1, protocolV2, protocolV2MsgPack}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, name := range benchmarkProtocols {
+		adapter := protocolAdapter(name)
+		for messageType, message := range benchmarkMessages {
+			b.Run(name+"/"+messageType, func(b *testing.B) {
+				var size int
+				for b.Loop() {
+					frame, err := adapter.Encode(message)
+					if err != nil {
+						b.Fatal(err)
+					}
+					size = len(frame)
+				}
+				b.ReportMetric(float64(size), "bytes/frame")
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, name := range benchmarkProtocols {
+		adapter := protocolAdapter(name)
+		for messageType, message := range benchmarkMessages {
+			frame, err := encodeInbound(adapter, message)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(name+"/"+messageType, func(b *testing.B) {
+				for b.Loop() {
+					if _, err := adapter.Decode(frame); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(frame)), "bytes/frame")
+			})
+		}
+	}
+}
+
+// Encodes the message as a client would send it. Relayed messages look the same in both directions,
+// except that the envelope of a request has no ok.
+func encodeInbound(adapter ProtocolAdapter, message SocketMessage) ([]byte, error) {
+	ep, ok := adapter.(envelopeProtocol)
+	if !ok {
+		return adapter.Encode(message)
+	}
+	envelope := map[string]any{
+		"v":    2,
+		"type": message.Type,
+		"id":   message.RequestID,
+		"data": protocol.Payload{
+			Name: message.Name, RoomID: message.RoomID, Role: message.Role,
+			Offer: message.Offer, Answer: message.Answer, Candidate: message.Candidate,
+		},
+	}
+	if message.Trace != nil {
+		envelope["trace"] = message.Trace
+	}
+	return ep.codec.Marshal(envelope)
+}
+
+// A message of every client message type.
+var clientMessages = []SocketMessage{
+	{Type: "initiation", Name: "alice", RequestID: "r1"},
+	{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator", RequestID: "r2"},
+	benchmarkMessages["offer"],
+	{Type: "answer", Name: "bob", Answer: &Answer{Type: "answer", Sdp: benchmarkSDP}, Trace: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+	benchmarkMessages["candidate"],
+	{Type: "candidate", Name: "bob", Candidate: &Candidate{Candidate: "candidate:1 1 udp 1 203.0.113.7 1 typ host", SdpMid: "1", SdpMLineIndex: 1}},
+	{Type: "leaveRoom"},
+}
+
+// Encodes the value with the codec, decodes it into a new value of the same type and checks
+// that it is equal to the original.
+func checkRoundTrip[T any](t *testing.T, codec Codec, value T) {
+	t.Helper()
+	raw, err := codec.Marshal(value)
+	if err != nil {
+		t.Fatalf("encoding %T: %v", value, err)
+	}
+	var decoded T
+	if err := codec.Unmarshal(raw, &decoded, ""); err != nil {
+		t.Fatalf("decoding %T: %v", value, err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("%T decoded as %+v, want %+v", value, decoded, value)
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{jsonCodec{}, msgpackCodec{}} {
+		for _, message := range clientMessages {
+			checkRoundTrip(t, codec, message)
+		}
+		checkRoundTrip(t, codec, SocketResponse{Type: "initiation", Success: false, Error: codeNameTaken, Message: "User with the given name exists already", RequestID: "r1"})
+		checkRoundTrip(t, codec, RoomSocketResponse{Type: "roomInitiation", Success: true, RoomID: "ROOM", Participants: []string{"alice", "bob"}, RequestID: "r2"})
+		checkRoundTrip(t, codec, LeavingResponse{Type: "peerLeavingRoom", Name: "alice", RoomDestroy: true})
+		checkRoundTrip(t, codec, DrainingResponse{Type: "serverDraining", Message: "The server is restarting", ReconnectAfterMs: 10000})
+		checkRoundTrip(t, codec, ValidationErrorResponse{Type: "error", Error: codeInvalidPayload, Message: "Invalid message", Fields: []FieldError{{Field: "name", Message: "is required for initiation"}}, RequestID: "r3"})
+		checkRoundTrip(t, codec, RateLimitedResponse{Type: "error", Error: codeRateLimited, Message: "Too many offer messages, slow down", RetryAfterMs: 1500})
+		checkRoundTrip(t, codec, protocol.Payload{Name: "alice", RoomID: "ROOM", Role: "participant", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}})
+	}
+}
+
+func TestProtocolRoundTrip(t *testing.T) {
+	for _, name := range benchmarkProtocols {
+		adapter := protocolAdapter(name)
+		for _, message := range clientMessages {
+			frame, err := encodeInbound(adapter, message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := adapter.Decode(frame)
+			if err != nil {
+				t.Errorf("%s decoding %s: %v", name, message.Type, err)
+				continue
+			}
+			if !reflect.DeepEqual(decoded, message) {
+				t.Errorf("%s decoded %+v, want %+v", name, decoded, message)
+			}
+		}
+	}
+}
+
+// Returns the fields of the ValidationError, or nil if err is another error.
+func validationFields(err error) []string {
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		return nil
+	}
+	fields := []string{}
+	for _, field := range ve.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+// Encodes a value with the msgpack codec for the tests, failing on errors.
+func msgpackFrame(t *testing.T, value any) []byte {
+	t.Helper()
+	raw, err := msgpackCodec{}.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestCodecUnknownFields(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		codec Codec
+		raw   []byte
+		want  []string
+	}{
+		{"json", jsonCodec{}, []byte(`{"type":"initiation","name":"alice","admin":true}`), []string{"admin"}},
+		{"json of a nested struct", jsonCodec{}, []byte(`{"type":"offer","offer":{"type":"offer","sdp":"v=0","extra":1}}`), []string{"extra"}},
+		{"msgpack", msgpackCodec{}, msgpackFrame(t, map[string]any{"type": "initiation", "name": "alice", "admin": true}), []string{"admin"}},
+		{"msgpack of a nested struct", msgpackCodec{}, msgpackFrame(t, map[string]any{"type": "offer", "offer": map[string]any{"type": "offer", "extra": 1}}), []string{"extra"}},
+	} {
+		var message SocketMessage
+		if got := validationFields(tt.codec.Unmarshal(tt.raw, &message, "")); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: unknown fields %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The payload fields of the envelope are reported with their path.
+	for _, name := range []string{protocolV2, protocolV2MsgPack} {
+		adapter := protocolAdapter(name).(envelopeProtocol)
+		frame, err := adapter.codec.Marshal(map[string]any{"v": 2, "type": "initiation", "data": map[string]any{"name": "alice", "admin": true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := adapter.Decode(frame); !slices.Equal(validationFields(err), []string{"data.admin"}) {
+			t.Errorf("%s: decoding an unknown payload field returned %v, want data.admin", name, err)
+		}
+		frame, err = adapter.codec.Marshal(map[string]any{"v": 2, "type": "initiation", "ok": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := adapter.Decode(frame); !slices.Equal(validationFields(err), []string{"ok"}) {
+			t.Errorf("%s: decoding an envelope with ok returned %v, want ok rejected", name, err)
+		}
+		frame, err = adapter.codec.Marshal(map[string]any{"v": 1, "type": "initiation"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := adapter.Decode(frame); !slices.Equal(validationFields(err), []string{"v"}) {
+			t.Errorf("%s: decoding a v1 envelope returned %v, want v rejected", name, err)
+		}
+	}
+}
+
+func TestCodecMalformed(t *testing.T) {
+	valid := msgpackFrame(t, SocketMessage{Type: "initiation", Name: "alice"})
+	for _, tt := range []struct {
+		name  string
+		codec Codec
+		raw   []byte
+	}{
+		{"empty json", jsonCodec{}, []byte("")},
+		{"truncated json", jsonCodec{}, []byte(`{"type":"initiation"`)},
+		{"a json array", jsonCodec{}, []byte(`["initiation"]`)},
+		{"a json field of the wrong type", jsonCodec{}, []byte(`{"type":1}`)},
+		{"json with data after the message", jsonCodec{}, []byte(`{"type":"initiation"} {}`)},
+		{"empty msgpack", msgpackCodec{}, []byte{}},
+		{"truncated msgpack", msgpackCodec{}, valid[:len(valid)-2]},
+		{"a msgpack string", msgpackCodec{}, msgpackFrame(t, "initiation")},
+		{"a msgpack field of the wrong type", msgpackCodec{}, msgpackFrame(t, map[string]any{"type": 1})},
+		{"msgpack with data after the message", msgpackCodec{}, append(slices.Clone(valid), valid...)},
+		{"an invalid msgpack code", msgpackCodec{}, []byte{0xc1}},
+	} {
+		var message SocketMessage
+		err := tt.codec.Unmarshal(tt.raw, &message, "")
+		if err == nil || validationFields(err) != nil {
+			t.Errorf("%s: decoding returned %v, want a syntax error", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The configuration of the server. Values are read, in increasing order of precedence, from the
+// defaults, the YAML configuration file, the environment variables and the command line flags.
+type Config struct {
+	// The address the HTTP server listens on, e.g. "localhost:9090".
+	ListenAddress string `yaml:"listen_address"`
+	// The URL the server is reachable at from the browsers, e.g. "https://piirtul.example.com".
+	// When empty it is derived from each request.
+	PublicURL      string             `yaml:"public_url"`
+	TLS            TLSConfig          `yaml:"tls"`
+	AllowedOrigins []string           `yaml:"allowed_origins"`
+	WebSocket      WebSocketConfig    `yaml:"websocket"`
+	WebTransport   WebTransportConfig `yaml:"webtransport"`
+	GRPC           GRPCConfig         `yaml:"grpc"`
+	Limits         LimitsConfig       `yaml:"limits"`
+	RateLimits     RateLimitsConfig   `yaml:"rate_limits"`
+	Policy         PolicyConfig       `yaml:"policy"`
+	// The ICE servers handed to the browsers.
+	ICEServers []ICEServer `yaml:"ice_servers"`
+	// Feature flags of the page, e.g. "chat" and "drawing".
+	Features map[string]bool `yaml:"features"`
+	// The room database implementation. Only "memory" is supported.
+	RoomBackend string         `yaml:"room_backend"`
+	Log         LogOptions     `yaml:"log"`
+	Admin       AdminConfig    `yaml:"admin"`
+	Shutdown    ShutdownConfig `yaml:"shutdown"`
+}
+
+// The TLS configuration. TLS is enabled when both files are set, or a self-signed certificate is used.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Generates a self-signed development certificate into the files if neither exists.
+	SelfSigned bool `yaml:"self_signed"`
+	// Extra host names and IP addresses of the self-signed certificate.
+	Hosts []string `yaml:"hosts"`
+	// How often the files are checked for changes. The certificate is also reloaded on SIGHUP.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	// When set, plain HTTP requests to this address are redirected to HTTPS.
+	RedirectAddress string `yaml:"redirect_address"`
+}
+
+// The WebSocket upgrader configuration.
+type WebSocketConfig struct {
+	ReadBufferSize  int `yaml:"read_buffer_size"`
+	WriteBufferSize int `yaml:"write_buffer_size"`
+	// Whether upgrades need a token minted by a page of this server.
+	RequireToken bool `yaml:"require_token"`
+	// The key the upgrade tokens are signed with. A random key is used when empty.
+	TokenSecret string `yaml:"token_secret"`
+	// How long an upgrade token is valid after the page has been rendered.
+	TokenTTL time.Duration `yaml:"token_ttl"`
+}
+
+// The WebTransport endpoint, served over HTTP/3 next to the HTTP server.
+type WebTransportConfig struct {
+	// The UDP address HTTP/3 listens on, e.g. "localhost:9443". WebTransport is disabled when empty.
+	ListenAddress string `yaml:"listen_address"`
+}
+
+// The gRPC API for native and server-side clients, served next to the HTTP server.
+type GRPCConfig struct {
+	// The TCP address the gRPC server listens on, e.g. "localhost:9091". gRPC is disabled when empty.
+	ListenAddress string `yaml:"listen_address"`
+}
+
+// Limits of the signaling server. Zero means unlimited.
+type LimitsConfig struct {
+	// The maximum size of an incoming socket message in bytes.
+	MaxMessageSize int64 `yaml:"max_message_size"`
+	MaxUsers       int   `yaml:"max_users"`
+	MaxRooms       int   `yaml:"max_rooms"`
+	MaxRoomSize    int   `yaml:"max_room_size"`
+}
+
+// Rate limits of the clients. A rate of zero disables a limit.
+type RateLimitsConfig struct {
+	// Take the client address from the X-Forwarded-For header. Only enable behind a reverse proxy.
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+	// Requests to /initiate per client address.
+	Initiate RateLimit `yaml:"initiate"`
+	// WebSocket upgrades per client address.
+	Upgrade RateLimit `yaml:"upgrade"`
+	// Messages posted to /signal by the event stream clients per client address. Every message
+	// is a request, so the limit covers the per connection limits of all message types.
+	Signal RateLimit `yaml:"signal"`
+	// Socket messages per connection by message type. "default" applies to the types not listed.
+	Messages map[string]RateLimit `yaml:"messages"`
+	// The maximum number of open WebSocket connections per client address. Zero means unlimited.
+	MaxConnectionsPerIP int `yaml:"max_connections_per_ip"`
+}
+
+// The admin dashboard configuration.
+type AdminConfig struct {
+	// The basic auth password of the "admin" user. The dashboard is disabled when empty.
+	Password string `yaml:"password"`
+}
+
+// The graceful shutdown configuration.
+type ShutdownConfig struct {
+	// How long the clients get to finish their signaling and disconnect after SIGTERM.
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+// Returns the default configuration.
+func DefaultConfig() Config {
+	return Config{
+		ListenAddress: "localhost:9090",
+		TLS: TLSConfig{
+			ReloadInterval: 10 * time.Second,
+		},
+		WebSocket: WebSocketConfig{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			RequireToken:    true,
+			TokenTTL:        time.Hour,
+		},
+		Limits: LimitsConfig{
+			MaxMessageSize: 64 * 1024,
+		},
+		RateLimits: RateLimitsConfig{
+			Initiate: RateLimit{Rate: 1, Burst: 10},
+			Upgrade:  RateLimit{Rate: 1, Burst: 10},
+			Signal:   RateLimit{Rate: 60, Burst: 240},
+			Messages: map[string]RateLimit{
+				"initiation":        {Rate: 1, Burst: 5},
+				"roomInitiation":    {Rate: 1, Burst: 5},
+				"offer":             {Rate: 5, Burst: 20},
+				"answer":            {Rate: 5, Burst: 20},
+				"candidate":         {Rate: 50, Burst: 200},
+				defaultMessageLimit: {Rate: 5, Burst: 20},
+			},
+			MaxConnectionsPerIP: 20,
+		},
+		Policy: PolicyConfig{
+			Candidates: candidatesAll,
+		},
+		ICEServers: []ICEServer{
+			{URLs: []string{"stun:stun.l.google.com:19302"}},
+		},
+		Features: map[string]bool{
+			"chat":    true,
+			"drawing": true,
+		},
+		RoomBackend: "memory",
+		Shutdown: ShutdownConfig{
+			GracePeriod: 10 * time.Second,
+		},
+		Log: LogOptions{
+			Format: "text",
+			Level:  slog.LevelInfo,
+		},
+	}
+}
+
+// A single configuration value that can be set with a flag or an environment variable.
+type configOption struct {
+	flag  string
+	env   string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+// All the options that can be set with flags and environment variables.
+var configOptions = []configOption{
+	{"listen", "PIIRTUL_LISTEN_ADDRESS", "address to listen on", func(c *Config, v string) error {
+		c.ListenAddress = v
+		return nil
+	}},
+	{"public-url", "PIIRTUL_PUBLIC_URL", "URL the server is reachable at from the browsers", func(c *Config, v string) error {
+		c.PublicURL = v
+		return nil
+	}},
+	{"tls-cert", "PIIRTUL_TLS_CERT_FILE", "TLS certificate file", func(c *Config, v string) error {
+		c.TLS.CertFile = v
+		return nil
+	}},
+	{"tls-key", "PIIRTUL_TLS_KEY_FILE", "TLS key file", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+		return nil
+	}},
+	{"tls-self-signed", "PIIRTUL_TLS_SELF_SIGNED", "generate a self-signed development certificate", func(c *Config, v string) error {
+		selfSigned, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.TLS.SelfSigned = selfSigned
+		return nil
+	}},
+	{"tls-hosts", "PIIRTUL_TLS_HOSTS", "comma separated extra hosts of the self-signed certificate", func(c *Config, v string) error {
+		c.TLS.Hosts = splitList(v)
+		return nil
+	}},
+	{"tls-redirect-address", "PIIRTUL_TLS_REDIRECT_ADDRESS", "address redirecting plain HTTP to HTTPS", func(c *Config, v string) error {
+		c.TLS.RedirectAddress = v
+		return nil
+	}},
+	{"allowed-origins", "PIIRTUL_ALLOWED_ORIGINS", "comma separated list of origins allowed to open a WebSocket", func(c *Config, v string) error {
+		c.AllowedOrigins = splitList(v)
+		return nil
+	}},
+	{"read-buffer-size", "PIIRTUL_READ_BUFFER_SIZE", "WebSocket read buffer size in bytes", func(c *Config, v string) error {
+		return setInt(&c.WebSocket.ReadBufferSize, v)
+	}},
+	{"write-buffer-size", "PIIRTUL_WRITE_BUFFER_SIZE", "WebSocket write buffer size in bytes", func(c *Config, v string) error {
+		return setInt(&c.WebSocket.WriteBufferSize, v)
+	}},
+	{"require-upgrade-token", "PIIRTUL_REQUIRE_UPGRADE_TOKEN", "require a page-minted token to open a WebSocket", func(c *Config, v string) error {
+		require, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.WebSocket.RequireToken = require
+		return nil
+	}},
+	{"upgrade-token-secret", "PIIRTUL_UPGRADE_TOKEN_SECRET", "key the upgrade tokens are signed with (random when empty)", func(c *Config, v string) error {
+		c.WebSocket.TokenSecret = v
+		return nil
+	}},
+	{"upgrade-token-ttl", "PIIRTUL_UPGRADE_TOKEN_TTL", "how long an upgrade token is valid, e.g. 1h", func(c *Config, v string) error {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		c.WebSocket.TokenTTL = ttl
+		return nil
+	}},
+	{"webtransport-listen", "PIIRTUL_WEBTRANSPORT_LISTEN_ADDRESS", "UDP address of the WebTransport endpoint (disabled when empty)", func(c *Config, v string) error {
+		c.WebTransport.ListenAddress = v
+		return nil
+	}},
+	{"grpc-listen", "PIIRTUL_GRPC_LISTEN_ADDRESS", "TCP address of the gRPC API (disabled when empty)", func(c *Config, v string) error {
+		c.GRPC.ListenAddress = v
+		return nil
+	}},
+	{"max-message-size", "PIIRTUL_MAX_MESSAGE_SIZE", "maximum socket message size in bytes (0 = unlimited)", func(c *Config, v string) error {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.Limits.MaxMessageSize = size
+		return nil
+	}},
+	{"max-users", "PIIRTUL_MAX_USERS", "maximum number of users (0 = unlimited)", func(c *Config, v string) error {
+		return setInt(&c.Limits.MaxUsers, v)
+	}},
+	{"max-rooms", "PIIRTUL_MAX_ROOMS", "maximum number of rooms (0 = unlimited)", func(c *Config, v string) error {
+		return setInt(&c.Limits.MaxRooms, v)
+	}},
+	{"max-room-size", "PIIRTUL_MAX_ROOM_SIZE", "maximum number of users in a room (0 = unlimited)", func(c *Config, v string) error {
+		return setInt(&c.Limits.MaxRoomSize, v)
+	}},
+	{"trust-forwarded-for", "PIIRTUL_TRUST_FORWARDED_FOR", "take the client address from X-Forwarded-For, only behind a proxy", func(c *Config, v string) error {
+		trust, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.RateLimits.TrustForwardedFor = trust
+		return nil
+	}},
+	{"initiate-rate-limit", "PIIRTUL_INITIATE_RATE_LIMIT", "/initiate requests per second and burst per address, e.g. 1/10 (0/0 = unlimited)", func(c *Config, v string) error {
+		limit, err := parseRateLimit(v)
+		c.RateLimits.Initiate = limit
+		return err
+	}},
+	{"upgrade-rate-limit", "PIIRTUL_UPGRADE_RATE_LIMIT", "WebSocket upgrades per second and burst per address, e.g. 1/10 (0/0 = unlimited)", func(c *Config, v string) error {
+		limit, err := parseRateLimit(v)
+		c.RateLimits.Upgrade = limit
+		return err
+	}},
+	{"signal-rate-limit", "PIIRTUL_SIGNAL_RATE_LIMIT", "messages posted to /signal per second and burst per address, e.g. 60/240 (0/0 = unlimited)", func(c *Config, v string) error {
+		limit, err := parseRateLimit(v)
+		c.RateLimits.Signal = limit
+		return err
+	}},
+	{"max-connections-per-ip", "PIIRTUL_MAX_CONNECTIONS_PER_IP", "maximum number of WebSocket connections per address (0 = unlimited)", func(c *Config, v string) error {
+		return setInt(&c.RateLimits.MaxConnectionsPerIP, v)
+	}},
+	{"data-channel-only", "PIIRTUL_DATA_CHANNEL_ONLY", "reject offers and answers with audio or video", func(c *Config, v string) error {
+		dataChannelOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.Policy.DataChannelOnly = dataChannelOnly
+		return nil
+	}},
+	{"candidates", "PIIRTUL_CANDIDATES", "which ICE candidates are relayed, all, no_host or relay_only", func(c *Config, v string) error {
+		c.Policy.Candidates = v
+		return nil
+	}},
+	{"strip-private-addresses", "PIIRTUL_STRIP_PRIVATE_ADDRESSES", "drop ICE candidates with private addresses", func(c *Config, v string) error {
+		strip, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.Policy.StripPrivateAddresses = strip
+		return nil
+	}},
+	{"ice-servers", "PIIRTUL_ICE_SERVERS", "comma separated list of STUN server URLs", func(c *Config, v string) error {
+		c.ICEServers = []ICEServer{}
+		for _, iceURL := range splitList(v) {
+			c.ICEServers = append(c.ICEServers, ICEServer{URLs: []string{iceURL}})
+		}
+		return nil
+	}},
+	{"features", "PIIRTUL_FEATURES", "comma separated list of feature flags, e.g. chat=true,drawing=false", func(c *Config, v string) error {
+		// A null features key in the configuration file leaves no map.
+		if c.Features == nil {
+			c.Features = map[string]bool{}
+		}
+		for _, item := range splitList(v) {
+			feature, value, _ := strings.Cut(item, "=")
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("feature %s: %w", feature, err)
+			}
+			c.Features[feature] = enabled
+		}
+		return nil
+	}},
+	{"room-backend", "PIIRTUL_ROOM_BACKEND", "room database implementation", func(c *Config, v string) error {
+		c.RoomBackend = v
+		return nil
+	}},
+	{"shutdown-grace-period", "PIIRTUL_SHUTDOWN_GRACE_PERIOD", "how long clients get to disconnect on shutdown, e.g. 10s", func(c *Config, v string) error {
+		gracePeriod, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		c.Shutdown.GracePeriod = gracePeriod
+		return nil
+	}},
+	{"log-format", "LOG_FORMAT", "log format, text or json", func(c *Config, v string) error {
+		c.Log.Format = strings.ToLower(v)
+		return nil
+	}},
+	{"log-level", "LOG_LEVEL", "log level, debug, info, warn or error", func(c *Config, v string) error {
+		return c.Log.Level.UnmarshalText([]byte(v))
+	}},
+	{"log-redact", "LOG_REDACT", "replace user names and addresses in the logs with a hash", func(c *Config, v string) error {
+		redact, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.Log.Redact = redact
+		return nil
+	}},
+	{"log-redact-key", "LOG_REDACT_KEY", "key of the redaction hash (random when empty)", func(c *Config, v string) error {
+		c.Log.RedactKey = v
+		return nil
+	}},
+	{"admin-password", "ADMIN_PASSWORD", "basic auth password of the admin dashboard", func(c *Config, v string) error {
+		c.Admin.Password = v
+		return nil
+	}},
+}
+
+// Loads the configuration from the command line arguments, the environment and the configuration
+// file given with -config or PIIRTUL_CONFIG, and validates it.
+func LoadConfig(args []string, getenv func(string) string) (Config, error) {
+	config := DefaultConfig()
+
+	// The flags are collected first and applied last, since they have the highest precedence.
+	flagValues := map[string]string{}
+	fs := flag.NewFlagSet("piirtul", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("PIIRTUL_CONFIG"), "YAML configuration file (env PIIRTUL_CONFIG)")
+	for _, option := range configOptions {
+		fs.Func(option.flag, fmt.Sprintf("%s (env %s)", option.usage, option.env), func(value string) error {
+			flagValues[option.flag] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return config, err
+	}
+
+	if *configFile != "" {
+		if err := config.loadFile(*configFile); err != nil {
+			return config, err
+		}
+	}
+
+	for _, option := range configOptions {
+		if value := getenv(option.env); value != "" {
+			if err := option.set(&config, value); err != nil {
+				return config, fmt.Errorf("invalid %s %q: %w", option.env, value, err)
+			}
+		}
+	}
+
+	for _, option := range configOptions {
+		if value, ok := flagValues[option.flag]; ok {
+			if err := option.set(&config, value); err != nil {
+				return config, fmt.Errorf("invalid -%s %q: %w", option.flag, value, err)
+			}
+		}
+	}
+
+	// Self-signed certificates are kept next to the working directory unless told otherwise.
+	if config.TLS.SelfSigned {
+		if config.TLS.CertFile == "" {
+			config.TLS.CertFile = "piirtul-dev-cert.pem"
+		}
+		if config.TLS.KeyFile == "" {
+			config.TLS.KeyFile = "piirtul-dev-key.pem"
+		}
+	}
+
+	return config, config.Validate()
+}
+
+// Reads the YAML configuration file on top of the current configuration. Unknown keys are rejected.
+func (config *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Checks that the configuration is usable. All problems are reported at once.
+func (config *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(config.ListenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("listen_address: %w", err))
+	}
+
+	if config.PublicURL != "" {
+		publicURL, err := url.Parse(config.PublicURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("public_url: %w", err))
+		} else if (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" {
+			errs = append(errs, errors.New("public_url: must be an absolute http or https URL"))
+		}
+	}
+
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls: both cert_file and key_file must be set"))
+	}
+	// Self-signed certificates are generated at startup when missing.
+	for _, file := range []string{config.TLS.CertFile, config.TLS.KeyFile} {
+		if file == "" || config.TLS.SelfSigned {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("tls: %w", err))
+		}
+	}
+	if config.TLS.ReloadInterval <= 0 {
+		errs = append(errs, errors.New("tls: reload_interval must be positive"))
+	}
+	if config.TLS.RedirectAddress != "" {
+		if !config.TLSEnabled() {
+			errs = append(errs, errors.New("tls: redirect_address needs TLS to be enabled"))
+		}
+		if _, _, err := net.SplitHostPort(config.TLS.RedirectAddress); err != nil {
+			errs = append(errs, fmt.Errorf("tls: redirect_address: %w", err))
+		}
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if _, err := parseOriginPattern(origin); err != nil {
+			errs = append(errs, fmt.Errorf("allowed_origins: %w", err))
+		}
+	}
+
+	if config.WebSocket.ReadBufferSize <= 0 || config.WebSocket.WriteBufferSize <= 0 {
+		errs = append(errs, errors.New("websocket: buffer sizes must be positive"))
+	}
+	if config.WebSocket.RequireToken && config.WebSocket.TokenTTL <= 0 {
+		errs = append(errs, errors.New("websocket: token_ttl must be positive"))
+	}
+
+	if config.WebTransport.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(config.WebTransport.ListenAddress); err != nil {
+			errs = append(errs, fmt.Errorf("webtransport: listen_address: %w", err))
+		}
+	}
+	if config.GRPC.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(config.GRPC.ListenAddress); err != nil {
+			errs = append(errs, fmt.Errorf("grpc: listen_address: %w", err))
+		}
+	}
+
+	limits := config.Limits
+	if limits.MaxMessageSize < 0 || limits.MaxUsers < 0 || limits.MaxRooms < 0 || limits.MaxRoomSize < 0 {
+		errs = append(errs, errors.New("limits: must not be negative"))
+	}
+
+	rateLimits := config.RateLimits
+	namedLimits := map[string]RateLimit{"initiate": rateLimits.Initiate, "upgrade": rateLimits.Upgrade, "signal": rateLimits.Signal}
+	for messageType, limit := range rateLimits.Messages {
+		if messageType != defaultMessageLimit && !isMessageType(messageType) {
+			errs = append(errs, fmt.Errorf("rate_limits: unknown message type %q", messageType))
+		}
+		namedLimits["messages."+messageType] = limit
+	}
+	for name, limit := range namedLimits {
+		if limit.Rate < 0 || (limit.Enabled() && limit.Burst < 1) {
+			errs = append(errs, fmt.Errorf("rate_limits: %s needs a non-negative rate and a burst of at least 1", name))
+		}
+	}
+	if rateLimits.MaxConnectionsPerIP < 0 {
+		errs = append(errs, errors.New("rate_limits: max_connections_per_ip must not be negative"))
+	}
+
+	switch config.Policy.Candidates {
+	case candidatesAll, candidatesNoHost, candidatesRelayOnly:
+	default:
+		errs = append(errs, fmt.Errorf("policy: unknown candidates policy %q, expected all, no_host or relay_only", config.Policy.Candidates))
+	}
+
+	for _, iceServer := range config.ICEServers {
+		if len(iceServer.URLs) == 0 {
+			errs = append(errs, errors.New("ice_servers: every server needs at least one URL"))
+		}
+		for _, iceURL := range iceServer.URLs {
+			if !validICEServerURL(iceURL) {
+				errs = append(errs, fmt.Errorf("ice_servers: %q is not a stun, stuns, turn or turns URL", iceURL))
+			}
+			if strings.HasPrefix(iceURL, "turn") && (iceServer.Username == "" || iceServer.Credential == "") {
+				errs = append(errs, fmt.Errorf("ice_servers: %q needs a username and a credential", iceURL))
+			}
+		}
+	}
+
+	if config.RoomBackend != "memory" {
+		errs = append(errs, fmt.Errorf("room_backend: unknown backend %q, expected memory", config.RoomBackend))
+	}
+
+	if config.Shutdown.GracePeriod < 0 {
+		errs = append(errs, errors.New("shutdown: grace_period must not be negative"))
+	}
+
+	if config.Log.Format != "text" && config.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log: invalid format %q, expected text or json", config.Log.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns whether TLS is configured.
+func (config *Config) TLSEnabled() bool {
+	return config.TLS.CertFile != "" && config.TLS.KeyFile != ""
+}
+
+// Creates the room database configured as the room backend.
+func (config *Config) NewRoomDatabase() RoomDatabase {
+	return &RoomSlice{
+		rooms:       make([]*Room, 0),
+		maxRooms:    config.Limits.MaxRooms,
+		maxRoomSize: config.Limits.MaxRoomSize,
+	}
+}
+
+// Splits a comma separated list, ignoring empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Parses an integer into target.
+func setInt(target *int, value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*target = parsed
+	return nil
+}
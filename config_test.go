@@ -0,0 +1,176 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes a configuration file into a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := writeConfigFile(t, "listen_address: yaml:1\nlimits:\n  max_users: 5\n")
+	for _, tt := range []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"the default", nil, nil, "localhost:9090"},
+		{"the file", []string{"-config", file}, nil, "yaml:1"},
+		{"the file from the environment", nil, map[string]string{"PIIRTUL_CONFIG": file}, "yaml:1"},
+		{"the environment over the file", []string{"-config", file}, map[string]string{"PIIRTUL_LISTEN_ADDRESS": "env:1"}, "env:1"},
+		{"a flag over the environment", []string{"-config", file, "-listen", "flag:1"}, map[string]string{"PIIRTUL_LISTEN_ADDRESS": "env:1"}, "flag:1"},
+	} {
+		config, err := LoadConfig(tt.args, func(key string) string { return tt.env[key] })
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if config.ListenAddress != tt.want {
+			t.Errorf("%s: listening on %q, want %q", tt.name, config.ListenAddress, tt.want)
+		}
+	}
+
+	// The file only replaces the keys it has.
+	config, err := LoadConfig([]string{"-config", file}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Limits.MaxUsers != 5 || config.WebSocket.TokenTTL != time.Hour || !config.Features["chat"] {
+		t.Errorf("loaded %+v, want the file on top of the defaults", config)
+	}
+}
+
+func TestConfigFeatures(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file string
+		env  string
+		want map[string]bool
+	}{
+		{"the defaults", "", "", map[string]bool{"chat": true, "drawing": true}},
+		{"an override", "", "drawing=false", map[string]bool{"chat": true, "drawing": false}},
+		{"the file on top of the defaults", "features:\n  chat: false\n", "", map[string]bool{"chat": false, "drawing": true}},
+		{"null in the file", "features:\n", "chat=true", map[string]bool{"chat": true}},
+	} {
+		args := []string{}
+		if tt.file != "" {
+			args = append(args, "-config", writeConfigFile(t, tt.file))
+		}
+		config, err := LoadConfig(args, func(key string) string { return map[string]string{"PIIRTUL_FEATURES": tt.env}[key] })
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !maps.Equal(config.Features, tt.want) {
+			t.Errorf("%s: the features are %v, want %v", tt.name, config.Features, tt.want)
+		}
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, file, want string
+	}{
+		{"an unknown key", "listen_adress: localhost:9090\n", "field listen_adress not found"},
+		{"an unknown nested key", "limits:\n  max_user: 5\n", "field max_user not found"},
+		{"a value of the wrong type", "limits:\n  max_users: many\n", "cannot unmarshal"},
+	} {
+		_, err := LoadConfig([]string{"-config", writeConfigFile(t, tt.file)}, func(string) string { return "" })
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: loading failed with %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := LoadConfig([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, func(string) string { return "" }); err == nil {
+		t.Error("loaded a missing configuration file, want an error")
+	}
+}
+
+func TestConfigRateLimits(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  RateLimit
+		ok    bool
+	}{
+		{"2/5", RateLimit{Rate: 2, Burst: 5}, true},
+		{"0.5/1", RateLimit{Rate: 0.5, Burst: 1}, true},
+		{"0/0", RateLimit{}, true},
+		{"2", RateLimit{}, false},
+		{"fast/5", RateLimit{}, false},
+		{"2/many", RateLimit{}, false},
+		{"2/0", RateLimit{}, false},
+		{"-1/5", RateLimit{}, false},
+	} {
+		config, err := LoadConfig([]string{"-initiate-rate-limit", tt.value}, func(string) string { return "" })
+		if (err == nil) != tt.ok || (tt.ok && config.RateLimits.Initiate != tt.want) {
+			t.Errorf("the limit %q loaded %+v, %v, want %+v and ok %t", tt.value, config.RateLimits.Initiate, err, tt.want, tt.ok)
+		}
+	}
+
+	_, err := LoadConfig([]string{"-config", writeConfigFile(t, "rate_limits:\n  messages:\n    nope: {rate: 1, burst: 1}\n")}, func(string) string { return "" })
+	if err == nil || !strings.Contains(err.Error(), `unknown message type "nope"`) {
+		t.Errorf("a limit of an unknown message type failed with %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(config *Config)
+		want   string
+	}{
+		{"a listen address without a port", func(c *Config) { c.ListenAddress = "localhost" }, "listen_address"},
+		{"a relative public URL", func(c *Config) { c.PublicURL = "/piirtul" }, "public_url: must be an absolute http or https URL"},
+		{"an unparsable public URL", func(c *Config) { c.PublicURL = "http://[::1" }, "public_url"},
+		{"a certificate without a key", func(c *Config) { c.TLS.CertFile = "cert.pem" }, "tls: both cert_file and key_file must be set"},
+		{"missing certificate files", func(c *Config) { c.TLS.CertFile, c.TLS.KeyFile = "missing-cert.pem", "missing-key.pem" }, "tls: stat missing-cert.pem"},
+		{"no reload interval", func(c *Config) { c.TLS.ReloadInterval = 0 }, "tls: reload_interval must be positive"},
+		{"a redirect without TLS", func(c *Config) { c.TLS.RedirectAddress = "localhost:8080" }, "tls: redirect_address needs TLS to be enabled"},
+		{"a redirect address without a port", func(c *Config) { c.TLS.RedirectAddress = "localhost" }, "tls: redirect_address:"},
+		{"an invalid origin", func(c *Config) { c.AllowedOrigins = []string{"example.com"} }, "allowed_origins"},
+		{"no read buffer", func(c *Config) { c.WebSocket.ReadBufferSize = 0 }, "websocket: buffer sizes must be positive"},
+		{"no token TTL", func(c *Config) { c.WebSocket.TokenTTL = 0 }, "websocket: token_ttl must be positive"},
+		{"a WebTransport address without a port", func(c *Config) { c.WebTransport.ListenAddress = "localhost" }, "webtransport: listen_address"},
+		{"a gRPC address without a port", func(c *Config) { c.GRPC.ListenAddress = "localhost" }, "grpc: listen_address"},
+		{"a negative limit", func(c *Config) { c.Limits.MaxUsers = -1 }, "limits: must not be negative"},
+		{"an unknown message type", func(c *Config) { c.RateLimits.Messages["nope"] = RateLimit{} }, `rate_limits: unknown message type "nope"`},
+		{"a negative rate", func(c *Config) { c.RateLimits.Upgrade = RateLimit{Rate: -1, Burst: 1} }, "rate_limits: upgrade needs"},
+		{"a rate without a burst", func(c *Config) { c.RateLimits.Messages["offer"] = RateLimit{Rate: 1} }, "rate_limits: messages.offer needs"},
+		{"a negative connection limit", func(c *Config) { c.RateLimits.MaxConnectionsPerIP = -1 }, "rate_limits: max_connections_per_ip must not be negative"},
+		{"an unknown candidates policy", func(c *Config) { c.Policy.Candidates = "some" }, `policy: unknown candidates policy "some"`},
+		{"an ICE server without URLs", func(c *Config) { c.ICEServers = []ICEServer{{}} }, "ice_servers: every server needs at least one URL"},
+		{"an ICE server of another scheme", func(c *Config) { c.ICEServers = []ICEServer{{URLs: []string{"http://example.com"}}} }, "is not a stun, stuns, turn or turns URL"},
+		{"a TURN server without credentials", func(c *Config) { c.ICEServers = []ICEServer{{URLs: []string{"turn:turn.example.com"}}} }, "needs a username and a credential"},
+		{"an unknown room backend", func(c *Config) { c.RoomBackend = "redis" }, `room_backend: unknown backend "redis"`},
+		{"a negative grace period", func(c *Config) { c.Shutdown.GracePeriod = -time.Second }, "shutdown: grace_period must not be negative"},
+		{"an unknown log format", func(c *Config) { c.Log.Format = "xml" }, `log: invalid format "xml"`},
+	} {
+		config := DefaultConfig()
+		tt.change(&config)
+		if err := config.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s failed with %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	config := DefaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Errorf("the default configuration failed with %v", err)
+	}
+	// All the problems are reported at once.
+	config.ListenAddress, config.Log.Format = "localhost", "xml"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "listen_address") || !strings.Contains(err.Error(), "log: invalid format") {
+		t.Errorf("two problems failed with %v, want both", err)
+	}
+}
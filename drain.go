@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"signaling/protocol"
+
+	"github.com/labstack/echo/v4"
+)
+
+// How long writing a close frame may take.
+const closeWriteTimeout = time.Second
+
+// How often the drain checks whether every client has disconnected.
+const drainPollInterval = 100 * time.Millisecond
+
+// The message sent to every client when the server starts draining.
+type DrainingResponse = protocol.DrainingResponse
+
+// Returns whether the server is draining.
+func (ss *SignalingServer) Draining() bool {
+	return ss.draining.Load()
+}
+
+// A middleware that rejects new requests with 503 while the server is draining.
+func (ss *SignalingServer) rejectWhileDraining(gracePeriod time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if ss.Draining() {
+				retryAfter := int(gracePeriod.Round(time.Second) / time.Second)
+				c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+			}
+			return next(c)
+		}
+	}
+}
+
+// Drains the server: new connections are rejected, every client is told to reconnect later, and
+// the clients get the grace period to finish their signaling and disconnect. Then the rooms are
+// persisted, and the connections left are closed with a going away close frame.
+func (ss *SignalingServer) Drain(ctx context.Context, gracePeriod time.Duration) {
+	ss.draining.Store(true)
+
+	sessions := ss.Sessions()
+	ss.logger.Info("Draining connections", "connections", len(sessions), "grace_period", gracePeriod)
+
+	response := DrainingResponse{
+		Type:             "serverDraining",
+		Message:          "The server is shutting down",
+		ReconnectAfterMs: gracePeriod.Milliseconds(),
+	}
+	for _, session := range sessions {
+		if err := ss.sendSocketResponse(session, response); err != nil {
+			ss.sessionLogger(session).Warn("Failed to send draining notification", logKeyError, err)
+		}
+	}
+
+	graceCtx, cancel := context.WithTimeout(ctx, gracePeriod)
+	defer cancel()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for ss.ConnCount() > 0 && graceCtx.Err() == nil {
+		select {
+		case <-graceCtx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	// The rooms are persisted before the remaining users are disconnected and removed from them.
+	ss.persistRooms()
+	if ss.ConnCount() == 0 {
+		ss.logger.Info("All connections drained")
+		return
+	}
+	ss.closeConns()
+}
+
+// Asks every open connection to close because the server is going away. The clients get a moment
+// to close, after which the connections still open are closed without waiting.
+func (ss *SignalingServer) closeConns() {
+	sessions := ss.Sessions()
+	ss.logger.Info("Closing the remaining connections", "connections", len(sessions))
+
+	for _, session := range sessions {
+		if err := session.transport.GoAway("server shutting down"); err != nil {
+			ss.sessionLogger(session).Debug("Failed to send close frame", logKeyError, err)
+		}
+	}
+
+	deadline := time.Now().Add(closeWriteTimeout)
+	for ss.ConnCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+	for _, session := range ss.Sessions() {
+		session.Close()
+	}
+}
+
+// Persists the rooms if the room backend supports it.
+func (ss *SignalingServer) persistRooms() {
+	persisted, err := ss.rooms.Persist()
+	switch {
+	case err != nil:
+		ss.logger.Error("Failed to persist the rooms", logKeyError, err)
+	case persisted:
+		ss.logger.Info("Persisted the rooms")
+	default:
+		ss.logger.Info("The room backend does not support persisting, the rooms are lost")
+	}
+}
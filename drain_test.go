@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDrainWebSocket(t *testing.T) {
+	ts := newTestServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false"})
+	ws, _, err := websocket.DefaultDialer.Dial(ts.wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := ws.WriteJSON(SocketMessage{Type: "initiation", Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	var initiation SocketResponse
+	if err := ws.ReadJSON(&initiation); err != nil || !initiation.Success {
+		t.Fatalf("the initiation answered %+v, %v", initiation, err)
+	}
+
+	// Alice stays connected through the grace period, so her connection is closed at its end.
+	gracePeriod := 200 * time.Millisecond
+	drained := make(chan struct{})
+	go func() {
+		ts.ss.Drain(context.Background(), gracePeriod)
+		close(drained)
+	}()
+	ws.SetReadDeadline(time.Now().Add(testTimeout))
+	var draining DrainingResponse
+	if err := ws.ReadJSON(&draining); err != nil {
+		t.Fatal(err)
+	}
+	if draining.Type != "serverDraining" || draining.ReconnectAfterMs != gracePeriod.Milliseconds() {
+		t.Errorf("alice received %+v, want the draining notice reconnecting after %d ms", draining, gracePeriod.Milliseconds())
+	}
+
+	// New upgrades are refused while the connections drain.
+	_, response, err := websocket.DefaultDialer.Dial(ts.wsURL, nil)
+	if err == nil || response == nil || response.StatusCode != http.StatusServiceUnavailable || response.Header.Get("Retry-After") == "" {
+		t.Errorf("an upgrade while draining answered %v, %v, want %d with Retry-After", response, err, http.StatusServiceUnavailable)
+	}
+
+	_, _, err = ws.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("the connection ended with %v, want the close code %d", err, websocket.CloseGoingAway)
+	}
+	select {
+	case <-drained:
+	case <-time.After(testTimeout):
+		t.Fatal("the drain did not end")
+	}
+	eventually(t, func() bool { return ts.ss.ConnCount() == 0 }, "connections are left after the drain")
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"signaling/client"
+	"signaling/peer"
+	"signaling/protocol"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pion/ice/v4"
+	"github.com/pion/logging"
+	"github.com/pion/transport/v3/vnet"
+	"github.com/pion/webrtc/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// How long the tests wait for an event before failing.
+const testTimeout = 10 * time.Second
+
+// The server of a test, started from newApp on an httptest server.
+type testServer struct {
+	ss    *SignalingServer
+	wsURL string
+}
+
+// Creates the app with the default configuration and the environment variables.
+func newTestApp(t *testing.T, env map[string]string) (*echo.Echo, *SignalingServer) {
+	t.Helper()
+	config, err := LoadConfig(nil, func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ss, _, _, err := newApp(&config, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, ss
+}
+
+// Starts the app on an httptest server.
+func newTestServer(t *testing.T, env map[string]string) *testServer {
+	t.Helper()
+	e, ss := newTestApp(t, env)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return &testServer{ss: ss, wsURL: "ws" + strings.TrimPrefix(server.URL, "http") + "/websocket"}
+}
+
+// A simulated network with a WebRTC API for each peer, so the peers connect without real interfaces.
+func newTestNetwork(t *testing.T, peers int) []*webrtc.API {
+	t.Helper()
+	router, err := vnet.NewRouter(&vnet.RouterConfig{CIDR: "10.0.0.0/24", LoggerFactory: logging.NewDefaultLoggerFactory()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apis := make([]*webrtc.API, peers)
+	for i := range apis {
+		network, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{fmt.Sprintf("10.0.0.%d", i+2)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := router.AddNet(network); err != nil {
+			t.Fatal(err)
+		}
+		settings := webrtc.SettingEngine{}
+		settings.SetNet(network)
+		settings.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+		apis[i] = webrtc.NewAPI(webrtc.WithSettingEngine(settings))
+	}
+	if err := router.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Stop() })
+	return apis
+}
+
+// A peer of a test, recording what it receives as events like "chat alice: hello".
+type testPeer struct {
+	*peer.Peer
+	events chan string
+}
+
+// Connects a peer to the server over the API's network.
+func (ts *testServer) dial(t *testing.T, api *webrtc.API, name, subprotocol string) *testPeer {
+	t.Helper()
+	events := make(chan string, 100)
+	record := func(format string, args ...any) {
+		select {
+		case events <- fmt.Sprintf(format, args...):
+		default:
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	p, err := peer.Dial(ctx, ts.wsURL, peer.Options{
+		Client:     client.Options{Name: name, Protocol: subprotocol},
+		ICEServers: []webrtc.ICEServer{},
+		API:        api,
+		Handlers: peer.Handlers{
+			OnChat:     func(from string, chat peer.Chat) { record("chat %s: %s", from, chat.Message) },
+			OnDrawing:  func(from string, drawing peer.Drawing) { record("drawing %s: %v,%v", from, drawing.X, drawing.Y) },
+			OnClear:    func(from string) { record("clear %s", from) },
+			OnOpen:     func(name string) { record("open %s", name) },
+			OnPeerLeft: func(name string, roomDestroyed bool) { record("left %s %t", name, roomDestroyed) },
+		},
+	})
+	if err != nil {
+		t.Fatalf("dialing %s: %v", name, err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return &testPeer{Peer: p, events: events}
+}
+
+// Waits for the event, skipping the others.
+func (tp *testPeer) expect(t *testing.T, event string) {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case received := <-tp.events:
+			if received == event {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("%s did not receive %q", tp.Name(), event)
+		}
+	}
+}
+
+// Waits until the data channels between the peers are open.
+func waitOpen(t *testing.T, peers ...*testPeer) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	for _, a := range peers {
+		for _, b := range peers {
+			if a == b {
+				continue
+			}
+			if err := a.WaitOpen(ctx, b.Name()); err != nil {
+				t.Fatalf("data channel from %s to %s: %v", a.Name(), b.Name(), err)
+			}
+		}
+	}
+}
+
+// Waits until the condition holds.
+func eventually(t *testing.T, condition func() bool, format string, args ...any) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func requestContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestRoomFlow(t *testing.T) {
+	ts := newTestServer(t, nil)
+	apis := newTestNetwork(t, 3)
+	alice := ts.dial(t, apis[0], "alice", protocol.V2)
+	bob := ts.dial(t, apis[1], "bob", protocol.V1)
+	carol := ts.dial(t, apis[2], "carol", protocol.V2)
+	ctx := requestContext(t)
+
+	if err := alice.CreateRoom(ctx, "ROOM"); err != nil {
+		t.Fatal(err)
+	}
+	participants, err := bob.JoinRoom(ctx, "ROOM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(participants, []string{"alice"}) {
+		t.Errorf("bob got the participants %v, want [alice]", participants)
+	}
+	waitOpen(t, alice, bob)
+
+	participants, err = carol.JoinRoom(ctx, "ROOM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(participants)
+	if !slices.Equal(participants, []string{"alice", "bob"}) {
+		t.Errorf("carol got the participants %v, want [alice bob]", participants)
+	}
+	waitOpen(t, alice, bob, carol)
+
+	for _, messageType := range []string{protocol.TypeOffer, protocol.TypeAnswer, protocol.TypeCandidate} {
+		if count := testutil.ToFloat64(ts.ss.metrics.messages.WithLabelValues(messageType)); count == 0 {
+			t.Errorf("no %s messages were relayed", messageType)
+		}
+	}
+
+	if err := alice.SendChat("hello"); err != nil {
+		t.Fatal(err)
+	}
+	bob.expect(t, "chat alice: hello")
+	carol.expect(t, "chat alice: hello")
+
+	if err := bob.SendDrawing(peer.Drawing{PrevX: 1, PrevY: 2, X: 3, Y: 4, Color: "#000000", Thickness: 2}); err != nil {
+		t.Fatal(err)
+	}
+	alice.expect(t, "drawing bob: 3,4")
+	carol.expect(t, "drawing bob: 3,4")
+
+	if err := carol.SendClear(); err != nil {
+		t.Fatal(err)
+	}
+	alice.expect(t, "clear carol")
+	bob.expect(t, "clear carol")
+}
+
+func TestParticipantLeaves(t *testing.T) {
+	ts := newTestServer(t, nil)
+	apis := newTestNetwork(t, 3)
+	alice := ts.dial(t, apis[0], "alice", protocol.V2)
+	bob := ts.dial(t, apis[1], "bob", protocol.V2)
+	carol := ts.dial(t, apis[2], "carol", protocol.V2)
+	ctx := requestContext(t)
+
+	if err := alice.CreateRoom(ctx, "ROOM"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*testPeer{bob, carol} {
+		if _, err := p.JoinRoom(ctx, "ROOM"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitOpen(t, alice, bob, carol)
+
+	if err := bob.Leave(ctx); err != nil {
+		t.Fatal(err)
+	}
+	alice.expect(t, "left bob false")
+	carol.expect(t, "left bob false")
+	if got := ts.ss.UserFromName("bob"); got != nil {
+		t.Error("bob is still a user after leaving")
+	}
+	room, err := ts.ss.rooms.Get("ROOM")
+	if err != nil || room == nil {
+		t.Fatalf("the room is gone after a participant left: %v", err)
+	}
+
+	if err := alice.SendChat("still here"); err != nil {
+		t.Fatal(err)
+	}
+	carol.expect(t, "chat alice: still here")
+}
+
+func TestOwnerLeaveDestroysRoom(t *testing.T) {
+	ts := newTestServer(t, nil)
+	apis := newTestNetwork(t, 3)
+	alice := ts.dial(t, apis[0], "alice", protocol.V2)
+	bob := ts.dial(t, apis[1], "bob", protocol.V2)
+	carol := ts.dial(t, apis[2], "carol", protocol.V1)
+	ctx := requestContext(t)
+
+	if err := alice.CreateRoom(ctx, "ROOM"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*testPeer{bob, carol} {
+		if _, err := p.JoinRoom(ctx, "ROOM"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitOpen(t, alice, bob, carol)
+
+	if err := alice.Leave(ctx); err != nil {
+		t.Fatal(err)
+	}
+	bob.expect(t, "left alice true")
+	carol.expect(t, "left alice true")
+	eventually(t, func() bool {
+		room, err := ts.ss.rooms.Get("ROOM")
+		return err != nil || room == nil
+	}, "the room still exists after the owner left")
+
+	_, err := bob.JoinRoom(ctx, "ROOM")
+	var clientErr *client.Error
+	if !errors.As(err, &clientErr) || clientErr.Code != protocol.CodeRoomNotFound {
+		t.Errorf("joining the destroyed room returned %v, want %s", err, protocol.CodeRoomNotFound)
+	}
+}
+
+func TestUsersCleanedUp(t *testing.T) {
+	ts := newTestServer(t, nil)
+	apis := newTestNetwork(t, 2)
+	alice := ts.dial(t, apis[0], "alice", protocol.V2)
+	bob := ts.dial(t, apis[1], "bob", protocol.V1)
+	ctx := requestContext(t)
+
+	if err := alice.CreateRoom(ctx, "ROOM"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.JoinRoom(ctx, "ROOM"); err != nil {
+		t.Fatal(err)
+	}
+	waitOpen(t, alice, bob)
+	if count := ts.ss.UserCount(); count != 2 {
+		t.Fatalf("%d users after joining, want 2", count)
+	}
+
+	// Closing the connections without leaving is cleaned up like a leave.
+	bob.Close()
+	alice.expect(t, "left bob false")
+	alice.Close()
+	eventually(t, func() bool { return ts.ss.UserCount() == 0 }, "users are left after the connections closed")
+	eventually(t, func() bool {
+		rooms, err := ts.ss.rooms.List()
+		return err == nil && len(rooms) == 0
+	}, "rooms are left after the connections closed")
+}
+
+func TestRequestErrors(t *testing.T) {
+	ts := newTestServer(t, nil)
+	apis := newTestNetwork(t, 2)
+	alice := ts.dial(t, apis[0], "alice", protocol.V2)
+	ctx := requestContext(t)
+
+	_, err := alice.JoinRoom(ctx, "NONE")
+	var clientErr *client.Error
+	if !errors.As(err, &clientErr) || clientErr.Code != protocol.CodeRoomNotFound {
+		t.Errorf("joining a missing room returned %v, want %s", err, protocol.CodeRoomNotFound)
+	}
+
+	_, err = peer.Dial(ctx, ts.wsURL, peer.Options{Client: client.Options{Name: "alice"}, ICEServers: []webrtc.ICEServer{}, API: apis[1]})
+	if !errors.As(err, &clientErr) || clientErr.Code != protocol.CodeNameTaken {
+		t.Errorf("dialing with a taken name returned %v, want %s", err, protocol.CodeNameTaken)
+	}
+
+	if err := alice.CreateRoom(ctx, "ROOM"); err != nil {
+		t.Fatal(err)
+	}
+	err = alice.CreateRoom(ctx, "ROOM")
+	if !errors.As(err, &clientErr) || clientErr.Code == "" {
+		t.Errorf("creating a second room returned %v, want an error code", err)
+	}
+}
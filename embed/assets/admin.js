@@ -0,0 +1,58 @@
+// DOM elements for readability
+const connectionStatus = document.getElementById('connection-status');
+const userCount = document.getElementById('user-count');
+const roomCount = document.getElementById('room-count');
+const messageRate = document.getElementById('message-rate');
+const roomList = document.getElementById('room-list');
+const messageTypes = document.getElementById('message-types');
+const errorList = document.getElementById('error-list');
+const lastUpdate = document.getElementById('last-update');
+
+// The server pushes a snapshot of its state every second.
+// EventSource reconnects automatically if the connection drops.
+const events = new EventSource('/admin/events');
+
+events.onopen = () => setConnectionStatus(true);
+events.onerror = () => setConnectionStatus(false);
+events.addEventListener('snapshot', (event) => render(JSON.parse(event.data)));
+
+function setConnectionStatus(online) {
+    connectionStatus.textContent = online ? 'live' : 'offline';
+    connectionStatus.className = online ? 'status online' : 'status offline';
+}
+
+// Render a snapshot. Everything is rebuilt from scratch since the lists are small.
+function render(snapshot) {
+    userCount.textContent = snapshot.user_count;
+    roomCount.textContent = snapshot.room_count;
+    messageRate.textContent = snapshot.message_rate.toFixed(1);
+    lastUpdate.textContent = new Date(snapshot.time).toLocaleTimeString();
+
+    roomList.innerHTML = '';
+    snapshot.rooms.forEach((room) => {
+        roomList.appendChild(row([room.room_id, room.owner, room.members.join(', ')]));
+    });
+
+    messageTypes.innerHTML = '';
+    Object.keys(snapshot.messages_by_type).sort().forEach((type) => {
+        messageTypes.appendChild(row([type, snapshot.messages_by_type[type]]));
+    });
+
+    errorList.innerHTML = '';
+    snapshot.recent_errors.slice().reverse().forEach((error) => {
+        const errorItem = document.createElement('li');
+        errorItem.textContent = `${new Date(error.time).toLocaleTimeString()} [${error.source}] ${error.message}`;
+        errorList.appendChild(errorItem);
+    });
+}
+
+// Create a table row. textContent is used so names can't inject markup.
+function row(cells) {
+    const tableRow = document.createElement('tr');
+    cells.forEach((cell) => {
+        const tableCell = document.createElement('td');
+        tableCell.textContent = cell;
+        tableRow.appendChild(tableCell);
+    });
+    return tableRow;
+}
@@ -3,51 +3,97 @@ const createRoomButton = document.querySelector('#create-room-btn');
 const joinRoomButton = document.querySelector('#join-room-btn');
 const nameInput = document.querySelector('#name');
 
+// The rules of the server for names and room IDs, see validation.go.
+const maxNameLength = 32;
+const namePattern = /^[\p{L}\p{Nd} _.-]*$/u;
+const roomIDPattern = /^[A-Z0-9]{4,16}$/;
+
+// Returns what is wrong with the name, or null if it is valid.
+function nameProblem(name) {
+    if (name.length === 0) {
+        return "Please enter a name";
+    }
+    if ([...name].length > maxNameLength) {
+        return "The name must be at most " + maxNameLength + " characters.";
+    }
+    if (name.trim() !== name) {
+        return "The name must not start or end with a space.";
+    }
+    if (!namePattern.test(name)) {
+        return "The name may only contain letters, digits, spaces and _ - .";
+    }
+    return null;
+}
+
+// Returns what is wrong with the room ID, or null if it is valid.
+function roomIDProblem(roomID) {
+    if (!roomIDPattern.test(roomID)) {
+        return "The room ID must be 4 to 16 letters and digits.";
+    }
+    return null;
+}
+
 // Handle room creation
 createRoomButton.addEventListener("click", function() {
     username = nameInput.value;
-    if (username.length > 0) {
-        const user = { role: 'creator', name: username };
-        localStorage.setItem('user', JSON.stringify(user));
-        window.location.href = '/room';
-    } else {
-        alert("Please enter a name");
+    const problem = nameProblem(username);
+    if (problem) {
+        alert(problem);
+        return;
     }
+    const user = { role: 'creator', name: username };
+    localStorage.setItem('user', JSON.stringify(user));
+    window.location.href = '/room';
 });
 
 // Handle room joining
 joinRoomButton.addEventListener("click", function() {
     username = nameInput.value;
-    if (username.length > 0) {
-        roomID = prompt("Enter the roomID:");
-        if (roomID) {
-            // Send a GET request to /initiate
-            fetch(`/initiate?name=${encodeURIComponent(username)}&roomID=${encodeURIComponent(roomID.toUpperCase())}`)
-                .then(response => response.json())
-                .then(data => {
-                    const { name_success, room_success } = data;
-                    if (name_success && room_success) {
-                        // Both checks passed; proceed to the room
-                        const user = { role: 'participant', name: username, roomID: roomID.toUpperCase() };
-                        localStorage.setItem('user', JSON.stringify(user));
-                        window.location.href = '/room';
+    const problem = nameProblem(username);
+    if (problem) {
+        alert(problem);
+        return;
+    }
+    roomID = prompt("Enter the roomID:");
+    if (roomID) {
+        roomID = roomID.trim().toUpperCase();
+        const roomProblem = roomIDProblem(roomID);
+        if (roomProblem) {
+            alert(roomProblem);
+            return;
+        }
+        // Send a GET request to /initiate
+        fetch(`/initiate?name=${encodeURIComponent(username)}&roomID=${encodeURIComponent(roomID)}`)
+            .then(response => response.json())
+            .then(data => {
+                if (data.error === "rate_limited") {
+                    alert("Too many attempts, please wait " + Math.ceil(data.retry_after_ms / 1000) + " seconds and try again.");
+                    return;
+                }
+                if (data.error === "invalid_payload") {
+                    alert((data.fields || []).map(field => "The " + field.field + " " + field.message + ".").join("\n"));
+                    return;
+                }
+                const { name_success, room_success } = data;
+                if (name_success && room_success) {
+                    // Both checks passed; proceed to the room
+                    const user = { role: 'participant', name: username, roomID: roomID };
+                    localStorage.setItem('user', JSON.stringify(user));
+                    window.location.href = '/room';
+                } else {
+                    // Alert the user about the error(s)
+                    if (!name_success && !room_success) {
+                        alert("Username is already taken and the room ID does not exist.");
+                    } else if (!name_success) {
+                        alert("Username is already taken.");
                     } else {
-                        // Alert the user about the error(s)
-                        if (!name_success && !room_success) {
-                            alert("Username is already taken and the room ID does not exist.");
-                        } else if (!name_success) {
-                            alert("Username is already taken.");
-                        } else {
-                            alert("Room ID does not exist.");
-                        }
+                        alert("Room ID does not exist.");
                     }
-                })
-                .catch(error => {
-                    console.error("Error during initiation:", error);
-                    alert("An error occurred. Please try again.");
-                });
-        }
-    } else {
-        alert("Please enter a name");
+                }
+            })
+            .catch(error => {
+                console.error("Error during initiation:", error);
+                alert("An error occurred. Please try again.");
+            });
     }
 });
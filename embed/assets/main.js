@@ -10,10 +10,14 @@ window.RTCSessionDescription = window.RTCSessionDescription || window.mozRTCSess
 let peerConnections = new Map();
 // { name -> connection }
 let dataChannels = new Map();
+// The trace context last received from each peer, sent back with our replies
+// so one offer/answer/candidate exchange shows up as a single trace.
+// { name -> trace }
+let traceContexts = new Map();
 
-// ICE server
+// ICE servers, from the configuration the server renders into the page
 const configuration = {
-    "iceServers": [{ "urls": "stun:stun.1.google.com:19302" }]
+    "iceServers": clientConfig.ice_servers
 };
 
 // DOM stuff for readability
@@ -30,13 +34,15 @@ let username;
 //let roomOwner;
 let roomID;
 let role;
+// Whether the server accepted the room initiation.
+let joined = false;
 
 // The array containing the participants of this room.
 let users = [];
 
 // Upon loading the page we need to check that the userItem passed from
 // the main page exists. If not, redirect back to main page.
-// If the userItem exists initialize the WebSocket and send the initiation message.
+// If the userItem exists connect to the server and send the initiation message.
 window.addEventListener('DOMContentLoaded', () => {
     const userItem = localStorage.getItem('user');
     if (!userItem) {
@@ -48,12 +54,25 @@ window.addEventListener('DOMContentLoaded', () => {
         role = user.role;
         username = user.name;
         roomID = user.roomID;
-        initializeWebSocket();
+        connect();
     }
 
-    initializeCanvasEvents();
+    applyFeatures();
+    if (clientConfig.features.drawing) {
+        initializeCanvasEvents();
+    }
 });
 
+// Hide the parts of the page whose feature is disabled in the server configuration.
+function applyFeatures() {
+    if (!clientConfig.features.chat) {
+        document.querySelector('.chat').style.display = 'none';
+    }
+    if (!clientConfig.features.drawing) {
+        document.querySelector('.canvas-container').style.display = 'none';
+    }
+}
+
 function generateRoomID(length) {
     const characters = 'ABCDEFGHIJKLMNOPQRSTUVWXYZ';
     let result = '';
@@ -66,16 +85,146 @@ function generateRoomID(length) {
   
 // Sends a message to the WebSocket, if it is open
 function send(message) {
+    if (message.name && traceContexts.has(message.name)) {
+        message.trace = traceContexts.get(message.name);
+    }
     if(socket && socket.readyState === WebSocket.OPEN) {
-        socket.send(JSON.stringify(message));
+        socket.send(JSON.stringify(toWire(message)));
+    }
+}
+
+// Wraps a message in the envelope of the negotiated protocol. The legacy protocol sends it as is.
+function toWire(message) {
+    if (socket.protocol !== "piirtul.v2") {
+        return message;
+    }
+    const { type, request_id, trace, ...data } = message;
+    const envelope = { v: 2, type: type, data: data };
+    if (request_id) envelope.id = request_id;
+    if (trace) envelope.trace = trace;
+    return envelope;
+}
+
+// Unwraps a message from the envelope of the negotiated protocol into the legacy shape,
+// so the handlers work the same with both protocols.
+function fromWire(frame) {
+    if (socket.protocol !== "piirtul.v2") {
+        return frame;
+    }
+    const message = Object.assign({}, frame.data, { type: frame.type });
+    if (frame.id) message.request_id = frame.id;
+    if (frame.trace) message.trace = frame.trace;
+    if (frame.ok !== undefined) message.success = frame.ok;
+    if (frame.error) {
+        message.error = frame.error.code;
+        message.message = frame.error.message;
+        if (frame.error.fields) message.fields = frame.error.fields;
+        if (frame.error.retry_after_ms) message.retry_after_ms = frame.error.retry_after_ms;
+    }
+    return message;
+}
+
+// Connect over WebTransport when both the server and the browser support it, otherwise over the WebSocket.
+function connect() {
+    if (clientConfig.webtransport_url && window.WebTransport) {
+        initializeWebTransport();
+    } else {
+        initializeWebSocket();
+    }
+}
+
+// Initialize the WebTransport session, with one bidirectional stream for the messages, each
+// prefixed with its length. The returned object has the parts of a WebSocket the page uses.
+// Falls back to the WebSocket when the session can't be established.
+async function initializeWebTransport() {
+    var webTransportURL = new URL(clientConfig.webtransport_url);
+    if (clientConfig.upgrade_token) {
+        webTransportURL.searchParams.set("token", clientConfig.upgrade_token);
+    }
+    // The page only speaks the JSON protocols.
+    const options = { protocols: (clientConfig.protocols || []).filter(protocol => protocol !== "piirtul.v2+msgpack") };
+    // A self-signed development certificate is trusted by its hash.
+    if (clientConfig.webtransport_cert_hashes) {
+        options.serverCertificateHashes = clientConfig.webtransport_cert_hashes.map(hash => ({
+            algorithm: "sha-256",
+            value: Uint8Array.from(atob(hash), c => c.charCodeAt(0)),
+        }));
+    }
+
+    let transport, stream;
+    try {
+        transport = new WebTransport(webTransportURL.toString(), options);
+        await transport.ready;
+        stream = await transport.createBidirectionalStream();
+    } catch (err) {
+        console.log("❓ WebTransport unavailable, falling back to the WebSocket:", err);
+        initializeWebSocket();
+        return;
+    }
+
+    const writer = stream.writable.getWriter();
+    const encoder = new TextEncoder();
+    socket = {
+        readyState: WebSocket.OPEN,
+        protocol: transport.protocol || "",
+        send(data) {
+            const payload = encoder.encode(data);
+            const frame = new Uint8Array(4 + payload.length);
+            new DataView(frame.buffer).setUint32(0, payload.length);
+            frame.set(payload, 4);
+            writer.write(frame).catch(err => console.log("❌ WebTransport write failed:", err));
+        },
+        close() {
+            this.readyState = WebSocket.CLOSED;
+            transport.close();
+        },
+    };
+    transport.closed.catch(err => console.log("❌ WebTransport error:", err)).finally(() => {
+        socket.readyState = WebSocket.CLOSED;
+    });
+
+    console.log("✅ Connected over WebTransport.");
+    initiateUser();
+    readWebTransportFrames(stream.readable);
+}
+
+// Reads the length prefixed frames of the stream and handles them like WebSocket messages.
+async function readWebTransportFrames(readable) {
+    const reader = readable.getReader();
+    const decoder = new TextDecoder();
+    let buffer = new Uint8Array(0);
+    for (;;) {
+        const { value, done } = await reader.read().catch(() => ({ done: true }));
+        if (done) {
+            return;
+        }
+        const joined = new Uint8Array(buffer.length + value.length);
+        joined.set(buffer);
+        joined.set(value, buffer.length);
+        buffer = joined;
+        while (buffer.length >= 4) {
+            const size = new DataView(buffer.buffer, buffer.byteOffset).getUint32(0);
+            if (buffer.length < 4 + size) {
+                break;
+            }
+            onSocketMessage({ data: decoder.decode(buffer.subarray(4, 4 + size)) });
+            buffer = buffer.slice(4 + size);
+        }
     }
 }
 
 // Initialize the WebSocket connection. After opening, send the initiation message.
+// If the WebSocket can't be opened, e.g. a proxy blocks it, the event stream is used instead.
 function initializeWebSocket() {
-    socket = new WebSocket('ws://localhost:9090/websocket');
+    var websocketURL = new URL(clientConfig.websocket_url);
+    if (clientConfig.upgrade_token) {
+        websocketURL.searchParams.set("token", clientConfig.upgrade_token);
+    }
+    let opened = false;
+    socket = new WebSocket(websocketURL.toString(), clientConfig.protocols || []);
     socket.onopen = () => {
         console.log("✅ Connected to WebSocket.");
+        opened = true;
         initiateUser();
     };
 
@@ -83,36 +232,103 @@ function initializeWebSocket() {
         console.log("❌ WebSocket error:", err);
     };
 
-    // Then we wait and listen for messages.
-    socket.onmessage = function(message) {
-        var data = JSON.parse(message.data);
-        switch(data.type) {
-            case "initiation":
-                onInitiationResponse(data.success);
-                break;
-            case "roomInitiation":
-                onRoomInitiationResponse(data.success, data.room_id, data.participants);
-                break;
-            case "offer":
-                onOfferResponse(data.offer, data.name);
-                break;
-            case "answer":
-                onAnswerResponse(data.answer, data.name);
-                break;
-            case "candidate":
-                onCandidateResponse(data.candidate, data.name);
-                break;
-            case "peerLeavingRoom":
-                onPeerLeaveResponse(data.name, data.room_destroy);
-                break;
-            case "leaveConfirmed":
-                leave();
-                break;
-            default:
-                console.log("Unknown message type:", data.type);
-                break;
+    socket.onclose = () => {
+        if (!opened && clientConfig.event_stream_url) {
+            console.log("❓ WebSocket unavailable, falling back to the event stream");
+            initializeEventStream();
         }
     };
+
+    socket.onmessage = onSocketMessage;
+}
+
+// Initialize the signaling over Server-Sent Events and posts. The returned object has the parts
+// of a WebSocket the page uses, so the rest of the page doesn't know the difference.
+function initializeEventStream() {
+    var eventStreamURL = new URL(clientConfig.event_stream_url);
+    if (clientConfig.upgrade_token) {
+        eventStreamURL.searchParams.set("token", clientConfig.upgrade_token);
+    }
+    (clientConfig.protocols || []).forEach(protocol => eventStreamURL.searchParams.append("protocol", protocol));
+
+    const events = new EventSource(eventStreamURL.toString());
+    // Posts are chained, so the messages arrive in the order they were sent.
+    let posted = Promise.resolve();
+    let session;
+    socket = {
+        readyState: WebSocket.CONNECTING,
+        protocol: "",
+        send(data) {
+            posted = posted.then(() => fetch(clientConfig.signal_url, {
+                method: "POST",
+                headers: { "Content-Type": "application/json", "X-Piirtul-Session": session },
+                body: data,
+            })).then(response => {
+                if (!response.ok) console.log("❌ Event stream post failed:", response.status);
+            }).catch(err => console.log("❌ Event stream post failed:", err));
+        },
+        close() {
+            this.readyState = WebSocket.CLOSED;
+            events.close();
+        },
+    };
+
+    events.addEventListener("session", (event) => {
+        const data = JSON.parse(event.data);
+        session = data.session;
+        socket.protocol = data.protocol;
+        socket.readyState = WebSocket.OPEN;
+        console.log("✅ Connected to the event stream.");
+        initiateUser();
+    });
+    events.addEventListener("goaway", () => socket.close());
+    // EventSource reconnects by itself, which would open a new session without the user.
+    events.onerror = (err) => {
+        console.log("❌ Event stream error:", err);
+        socket.close();
+    };
+    events.onmessage = onSocketMessage;
+}
+
+// Handles a message from the server. The message types are in /assets/protocol.d.ts.
+function onSocketMessage(message) {
+    /** @type {import("./protocol").ServerMessage} */
+    var data = fromWire(JSON.parse(message.data));
+    if (data.trace && data.name) {
+        traceContexts.set(data.name, data.trace);
+    }
+    switch(data.type) {
+        case "initiation":
+            onInitiationResponse(data.success, data.error);
+            break;
+        case "roomInitiation":
+            onRoomInitiationResponse(data.success, data.room_id, data.participants, data.error);
+            break;
+        case "offer":
+            onOfferResponse(data.offer, data.name);
+            break;
+        case "answer":
+            onAnswerResponse(data.answer, data.name);
+            break;
+        case "candidate":
+            onCandidateResponse(data.candidate, data.name);
+            break;
+        case "peerLeavingRoom":
+            onPeerLeaveResponse(data.name, data.room_destroy);
+            break;
+        case "leaveConfirmed":
+            leave();
+            break;
+        case "serverDraining":
+            onServerDraining(data.reconnect_after_ms);
+            break;
+        case "error":
+            onErrorResponse(data);
+            break;
+        default:
+            console.log("Unknown message type:", data.type);
+            break;
+    }
 }
 
 // Send the first message to the WebSocket. If room creator, send the initiation. 
@@ -123,8 +339,17 @@ function initiateUser() {
     send({type: 'initiation', name: username });
 }
 
+// Messages shown to the user for the error codes of the server, see /api/errors.
+const errorMessages = {
+    name_taken: "Username is already taken.",
+    server_full: "The server is full, please try again later.",
+    room_not_found: "Room ID does not exist.",
+    room_full: "The room is full.",
+    too_many_rooms: "The server has too many rooms, please try again later.",
+};
+
 // Handles the initiation response from the server.
-function onInitiationResponse(success) {
+function onInitiationResponse(success, error) {
     if (success === true) {
         console.log("✅ Initiation successful");
 
@@ -143,15 +368,16 @@ function onInitiationResponse(success) {
                 break;
         }
     } else {
-        alert('An error occured in initialization')
+        alert(errorMessages[error] || 'An error occured in initialization')
         window.location.href = '/'
     }
 }
 
 // Handles the room initiation response from the server. 
-function onRoomInitiationResponse(success, newRoomID, participants) {
+function onRoomInitiationResponse(success, newRoomID, participants, error) {
     if (success) {
         console.log("✅ Room initiation successful");
+        joined = true;
         roomID = newRoomID
         roomIDBanner.innerHTML += roomID;
 
@@ -180,8 +406,12 @@ function onRoomInitiationResponse(success, newRoomID, participants) {
                 
             });
         }
+    } else if (error === "room_exists" && role === "creator") {
+        // Another room got the random ID first, try another one.
+        roomID = generateRoomID(4);
+        send({ type: 'roomInitiation', room_id: roomID, name: username, role: 'creator' });
     } else {
-        alert("An error occured when joining the room.");
+        alert(errorMessages[error] || "An error occured when joining the room.");
         window.location.href = '/';
     }
 }
@@ -293,6 +523,35 @@ function onPeerLeaveResponse(name, destroyRoom) {
             peerConn.close();
             peerConnections.delete(name);
         }
+        traceContexts.delete(name);
+    }
+}
+
+// The server is shutting down. The peer connections keep working without it,
+// but nobody can join the room until the server is back.
+function onServerDraining(reconnectAfterMs) {
+    const seconds = Math.ceil(reconnectAfterMs / 1000);
+    console.log("❌ Server is shutting down, reconnect in " + seconds + " seconds");
+    displayRoomStatus("The server is restarting. New users can't join, please create a new room in " + seconds + " seconds.");
+}
+
+// Handles an error from the server. Rate limited messages are dropped by the server,
+// so the user is told to wait before trying again. Invalid messages list the invalid fields,
+// and the user can't go on when the initiations were invalid.
+function onErrorResponse(data) {
+    console.log("❌ Server error:", data.message);
+    if (data.error === "rate_limited") {
+        const seconds = Math.ceil(data.retry_after_ms / 1000);
+        displayRoomStatus("Too many messages, please wait " + seconds + " seconds and try again.");
+    } else if (data.error === "invalid_payload") {
+        const problems = (data.fields || []).map(field => "the " + field.field + " " + field.message);
+        const status = "The server rejected a message: " + (problems.join(", ") || data.message) + ".";
+        if (joined) {
+            displayRoomStatus(status);
+        } else {
+            alert(status);
+            window.location.href = '/';
+        }
     }
 }
 
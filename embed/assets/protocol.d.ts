@@ -0,0 +1,132 @@
+// Code generated by schemagen from the Go message structs. DO NOT EDIT.
+
+/** The message types of the signaling protocol. */
+export type MessageType = "initiation" | "roomInitiation" | "offer" | "answer" | "candidate" | "leaveRoom";
+
+/** The error codes of failed requests, see /api/errors. */
+export type ErrorCode = "name_taken" | "room_not_found" | "room_full" | "room_exists" | "too_many_rooms" | "server_full" | "peer_not_found" | "unauthorized" | "invalid_payload" | "unknown_type" | "unsupported_protocol" | "rate_limited" | "internal_error";
+
+/** Answer struct */
+export interface Answer {
+    type: string;
+    sdp: string;
+}
+
+/** Candidate struct */
+export interface Candidate {
+    candidate: string;
+    sdpMid: string;
+    sdpMLineIndex: number;
+    /** Browsers include the ICE username fragment when serializing a candidate. */
+    usernameFragment?: string;
+}
+
+/** The message sent to every client when the server starts draining. */
+export interface DrainingResponse {
+    type: string;
+    message: string;
+    /** How long the client should wait before reconnecting. */
+    reconnect_after_ms: number;
+}
+
+/** The envelope format of v2. Every frame has the version, the type and the request ID on the top level, the payload in data, and responses the outcome in ok and error: {"v": 2, "type": "roomInitiation", "id": "r1", "data": {"room_id": "ABCD", "role": "participant"}} {"v": 2, "type": "roomInitiation", "id": "r1", "ok": false, "error": {"code": "room_full", "message": "Room is full"}} */
+export interface Envelope {
+    v: number;
+    type: string;
+    id?: string;
+    ok?: boolean;
+    error?: EnvelopeError;
+    data?: unknown;
+    trace?: Record<string, string>;
+}
+
+/** The error of a failed request in the envelope format. */
+export interface EnvelopeError {
+    code: ErrorCode;
+    message?: string;
+    fields?: FieldError[];
+    retry_after_ms?: number;
+}
+
+/** A single invalid field of a socket message. */
+export interface FieldError {
+    field: string;
+    message: string;
+}
+
+/** A more specific struct for LeavingResponse */
+export interface LeavingResponse {
+    type: string;
+    name: string;
+    room_destroy: boolean;
+}
+
+/** Offer struct */
+export interface Offer {
+    type: string;
+    sdp: string;
+}
+
+/** The response sent when a client exceeds a limit, over HTTP as well as over the WebSocket. */
+export interface RateLimitedResponse {
+    type: string;
+    success: boolean;
+    error: ErrorCode;
+    message: string;
+    /** How long the client should wait before trying again. */
+    retry_after_ms: number;
+    request_id?: string;
+}
+
+/** A more spesific struct for Room Initiation response, sending also participants and the RoomID */
+export interface RoomSocketResponse {
+    type: string;
+    success: boolean;
+    room_id?: string;
+    participants?: string[];
+    error?: ErrorCode;
+    message?: string;
+    request_id?: string;
+}
+
+/** A struct for incoming socket messages. */
+export interface SocketMessage {
+    type: MessageType;
+    room_id?: string;
+    name?: string;
+    offer?: Offer;
+    answer?: Answer;
+    candidate?: Candidate;
+    role?: string;
+    /** W3C trace context of the sender, carried along with relayed messages. */
+    trace?: Record<string, string>;
+    /** An optional ID chosen by the client, echoed in the response to the message. */
+    request_id?: string;
+}
+
+/** A struct for default outgoing messages. */
+export interface SocketResponse {
+    type: string;
+    success: boolean;
+    /** The error code of a failed request, see /api/errors. */
+    error?: ErrorCode;
+    message?: string;
+    request_id?: string;
+}
+
+/** The response sent for a socket message that is malformed or not valid. */
+export interface ValidationErrorResponse {
+    type: string;
+    success: boolean;
+    error: ErrorCode;
+    message: string;
+    fields?: FieldError[];
+    /** The request ID of the invalid message, if it could be read. */
+    request_id?: string;
+}
+
+/** The messages a client sends. */
+export type ClientMessage = SocketMessage | Envelope;
+
+/** The messages the server sends. */
+export type ServerMessage = SocketResponse | RoomSocketResponse | LeavingResponse | ValidationErrorResponse | RateLimitedResponse | DrainingResponse | SocketMessage | Envelope;
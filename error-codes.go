@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+
+	"signaling/protocol"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The stable, machine-readable error codes of the socket protocol and the HTTP API, see protocol.
+const (
+	codeNameTaken           = protocol.CodeNameTaken
+	codeRoomNotFound        = protocol.CodeRoomNotFound
+	codeRoomFull            = protocol.CodeRoomFull
+	codeRoomExists          = protocol.CodeRoomExists
+	codeTooManyRooms        = protocol.CodeTooManyRooms
+	codeServerFull          = protocol.CodeServerFull
+	codePeerNotFound        = protocol.CodePeerNotFound
+	codeUnauthorized        = protocol.CodeUnauthorized
+	codeInvalidPayload      = protocol.CodeInvalidPayload
+	codeUnknownType         = protocol.CodeUnknownType
+	codeUnsupportedProtocol = protocol.CodeUnsupportedProtocol
+	codeRateLimited         = protocol.CodeRateLimited
+	codeInternal            = protocol.CodeInternal
+)
+
+// An entry of the error catalog.
+type ErrorCodeInfo struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	// Whether the same request may succeed later.
+	Retryable bool `json:"retryable"`
+}
+
+// Every error code a client may receive.
+var errorCatalog = []ErrorCodeInfo{
+	{codeNameTaken, "Another user on the server has the name.", false},
+	{codeRoomNotFound, "No room has the room ID.", false},
+	{codeRoomFull, "The room has the maximum number of users.", true},
+	{codeRoomExists, "A room with the room ID exists already, pick another ID.", false},
+	{codeTooManyRooms, "The server has the maximum number of rooms.", true},
+	{codeServerFull, "The server has the maximum number of users.", true},
+	{codePeerNotFound, "The receiver of a relayed message is not in the sender's room.", false},
+	{codeUnauthorized, "The request is not allowed in the current state, e.g. relaying before joining a room, or the upgrade token is missing.", false},
+	{codeInvalidPayload, "The message is malformed or invalid. The fields list tells which fields are wrong.", false},
+	{codeUnknownType, "The message type is not known.", false},
+	{codeUnsupportedProtocol, "None of the WebSocket subprotocols the client asked for is supported.", false},
+	{codeRateLimited, "The client is sending too fast. retry_after_ms tells when to try again.", true},
+	{codeInternal, "The server failed to handle the request.", true},
+}
+
+// A failed request, answered to the client with the error code and the message.
+type SocketError struct {
+	Code    string
+	Message string
+}
+
+// Creates a SocketError.
+func newSocketError(code, message string) *SocketError {
+	return &SocketError{Code: code, Message: message}
+}
+
+func (se *SocketError) Error() string {
+	return se.Code + ": " + se.Message
+}
+
+// A handler for the /api/errors endpoint that lists the error codes.
+func errorCatalogHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string][]ErrorCodeInfo{"errors": errorCatalog})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Parses the Go files matching the pattern, without the tests.
+func parseSources(t *testing.T, pattern string) []*ast.File {
+	t.Helper()
+	names, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// Returns the error codes the server code refers to, by the name of their constant.
+func referencedErrorCodes(t *testing.T) map[string]string {
+	t.Helper()
+	// The values of the protocol package constants, e.g. CodeRoomFull = "room_full".
+	values := map[string]string{}
+	for _, file := range parseSources(t, "protocol/*.go") {
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.ValueSpec)
+			if !ok || len(spec.Values) != len(spec.Names) {
+				return true
+			}
+			for i, name := range spec.Names {
+				if literal, ok := spec.Values[i].(*ast.BasicLit); ok && literal.Kind == token.STRING && strings.HasPrefix(name.Name, "Code") {
+					values[name.Name], _ = strconv.Unquote(literal.Value)
+				}
+			}
+			return true
+		})
+	}
+
+	files := parseSources(t, "*.go")
+	// The aliases of the server, e.g. codeRoomFull = protocol.CodeRoomFull.
+	aliases := map[string]string{}
+	declared := map[*ast.Ident]bool{}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.ValueSpec)
+			if !ok || len(spec.Values) != len(spec.Names) {
+				return true
+			}
+			for i, name := range spec.Names {
+				if selector, ok := spec.Values[i].(*ast.SelectorExpr); ok && strings.HasPrefix(name.Name, "code") {
+					aliases[name.Name] = values[selector.Sel.Name]
+					declared[name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	codes := map[string]string{}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok && !declared[ident] {
+				if value, ok := aliases[ident.Name]; ok {
+					codes[ident.Name] = value
+				}
+			}
+			return true
+		})
+	}
+	return codes
+}
+
+func TestErrorCatalog(t *testing.T) {
+	catalog := map[string]bool{}
+	for _, info := range errorCatalog {
+		if catalog[info.Code] || info.Code == "" || info.Description == "" {
+			t.Errorf("the catalog entry %+v is a duplicate or incomplete", info)
+		}
+		catalog[info.Code] = true
+	}
+
+	codes := referencedErrorCodes(t)
+	if len(codes) < len(errorCatalog) {
+		t.Errorf("found only the codes %v in the sources", codes)
+	}
+	for name, code := range codes {
+		if !catalog[code] {
+			t.Errorf("%s (%q) is returned but not in the catalog", name, code)
+		}
+	}
+
+	// The pages show their own messages for some codes, so the codes they know must stay stable.
+	scripts, err := filepath.Glob("embed/assets/*.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorMessages := regexp.MustCompile(`(?s)const errorMessages = \{(.*?)\}`)
+	for _, script := range scripts {
+		source, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var known []string
+		for _, match := range regexp.MustCompile(`\.error === "(\w+)"`).FindAllSubmatch(source, -1) {
+			known = append(known, string(match[1]))
+		}
+		if match := errorMessages.FindSubmatch(source); match != nil {
+			for _, key := range regexp.MustCompile(`(?m)^\s*(\w+):`).FindAllSubmatch(match[1], -1) {
+				known = append(known, string(key[1]))
+			}
+		}
+		for _, code := range known {
+			if !catalog[code] {
+				t.Errorf("%s handles %q, which is not in the catalog", filepath.Base(script), code)
+			}
+		}
+	}
+}
+
+func TestErrorCatalogHandler(t *testing.T) {
+	e, _ := newTestApp(t, nil)
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/errors", nil))
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("/api/errors answered %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	var response struct {
+		Errors []map[string]any `json:"errors"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Errors) != len(errorCatalog) {
+		t.Fatalf("/api/errors listed %d codes, want %d", len(response.Errors), len(errorCatalog))
+	}
+	for i, entry := range response.Errors {
+		keys := slices.Sorted(maps.Keys(entry))
+		want := errorCatalog[i]
+		if !slices.Equal(keys, []string{"code", "description", "retryable"}) || entry["code"] != want.Code || entry["description"] != want.Description || entry["retryable"] != want.Retryable {
+			t.Errorf("/api/errors listed %v, want %+v", entry, want)
+		}
+	}
+}
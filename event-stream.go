@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The header the client sends the event stream session token in when posting a message.
+const eventStreamSessionHeader = "X-Piirtul-Session"
+
+// How often a comment is sent on an idle event stream, so proxies don't time it out.
+const eventStreamKeepAlive = 20 * time.Second
+
+// A Transport for clients that can't open a WebSocket, e.g. behind proxies blocking the upgrade.
+// The server messages are sent as Server-Sent Events and the client messages are posted, each
+// post carrying the session token announced in the first event.
+type EventStreamTransport struct {
+	token      string
+	remoteAddr string
+	in         chan []byte
+	out        chan []byte
+	goAway     chan string
+	// Closed when the stream ends or the session is closed. closeErr tells ReadFrame why.
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// The first event of a stream, telling the client where its messages go.
+type eventStreamSession struct {
+	Session  string `json:"session"`
+	Protocol string `json:"protocol"`
+}
+
+// Creates an event stream transport with a new session token.
+func NewEventStreamTransport(remoteAddr string) (*EventStreamTransport, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	return &EventStreamTransport{
+		token:      base64.RawURLEncoding.EncodeToString(token),
+		remoteAddr: remoteAddr,
+		in:         make(chan []byte, 16),
+		out:        make(chan []byte, 64),
+		goAway:     make(chan string, 1),
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+func (t *EventStreamTransport) ReadFrame() ([]byte, error) {
+	// The messages posted before the close are still handled.
+	select {
+	case frame := <-t.in:
+		return frame, nil
+	default:
+	}
+	select {
+	case frame := <-t.in:
+		return frame, nil
+	case <-t.closed:
+		return nil, t.closeErr
+	}
+}
+
+// Queues a frame for the stream. Event streams are text, so only the JSON protocols are spoken.
+func (t *EventStreamTransport) WriteFrame(frameType int, frame []byte) error {
+	select {
+	case t.out <- frame:
+		return nil
+	case <-t.closed:
+		return errors.New("write to a closed event stream")
+	}
+}
+
+// Sends a goaway event and ends the stream.
+func (t *EventStreamTransport) GoAway(reason string) error {
+	select {
+	case t.goAway <- reason:
+	default:
+	}
+	return nil
+}
+
+func (t *EventStreamTransport) Close() error {
+	t.close(errClientClosed)
+	return nil
+}
+
+func (t *EventStreamTransport) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+// Closes the transport, making ReadFrame return the error.
+func (t *EventStreamTransport) close(err error) {
+	t.closeOnce.Do(func() {
+		t.closeErr = err
+		close(t.closed)
+	})
+}
+
+// Hands a posted message to ReadFrame. Returns false if the session has been closed.
+func (t *EventStreamTransport) post(frame []byte, cancel <-chan struct{}) bool {
+	select {
+	case t.in <- frame:
+		return true
+	case <-t.closed:
+		return false
+	case <-cancel:
+		return false
+	}
+}
+
+// Writes the frames to the stream until the transport is closed or the client goes away.
+func (t *EventStreamTransport) stream(w *echo.Response, done <-chan struct{}) {
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case frame := <-t.out:
+			err = writeEvent(w, "", frame)
+		case reason := <-t.goAway:
+			// The frames queued before, like the draining notice, go first.
+			for len(t.out) > 0 && err == nil {
+				err = writeEvent(w, "", <-t.out)
+			}
+			if err == nil {
+				err = writeEvent(w, "goaway", []byte(reason))
+			}
+			if err != nil {
+				t.close(fmt.Errorf("%w: %w", errConnectionLost, err))
+				return
+			}
+			w.Flush()
+			t.close(errClientClosed)
+			return
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		case <-t.closed:
+			return
+		case <-done:
+			// There is no close handshake, the client leaving the page ends the request.
+			t.close(errClientClosed)
+			return
+		}
+		if err != nil {
+			t.close(fmt.Errorf("%w: %w", errConnectionLost, err))
+			return
+		}
+		w.Flush()
+	}
+}
+
+// Writes an event, splitting the data on the lines since an event line can't hold a newline.
+func writeEvent(w io.Writer, event string, data []byte) error {
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// A handler for /signal/events that opens a session streaming the server messages. The protocol
+// query parameters are the protocol versions the client speaks, like the WebSocket subprotocols.
+func (ss *SignalingServer) EventStreamHandler(c echo.Context) error {
+	request := c.Request()
+	if !ss.upgrader.CheckOrigin(request) {
+		return echo.NewHTTPError(http.StatusForbidden, "origin not allowed")
+	}
+	protocol := ""
+	if requested := c.QueryParams()["protocol"]; len(requested) > 0 {
+		// MessagePack needs binary frames, the events are text.
+		requested = slices.DeleteFunc(slices.Clone(requested), func(name string) bool { return name == protocolV2MsgPack })
+		protocol = negotiateProtocol(requested)
+		if protocol == "" {
+			response := SocketResponse{Type: "error", Success: false, Error: codeUnsupportedProtocol, Message: "Supported protocols: " + strings.Join([]string{protocolV2, protocolV1}, ", ")}
+			return c.JSON(http.StatusBadRequest, response)
+		}
+	}
+
+	transport, err := NewEventStreamTransport(request.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	ss.addEventStream(transport)
+	defer ss.removeEventStream(transport)
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// Keeps nginx from buffering the events.
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+
+	session := NewSession(transport, protocolAdapter(protocol))
+	first, err := json.Marshal(eventStreamSession{Session: transport.token, Protocol: session.protocol.Name()})
+	if err != nil {
+		return err
+	}
+	if err := writeEvent(response, "session", first); err != nil {
+		return nil
+	}
+	response.Flush()
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		ss.Serve(request.Context(), session)
+	}()
+	transport.stream(response, request.Context().Done())
+	// Serve sends the leave confirmation of a closed session, so it must be done before the request is.
+	<-served
+	return nil
+}
+
+// A handler for POST /signal that hands a message to the session of an event stream. The messages
+// are answered on the stream, the response only tells whether the message was accepted.
+func (ss *SignalingServer) EventStreamPostHandler(c echo.Context) error {
+	transport := ss.eventStream(c.Request().Header.Get(eventStreamSessionHeader))
+	if transport == nil {
+		response := SocketResponse{Type: "error", Success: false, Error: codeUnauthorized, Message: "The signaling session does not exist or has ended"}
+		return c.JSON(http.StatusNotFound, response)
+	}
+
+	body := c.Request().Body
+	if ss.limits.MaxMessageSize > 0 {
+		body = http.MaxBytesReader(c.Response(), body, ss.limits.MaxMessageSize)
+	}
+	frame, err := io.ReadAll(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			// Like a WebSocket frame over the read limit, the message ends the session.
+			transport.close(fmt.Errorf("%w: %w", errFrameTooLarge, err))
+			return c.NoContent(http.StatusRequestEntityTooLarge)
+		}
+		return err
+	}
+	if !transport.post(frame, c.Request().Context().Done()) {
+		return c.NoContent(http.StatusGone)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (ss *SignalingServer) addEventStream(transport *EventStreamTransport) {
+	ss.eventStreamMux.Lock()
+	defer ss.eventStreamMux.Unlock()
+
+	if ss.eventStreams == nil {
+		ss.eventStreams = make(map[string]*EventStreamTransport)
+	}
+	ss.eventStreams[transport.token] = transport
+}
+
+func (ss *SignalingServer) removeEventStream(transport *EventStreamTransport) {
+	ss.eventStreamMux.Lock()
+	defer ss.eventStreamMux.Unlock()
+
+	delete(ss.eventStreams, transport.token)
+}
+
+// Returns the event stream of the session token, or nil.
+func (ss *SignalingServer) eventStream(token string) *EventStreamTransport {
+	ss.eventStreamMux.Lock()
+	defer ss.eventStreamMux.Unlock()
+
+	return ss.eventStreams[token]
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// A client signaling over an event stream and posts, speaking the legacy protocol.
+type eventStreamClient struct {
+	t         *testing.T
+	signalURL string
+	session   string
+	// The events after the session event, closed when the stream ends.
+	events chan serverEvent
+}
+
+// An event of the stream.
+type serverEvent struct {
+	event string
+	data  string
+}
+
+// Opens an event stream on the server and waits for its session.
+func connectEventStream(t *testing.T, serverURL string) *eventStreamClient {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, serverURL+"/signal/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return openEventStream(t, http.DefaultClient, request, serverURL)
+}
+
+// Opens the event stream of the request with the client and waits for its session.
+func openEventStream(t *testing.T, client *http.Client, request *http.Request, serverURL string) *eventStreamClient {
+	t.Helper()
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("the event stream answered %s %s", response.Status, response.Header.Get("Content-Type"))
+	}
+
+	events := make(chan serverEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(response.Body)
+		var event serverEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				events <- event
+				event = serverEvent{}
+			case strings.HasPrefix(line, "event: "):
+				event.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data += strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	c := &eventStreamClient{t: t, signalURL: serverURL + "/signal", events: events}
+	first := c.next()
+	var session eventStreamSession
+	if err := json.Unmarshal([]byte(first.data), &session); first.event != "session" || err != nil {
+		t.Fatalf("the first event is %v, want the session", first)
+	}
+	if session.Protocol != protocolV1 {
+		t.Errorf("the session speaks %s, want %s", session.Protocol, protocolV1)
+	}
+	c.session = session.Session
+	return c
+}
+
+// Posts a raw message and returns the status of the response.
+func (c *eventStreamClient) post(body []byte) int {
+	c.t.Helper()
+	request, err := http.NewRequest(http.MethodPost, c.signalURL, bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	request.Header.Set(eventStreamSessionHeader, c.session)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func (c *eventStreamClient) send(message SocketMessage) {
+	c.t.Helper()
+	frame, err := json.Marshal(message)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if status := c.post(frame); status != http.StatusAccepted {
+		c.t.Fatalf("posting %s answered %d", message.Type, status)
+	}
+}
+
+// Returns the next event of the stream.
+func (c *eventStreamClient) next() serverEvent {
+	c.t.Helper()
+	select {
+	case event, ok := <-c.events:
+		if !ok {
+			c.t.Fatal("the event stream ended")
+		}
+		return event
+	case <-time.After(testTimeout):
+		c.t.Fatal("no event from the server")
+	}
+	return serverEvent{}
+}
+
+// Returns the next message from the server, decoded in a map.
+func (c *eventStreamClient) receive() map[string]any {
+	c.t.Helper()
+	event := c.next()
+	var message map[string]any
+	if err := json.Unmarshal([]byte(event.data), &message); err != nil {
+		c.t.Fatalf("event %v: %v", event, err)
+	}
+	return message
+}
+
+// Returns the next message from a WebSocket, decoded in a map.
+func receiveWebSocket(t *testing.T, ws *websocket.Conn) map[string]any {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(testTimeout))
+	var message map[string]any
+	if err := ws.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestEventStreamMixedRoom(t *testing.T) {
+	e, ss := newTestApp(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false"})
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	alice, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	bob := connectEventStream(t, server.URL)
+
+	alice.WriteJSON(SocketMessage{Type: "initiation", Name: "alice"})
+	receiveWebSocket(t, alice)
+	alice.WriteJSON(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"})
+	receiveWebSocket(t, alice)
+
+	bob.send(SocketMessage{Type: "initiation", Name: "bob", RequestID: "1"})
+	if got := bob.receive(); got["success"] != true || got["request_id"] != "1" {
+		t.Errorf("bob's initiation answered %v", got)
+	}
+	bob.send(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"})
+	if got := bob.receive(); got["success"] != true {
+		t.Errorf("bob's room initiation answered %v", got)
+	}
+
+	bob.send(SocketMessage{Type: "offer", Name: "alice", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}})
+	if got := receiveWebSocket(t, alice); got["type"] != "offer" || got["name"] != "bob" {
+		t.Errorf("alice received %v, want an offer from bob", got)
+	}
+	alice.WriteJSON(SocketMessage{Type: "answer", Name: "bob", Answer: &Answer{Type: "answer", Sdp: benchmarkSDP}})
+	if got := bob.receive(); got["type"] != "answer" || got["name"] != "alice" {
+		t.Errorf("bob received %v, want an answer from alice", got)
+	}
+
+	alice.Close()
+	if got := bob.receive(); got["type"] != "peerLeavingRoom" || got["room_destroy"] != true {
+		t.Errorf("bob received %v, want alice leaving and destroying the room", got)
+	}
+	eventually(t, func() bool { return ss.ConnCount() == 1 }, "alice's session is left after closing")
+}
+
+func TestEventStreamPosts(t *testing.T) {
+	e, ss := newTestApp(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false", "PIIRTUL_MAX_MESSAGE_SIZE": "1024"})
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	unknown := &eventStreamClient{t: t, signalURL: server.URL + "/signal", session: "nope"}
+	if status := unknown.post([]byte(`{"type":"initiation","name":"alice"}`)); status != http.StatusNotFound {
+		t.Errorf("posting to an unknown session answered %d, want %d", status, http.StatusNotFound)
+	}
+
+	alice := connectEventStream(t, server.URL)
+	alice.send(SocketMessage{Type: "initiation", Name: "alice"})
+	alice.receive()
+	if status := alice.post(bytes.Repeat([]byte("a"), 2048)); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("posting a message over the limit answered %d, want %d", status, http.StatusRequestEntityTooLarge)
+	}
+	eventually(t, func() bool { return ss.UserCount() == 0 && ss.ConnCount() == 0 }, "the session is left after a message over the limit")
+	if status := alice.post([]byte(`{"type":"leaveRoom"}`)); status != http.StatusNotFound {
+		t.Errorf("posting to an ended session answered %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestEventStreamPostLimit(t *testing.T) {
+	e, _ := newTestApp(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false", "PIIRTUL_SIGNAL_RATE_LIMIT": "1/3"})
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	// Guessed session tokens count against the limit of the address like the valid ones.
+	guesser := &eventStreamClient{t: t, signalURL: server.URL + "/signal", session: "nope"}
+	for i, want := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests} {
+		if status := guesser.post([]byte(`{"type":"leaveRoom"}`)); status != want {
+			t.Errorf("post %d answered %d, want %d", i+1, status, want)
+		}
+	}
+}
+
+func TestEventStreamFromBrowser(t *testing.T) {
+	e, _ := newTestApp(t, nil)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	browser := &http.Client{Jar: jar}
+
+	// Fetches the client configuration like the room page does.
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/api/client-config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Origin", server.URL)
+	response, err := browser.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config ClientConfig
+	err = json.NewDecoder(response.Body).Decode(&config)
+	response.Body.Close()
+	if err != nil || config.UpgradeToken == "" {
+		t.Fatalf("the client configuration has no upgrade token: %v", err)
+	}
+
+	eventsURL := server.URL + "/signal/events?" + url.Values{upgradeTokenParam: {config.UpgradeToken}}.Encode()
+	streamRequest := func() *http.Request {
+		request, err := http.NewRequest(http.MethodGet, eventsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Origin", server.URL)
+		return request
+	}
+	alice := openEventStream(t, browser, streamRequest(), server.URL)
+	alice.send(SocketMessage{Type: "initiation", Name: "alice"})
+	if got := alice.receive(); got["success"] != true {
+		t.Errorf("alice's initiation answered %v", got)
+	}
+
+	// Another site's page could get a token, but not the cookie of the browser.
+	response, err = http.DefaultClient.Do(streamRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("an event stream without the cookie answered %s, want %d", response.Status, http.StatusForbidden)
+	}
+}
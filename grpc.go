@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"signaling/signalingpb"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// The metadata the gRPC clients send: the upgrade token with the Signal stream, and the session
+// token of the stream with the unary calls.
+const (
+	grpcTokenMetadata   = "x-piirtul-token"
+	grpcSessionMetadata = "x-piirtul-session"
+)
+
+// The protocol spoken on the Signal stream: the v2 envelope, protobuf encoded. It is not
+// negotiated, since the stream speaks nothing else.
+const protocolV2Protobuf = protocolV2 + "+protobuf"
+
+// The type of the first message of a Signal stream.
+const grpcTypeSession = "session"
+
+// The first message of a Signal stream, telling the client the token of its unary calls.
+type grpcSessionMessage struct {
+	Type    string `json:"type"`
+	Session string `json:"session"`
+}
+
+// The v2 envelope in the protobuf messages of signalingpb.
+type protobufProtocol struct{}
+
+func (protobufProtocol) Name() string {
+	return protocolV2Protobuf
+}
+
+func (protobufProtocol) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (protobufProtocol) Decode(raw []byte) (SocketMessage, error) {
+	var client signalingpb.ClientMessage
+	if err := proto.Unmarshal(raw, &client); err != nil {
+		return SocketMessage{}, err
+	}
+	message := SocketMessage{Type: client.GetType(), RequestID: client.GetId(), Trace: client.GetTrace()}
+	if data := client.GetData(); data != nil {
+		message.Name, message.RoomID, message.Role = data.GetName(), data.GetRoomId(), data.GetRole()
+		if offer := data.GetOffer(); offer != nil {
+			message.Offer = &Offer{Type: offer.GetType(), Sdp: offer.GetSdp()}
+		}
+		if answer := data.GetAnswer(); answer != nil {
+			message.Answer = &Answer{Type: answer.GetType(), Sdp: answer.GetSdp()}
+		}
+		if candidate := data.GetCandidate(); candidate != nil {
+			message.Candidate = &Candidate{
+				Candidate:        candidate.GetCandidate(),
+				SdpMid:           candidate.GetSdpMid(),
+				SdpMLineIndex:    int(candidate.GetSdpMLineIndex()),
+				UsernameFragment: candidate.GetUsernameFragment(),
+			}
+		}
+	}
+	return message, nil
+}
+
+// Encodes the envelope of the message. The payload goes through JSON, whose field names the
+// server payload shares, so every response struct maps to it without a conversion of its own.
+func (protobufProtocol) Encode(message any) ([]byte, error) {
+	envelope, err := newEnvelope(message)
+	if err != nil {
+		return nil, err
+	}
+	server := &signalingpb.ServerMessage{Type: envelope.Type, Id: envelope.ID, Ok: envelope.OK, Trace: envelope.Trace}
+	if envelope.Error != nil {
+		server.Error = newProtobufError(envelope.Error.Code, envelope.Error.Message)
+		server.Error.RetryAfterMs = envelope.Error.RetryAfterMs
+		for _, field := range envelope.Error.Fields {
+			server.Error.Fields = append(server.Error.Fields, &signalingpb.FieldError{Field: field.Field, Message: field.Message})
+		}
+	}
+	if envelope.Data != nil {
+		data, err := json.Marshal(envelope.Data)
+		if err != nil {
+			return nil, err
+		}
+		server.Data = &signalingpb.ServerPayload{}
+		if err := protojson.Unmarshal(data, server.Data); err != nil {
+			return nil, fmt.Errorf("encoding the payload of %s: %w", envelope.Type, err)
+		}
+	}
+	return proto.Marshal(server)
+}
+
+func newProtobufError(code, message string) *signalingpb.Error {
+	return &signalingpb.Error{Code: code, Message: message}
+}
+
+// A Transport over the Signal stream of a gRPC client. The stream is read by a goroutine of its
+// own, so that closing the transport ends ReadFrame even while the client is silent.
+type GRPCTransport struct {
+	stream     grpc.BidiStreamingServer[signalingpb.ClientMessage, signalingpb.ServerMessage]
+	token      string
+	remoteAddr string
+	in         chan []byte
+	// Closed when the stream ends or the transport is closed. closeErr tells ReadFrame why.
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	// The reason the server went away, if it did.
+	goAwayReason string
+	// Guards the stream, which may not be written once the handler has returned.
+	writeMux sync.Mutex
+	finished bool
+}
+
+// Creates a transport for the stream with a new session token.
+func NewGRPCTransport(stream grpc.BidiStreamingServer[signalingpb.ClientMessage, signalingpb.ServerMessage], remoteAddr string) (*GRPCTransport, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	return &GRPCTransport{
+		stream:     stream,
+		token:      base64.RawURLEncoding.EncodeToString(token),
+		remoteAddr: remoteAddr,
+		in:         make(chan []byte, 16),
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// Reads the stream until it ends, handing the messages to ReadFrame.
+func (t *GRPCTransport) receive() {
+	for {
+		message, err := t.stream.Recv()
+		if err != nil {
+			t.close(recvError(err))
+			return
+		}
+		// The session decodes frames, so the message is encoded once more.
+		frame, err := proto.Marshal(message)
+		if err != nil {
+			t.close(err)
+			return
+		}
+		select {
+		case t.in <- frame:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// Maps the errors of an ended stream to the transport errors.
+func recvError(err error) error {
+	switch {
+	// The client closed its side of the stream
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: %w", errClientClosed, err)
+	// The client cancelled the call, or the handler has returned
+	case status.Code(err) == codes.Canceled:
+		return fmt.Errorf("%w: %w", errClientClosed, err)
+	// The message was over the receive limit of the server
+	case status.Code(err) == codes.ResourceExhausted:
+		return fmt.Errorf("%w: %w", errFrameTooLarge, err)
+	}
+	return fmt.Errorf("%w: %w", errConnectionLost, err)
+}
+
+func (t *GRPCTransport) ReadFrame() ([]byte, error) {
+	// The messages received before the close are still handled.
+	select {
+	case frame := <-t.in:
+		return frame, nil
+	default:
+	}
+	select {
+	case frame := <-t.in:
+		return frame, nil
+	case <-t.closed:
+		return nil, t.closeErr
+	}
+}
+
+func (t *GRPCTransport) WriteFrame(frameType int, frame []byte) error {
+	var message signalingpb.ServerMessage
+	if err := proto.Unmarshal(frame, &message); err != nil {
+		return err
+	}
+
+	t.writeMux.Lock()
+	defer t.writeMux.Unlock()
+
+	if t.finished {
+		return errors.New("write to an ended Signal stream")
+	}
+	return t.stream.Send(&message)
+}
+
+// Ends the stream, which the client sees as the Unavailable status with the reason.
+func (t *GRPCTransport) GoAway(reason string) error {
+	t.closeOnce.Do(func() {
+		t.goAwayReason = reason
+		t.closeErr = errClientClosed
+		close(t.closed)
+	})
+	return nil
+}
+
+func (t *GRPCTransport) Close() error {
+	t.close(errClientClosed)
+	return nil
+}
+
+func (t *GRPCTransport) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+// Closes the transport, making ReadFrame return the error.
+func (t *GRPCTransport) close(err error) {
+	t.closeOnce.Do(func() {
+		t.closeErr = err
+		close(t.closed)
+	})
+}
+
+// Marks the stream as ended once the handler returns. Returns the status the handler ends the
+// stream with.
+func (t *GRPCTransport) finish() error {
+	t.writeMux.Lock()
+	t.finished = true
+	t.writeMux.Unlock()
+
+	<-t.closed
+	if t.goAwayReason != "" {
+		return status.Error(codes.Unavailable, t.goAwayReason)
+	}
+	if errors.Is(t.closeErr, errFrameTooLarge) {
+		return status.Error(codes.ResourceExhausted, "message over the size limit")
+	}
+	return nil
+}
+
+// The checks the Signal streams pass like the WebSocket upgrades, and the limit of the unary
+// calls. They share their limits with the HTTP routes. Nil checks are disabled.
+type grpcChecks struct {
+	tokens         *UpgradeTokens
+	upgradeLimiter *IPRateLimiter
+	connLimiter    *ConnLimiter
+	callLimiter    *IPRateLimiter
+}
+
+// Serves the gRPC API of signalingpb. The Signal streams are sessions of the signaling server, so
+// their users are in the same rooms as the users of the other transports.
+type GRPCServer struct {
+	signalingpb.UnimplementedSignalingServer
+	server        *grpc.Server
+	ss            *SignalingServer
+	checks        grpcChecks
+	logger        *slog.Logger
+	listenAddress string
+	// Reloads the configured certificate. Nil when TLS is disabled.
+	reloader       *certReloader
+	reloadInterval time.Duration
+	// The sessions of the Signal streams by their session token.
+	sessions   map[string]*Session
+	sessionMux sync.Mutex
+}
+
+// Creates a gRPC server for the signaling server. It is served with the TLS certificate of the
+// HTTP server when TLS is enabled, otherwise in plain text.
+func NewGRPCServer(config *Config, ss *SignalingServer, checks grpcChecks, logger *slog.Logger) (*GRPCServer, error) {
+	gs := &GRPCServer{
+		ss:             ss,
+		checks:         checks,
+		logger:         logger,
+		listenAddress:  config.GRPC.ListenAddress,
+		reloadInterval: config.TLS.ReloadInterval,
+		sessions:       make(map[string]*Session),
+	}
+	// Zero means unlimited, unlike in gRPC.
+	maxMessageSize := math.MaxInt32
+	if size := config.Limits.MaxMessageSize; size > 0 && size < math.MaxInt32 {
+		maxMessageSize = int(size)
+	}
+	options := []grpc.ServerOption{grpc.MaxRecvMsgSize(maxMessageSize), grpc.UnaryInterceptor(gs.limitCalls)}
+	if config.TLSEnabled() {
+		if config.TLS.SelfSigned {
+			if _, err := ensureSelfSignedCert(config.TLS.CertFile, config.TLS.KeyFile, config.selfSignedHosts()); err != nil {
+				return nil, err
+			}
+		}
+		reloader, err := newCertReloader(config.TLS.CertFile, config.TLS.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		gs.reloader = reloader
+		options = append(options, grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
+	}
+	gs.server = grpc.NewServer(options...)
+	signalingpb.RegisterSignalingServer(gs.server, gs)
+	return gs, nil
+}
+
+// Listens on the TCP address of the configuration and serves until Close.
+func (gs *GRPCServer) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", gs.listenAddress)
+	if err != nil {
+		return err
+	}
+	return gs.Serve(ctx, listener)
+}
+
+// Serves on the listener until Close.
+func (gs *GRPCServer) Serve(ctx context.Context, listener net.Listener) error {
+	if gs.reloader != nil {
+		go gs.reloader.Watch(ctx, gs.reloadInterval)
+	}
+	return gs.server.Serve(listener)
+}
+
+// Closes the connections and stops serving. The streams have been drained with the other sessions.
+func (gs *GRPCServer) Close() {
+	gs.server.Stop()
+}
+
+// Serves a Signal stream as a session of the signaling server.
+func (gs *GRPCServer) Signal(stream grpc.BidiStreamingServer[signalingpb.ClientMessage, signalingpb.ServerMessage]) error {
+	ctx := stream.Context()
+	remoteAddr := grpcRemoteAddr(ctx)
+	ip, _, _ := net.SplitHostPort(remoteAddr)
+	if gs.ss.Draining() {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	if limiter := gs.checks.upgradeLimiter; limiter != nil {
+		if ok, retryAfter := limiter.Allow(ip); !ok {
+			gs.ss.metrics.rateLimited.WithLabelValues("upgrade").Inc()
+			return grpcRateLimitedError("Too many requests, slow down", retryAfter)
+		}
+	}
+	if limiter := gs.checks.connLimiter; limiter != nil {
+		if !limiter.Acquire(ip) {
+			gs.ss.metrics.rateLimited.WithLabelValues("connections").Inc()
+			gs.logger.Warn("Rejected a connection over the per address limit", logKeyRemoteAddr, ip)
+			return grpcRateLimitedError("Too many connections from your address", time.Second)
+		}
+		defer limiter.Release(ip)
+	}
+	if tokens := gs.checks.tokens; tokens != nil {
+		if err := tokens.Verify(metadataValue(ctx, grpcTokenMetadata), time.Now()); err != nil {
+			gs.logger.Warn("Rejected Signal stream", logKeyError, err, logKeyRemoteAddr, remoteAddr)
+			return grpcError(codes.Unauthenticated, codeUnauthorized, err.Error())
+		}
+	}
+
+	transport, err := NewGRPCTransport(stream, remoteAddr)
+	if err != nil {
+		return err
+	}
+	session := NewSession(transport, protobufProtocol{})
+	gs.addSession(transport.token, session)
+	defer gs.removeSession(transport.token)
+	if err := session.Send(grpcSessionMessage{Type: grpcTypeSession, Session: transport.token}); err != nil {
+		return err
+	}
+
+	go transport.receive()
+	// Serve logs how the session ended, the status only tells the client when the server ended it.
+	gs.ss.Serve(ctx, session)
+	return transport.finish()
+}
+
+// Creates a room owned by the user of the session.
+func (gs *GRPCServer) CreateRoom(ctx context.Context, request *signalingpb.CreateRoomRequest) (*signalingpb.Room, error) {
+	session, user, err := gs.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ve := &ValidationError{}
+	validateRoomID(ve, "room_id", request.GetRoomId())
+	if ve.err() != nil {
+		return nil, grpcValidationError(ve)
+	}
+
+	_, err = gs.ss.rooms.Create(user, request.GetRoomId())
+	if errors.Is(err, errTooManyRooms) {
+		return nil, grpcError(codes.ResourceExhausted, codeTooManyRooms, "Too many rooms")
+	}
+	if errors.Is(err, errRoomExists) {
+		return nil, grpcError(codes.AlreadyExists, codeRoomExists, "A room with the given ID exists already")
+	}
+	if errors.Is(err, errUserInRoom) {
+		return nil, grpcError(codes.FailedPrecondition, codeUnauthorized, "Leave the room first")
+	}
+	if err != nil {
+		return nil, grpcError(codes.Internal, codeInternal, "Failed to create room")
+	}
+	gs.ss.sessionLogger(session).Info("Room created", logKeyRoom, request.GetRoomId())
+	return &signalingpb.Room{RoomId: request.GetRoomId(), Owner: user.Name, Size: 1}, nil
+}
+
+// Gets the room of the caller.
+func (gs *GRPCServer) GetRoom(ctx context.Context, request *signalingpb.GetRoomRequest) (*signalingpb.Room, error) {
+	_, user, err := gs.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	room, err := gs.room(request.GetRoomId())
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(room.Users, user) {
+		return nil, grpcError(codes.PermissionDenied, codeUnauthorized, "Join the room first")
+	}
+	response := &signalingpb.Room{RoomId: room.ID, Size: int32(len(room.Users))}
+	if room.Owner != nil {
+		response.Owner = room.Owner.Name
+	}
+	return response, nil
+}
+
+// Lists the users of the room of the caller.
+func (gs *GRPCServer) ListParticipants(ctx context.Context, request *signalingpb.ListParticipantsRequest) (*signalingpb.ListParticipantsResponse, error) {
+	_, user, err := gs.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	room, err := gs.room(request.GetRoomId())
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(room.Users, user) {
+		return nil, grpcError(codes.PermissionDenied, codeUnauthorized, "Join the room first")
+	}
+	response := &signalingpb.ListParticipantsResponse{}
+	for _, roomUser := range room.Users {
+		response.Participants = append(response.Participants, roomUser.Name)
+	}
+	return response, nil
+}
+
+// Returns the session of the session token in the metadata of the call and its user.
+func (gs *GRPCServer) caller(ctx context.Context) (*Session, *User, error) {
+	session := gs.session(metadataValue(ctx, grpcSessionMetadata))
+	if session == nil {
+		return nil, nil, grpcError(codes.Unauthenticated, codeUnauthorized, "The signaling session does not exist or has ended")
+	}
+	user := gs.ss.UserFromSession(session)
+	if user == nil {
+		return nil, nil, grpcError(codes.FailedPrecondition, codeUnauthorized, "Initiate the user first")
+	}
+	return session, user, nil
+}
+
+// Returns a snapshot of the room, whose user list may be read without holding the lock.
+func (gs *GRPCServer) room(roomID string) (Room, error) {
+	rooms, err := gs.ss.rooms.List()
+	if err != nil {
+		return Room{}, grpcError(codes.Internal, codeInternal, "Failed to list rooms")
+	}
+	for _, room := range rooms {
+		if room.ID == roomID {
+			return room, nil
+		}
+	}
+	return Room{}, grpcError(codes.NotFound, codeRoomNotFound, "Room not found")
+}
+
+// An interceptor that rejects the unary calls while the server drains and limits their rate for
+// every client address, with the limit of /initiate, which answers the same questions.
+func (gs *GRPCServer) limitCalls(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if gs.ss.Draining() {
+		return nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
+	if limiter := gs.checks.callLimiter; limiter != nil {
+		ip, _, _ := net.SplitHostPort(grpcRemoteAddr(ctx))
+		if ok, retryAfter := limiter.Allow(ip); !ok {
+			gs.ss.metrics.rateLimited.WithLabelValues("initiate").Inc()
+			gs.logger.Debug("Rate limited a request", "limit", "initiate", logKeyRemoteAddr, ip)
+			return nil, grpcRateLimitedError("Too many requests, slow down", retryAfter)
+		}
+	}
+	return handler(ctx, request)
+}
+
+func (gs *GRPCServer) addSession(token string, session *Session) {
+	gs.sessionMux.Lock()
+	defer gs.sessionMux.Unlock()
+
+	gs.sessions[token] = session
+}
+
+func (gs *GRPCServer) removeSession(token string) {
+	gs.sessionMux.Lock()
+	defer gs.sessionMux.Unlock()
+
+	delete(gs.sessions, token)
+}
+
+// Returns the session of the session token, or nil.
+func (gs *GRPCServer) session(token string) *Session {
+	gs.sessionMux.Lock()
+	defer gs.sessionMux.Unlock()
+
+	return gs.sessions[token]
+}
+
+// Returns the address of the client of the call.
+func grpcRemoteAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// Returns the first value of the metadata key of the call, or an empty string.
+func metadataValue(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Returns the status of a failed call, with the error code of the protocol in its details.
+func grpcError(c codes.Code, code, message string) error {
+	return grpcErrorWithDetails(c, newProtobufError(code, message))
+}
+
+func grpcValidationError(ve *ValidationError) error {
+	details := newProtobufError(codeInvalidPayload, "Invalid message")
+	for _, field := range ve.Fields {
+		details.Fields = append(details.Fields, &signalingpb.FieldError{Field: field.Field, Message: field.Message})
+	}
+	return grpcErrorWithDetails(codes.InvalidArgument, details)
+}
+
+func grpcRateLimitedError(message string, retryAfter time.Duration) error {
+	details := newProtobufError(codeRateLimited, message)
+	details.RetryAfterMs = retryAfter.Milliseconds()
+	return grpcErrorWithDetails(codes.ResourceExhausted, details)
+}
+
+func grpcErrorWithDetails(c codes.Code, details *signalingpb.Error) error {
+	st, err := status.New(c, details.GetMessage()).WithDetails(details)
+	if err != nil {
+		return status.Error(c, details.GetMessage())
+	}
+	return st.Err()
+}
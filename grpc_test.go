@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"signaling/signalingpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Starts the app with gRPC enabled and returns a client connected to it.
+func newGRPCServer(t *testing.T, env map[string]string) (*SignalingServer, signalingpb.SignalingClient) {
+	t.Helper()
+	env["PIIRTUL_GRPC_LISTEN_ADDRESS"] = "127.0.0.1:0"
+	config, err := LoadConfig(nil, func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ss, _, gs, err := newApp(&config, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go gs.Serve(context.Background(), listener)
+	t.Cleanup(gs.Close)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ss, signalingpb.NewSignalingClient(conn)
+}
+
+// A client of a Signal stream.
+type grpcClient struct {
+	t      *testing.T
+	stream grpc.BidiStreamingClient[signalingpb.ClientMessage, signalingpb.ServerMessage]
+	// The context of the unary calls, carrying the session token.
+	ctx context.Context
+}
+
+// Opens a Signal stream and waits for its session.
+func connectGRPC(t *testing.T, client signalingpb.SignalingClient) *grpcClient {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stream, err := client.Signal(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &grpcClient{t: t, stream: stream}
+	first := c.receive()
+	if first.GetType() != grpcTypeSession || first.GetData().GetSession() == "" {
+		t.Fatalf("the first message is %v, want the session", first)
+	}
+	c.ctx = metadata.AppendToOutgoingContext(requestContext(t), grpcSessionMetadata, first.GetData().GetSession())
+	return c
+}
+
+func (c *grpcClient) send(message *signalingpb.ClientMessage) {
+	c.t.Helper()
+	if err := c.stream.Send(message); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Returns the next message from the server.
+func (c *grpcClient) receive() *signalingpb.ServerMessage {
+	c.t.Helper()
+	message, err := c.stream.Recv()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return message
+}
+
+// Returns the error code in the details of the status of a failed call.
+func grpcErrorCode(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if details, ok := detail.(*signalingpb.Error); ok {
+			return details.GetCode()
+		}
+	}
+	return ""
+}
+
+func TestGRPCMixedRoom(t *testing.T) {
+	ss, client := newGRPCServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false"})
+	alice := connectGRPC(t, client)
+	bob := connectMemory(t, ss, "bob")
+
+	alice.send(&signalingpb.ClientMessage{Type: "initiation", Id: "1", Data: &signalingpb.Payload{Name: "alice"}})
+	if got := alice.receive(); !got.GetOk() || got.GetId() != "1" {
+		t.Errorf("alice's initiation answered %v", got)
+	}
+	room, err := client.CreateRoom(alice.ctx, &signalingpb.CreateRoomRequest{RoomId: "ROOM"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.GetOwner() != "alice" || room.GetSize() != 1 {
+		t.Errorf("created the room %v, want one owned by alice", room)
+	}
+	_, err = client.CreateRoom(alice.ctx, &signalingpb.CreateRoomRequest{RoomId: "OTHER"})
+	if status.Code(err) != codes.FailedPrecondition || grpcErrorCode(err) != codeUnauthorized {
+		t.Errorf("creating a second room failed with %v, want %s", err, codeUnauthorized)
+	}
+
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	bob.send(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"})
+	if got := bob.receive(); got["success"] != true || !slices.Equal(got["participants"].([]any), []any{"alice"}) {
+		t.Errorf("bob's room initiation answered %v, want alice as the participant", got)
+	}
+	if room, err := client.GetRoom(alice.ctx, &signalingpb.GetRoomRequest{RoomId: "ROOM"}); err != nil || room.GetSize() != 2 {
+		t.Errorf("got the room %v, %v, want two users", room, err)
+	}
+	listed, err := client.ListParticipants(alice.ctx, &signalingpb.ListParticipantsRequest{RoomId: "ROOM"})
+	if err != nil || !slices.Equal(listed.GetParticipants(), []string{"alice", "bob"}) {
+		t.Errorf("listed the participants %v, %v, want alice and bob", listed.GetParticipants(), err)
+	}
+
+	bob.send(SocketMessage{Type: "offer", Name: "alice", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}})
+	if got := alice.receive(); got.GetType() != "offer" || got.GetData().GetName() != "bob" || got.GetData().GetOffer().GetSdp() != benchmarkSDP {
+		t.Errorf("alice received %v, want an offer from bob", got)
+	}
+	alice.send(&signalingpb.ClientMessage{Type: "answer", Data: &signalingpb.Payload{Name: "bob", Answer: &signalingpb.SessionDescription{Type: "answer", Sdp: benchmarkSDP}}})
+	if got := bob.receive(); got["type"] != "answer" || got["name"] != "alice" {
+		t.Errorf("bob received %v, want an answer from alice", got)
+	}
+
+	alice.stream.CloseSend()
+	if got := bob.receive(); got["type"] != "peerLeavingRoom" || got["room_destroy"] != true {
+		t.Errorf("bob received %v, want alice leaving and destroying the room", got)
+	}
+	eventually(t, func() bool { return ss.UserCount() == 1 && ss.ConnCount() == 1 }, "alice's user and session are left after closing")
+}
+
+func TestGRPCErrors(t *testing.T) {
+	ss, client := newGRPCServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false", "PIIRTUL_MAX_MESSAGE_SIZE": "1024"})
+
+	_, err := client.GetRoom(requestContext(t), &signalingpb.GetRoomRequest{RoomId: "ROOM"})
+	if status.Code(err) != codes.Unauthenticated || grpcErrorCode(err) != codeUnauthorized {
+		t.Errorf("a call without a session failed with %v, want %s", err, codeUnauthorized)
+	}
+	alice := connectGRPC(t, client)
+	_, err = client.CreateRoom(alice.ctx, &signalingpb.CreateRoomRequest{RoomId: "ROOM"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("creating a room before the initiation failed with %v, want %s", err, codes.FailedPrecondition)
+	}
+
+	alice.send(&signalingpb.ClientMessage{Type: "initiation", Data: &signalingpb.Payload{Name: "alice"}})
+	alice.receive()
+	alice.send(&signalingpb.ClientMessage{Type: "offer", Id: "2", Data: &signalingpb.Payload{Name: "bob"}})
+	if got := alice.receive(); got.GetOk() || got.GetId() != "2" || got.GetError().GetCode() != codeInvalidPayload || len(got.GetError().GetFields()) == 0 {
+		t.Errorf("an offer without the offer answered %v, want %s with the fields", got, codeInvalidPayload)
+	}
+	_, err = client.CreateRoom(alice.ctx, &signalingpb.CreateRoomRequest{RoomId: "room"})
+	if status.Code(err) != codes.InvalidArgument || grpcErrorCode(err) != codeInvalidPayload {
+		t.Errorf("creating a room with an invalid ID failed with %v, want %s", err, codeInvalidPayload)
+	}
+	_, err = client.ListParticipants(alice.ctx, &signalingpb.ListParticipantsRequest{RoomId: "NOPE"})
+	if status.Code(err) != codes.NotFound || grpcErrorCode(err) != codeRoomNotFound {
+		t.Errorf("listing a missing room failed with %v, want %s", err, codeRoomNotFound)
+	}
+
+	bob := connectMemory(t, ss, "bob")
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "creator"}, map[string]any{"success": true})
+	_, err = client.ListParticipants(alice.ctx, &signalingpb.ListParticipantsRequest{RoomId: "ROOM"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("listing the participants of another room failed with %v, want %s", err, codes.PermissionDenied)
+	}
+	_, err = client.GetRoom(alice.ctx, &signalingpb.GetRoomRequest{RoomId: "ROOM"})
+	if status.Code(err) != codes.PermissionDenied || grpcErrorCode(err) != codeUnauthorized {
+		t.Errorf("getting another room failed with %v, want %s", err, codes.PermissionDenied)
+	}
+	_, err = client.CreateRoom(alice.ctx, &signalingpb.CreateRoomRequest{RoomId: "ROOM"})
+	if status.Code(err) != codes.AlreadyExists || grpcErrorCode(err) != codeRoomExists {
+		t.Errorf("creating a taken room failed with %v, want %s", err, codeRoomExists)
+	}
+
+	alice.send(&signalingpb.ClientMessage{Type: "initiation", Data: &signalingpb.Payload{Name: strings.Repeat("a", 2048)}})
+	if _, err := alice.stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("a message over the limit ended the stream with %v, want %s", err, codes.ResourceExhausted)
+	}
+	eventually(t, func() bool { return ss.UserCount() == 1 && ss.ConnCount() == 1 }, "alice's user and session are left after the message over the limit")
+}
+
+func TestGRPCConcurrentCreateRoom(t *testing.T) {
+	ss, client := newGRPCServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false"})
+	alice := connectGRPC(t, client)
+	alice.send(&signalingpb.ClientMessage{Type: "initiation", Data: &signalingpb.Payload{Name: "alice"}})
+	alice.receive()
+
+	errs := make(chan error)
+	for i := range 10 {
+		go func() {
+			_, err := client.CreateRoom(alice.ctx, &signalingpb.CreateRoomRequest{RoomId: fmt.Sprintf("ROOM%d", i)})
+			errs <- err
+		}()
+	}
+	created := 0
+	for range 10 {
+		err := <-errs
+		if err == nil {
+			created++
+		} else if status.Code(err) != codes.FailedPrecondition || grpcErrorCode(err) != codeUnauthorized {
+			t.Errorf("a concurrent creation failed with %v, want %s", err, codeUnauthorized)
+		}
+	}
+	if rooms, _ := ss.rooms.List(); created != 1 || len(rooms) != 1 {
+		t.Errorf("concurrent calls created %d rooms and left %d, want one", created, len(rooms))
+	}
+}
+
+func TestGRPCUpgradeToken(t *testing.T) {
+	_, client := newGRPCServer(t, map[string]string{})
+	stream, err := client.Signal(requestContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated || grpcErrorCode(err) != codeUnauthorized {
+		t.Errorf("a stream without a token ended with %v, want %s", err, codeUnauthorized)
+	}
+}
+
+func TestGRPCDrain(t *testing.T) {
+	ss, client := newGRPCServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false"})
+	alice := connectGRPC(t, client)
+
+	go ss.Drain(context.Background(), 0)
+	if got := alice.receive(); got.GetType() != "serverDraining" {
+		t.Errorf("alice received %v, want the draining notice", got)
+	}
+	_, err := alice.stream.Recv()
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("the stream ended with %v, want %s", err, codes.Unavailable)
+	}
+	stream, err := client.Signal(requestContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("a stream opened while draining ended with %v, want %s", err, codes.Unavailable)
+	}
+	if _, err := client.GetRoom(requestContext(t), &signalingpb.GetRoomRequest{RoomId: "ROOM"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("a call while draining failed with %v, want %s", err, codes.Unavailable)
+	}
+}
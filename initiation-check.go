@@ -4,15 +4,42 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// A handler for the /initiate endpoint to validate a username and room ID.
+// A handler for the /initiate endpoint to validate a username and room ID. Names and room IDs
+// breaking the rules of the socket messages are answered with invalid_payload.
 func initiateHandler(roomService *RoomService, signalingServer *SignalingServer) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request().Context(), propagation.HeaderCarrier(c.Request().Header))
+		_, span := signalingServer.tracer.Start(ctx, "GET /initiate", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
 		// Extract the 'name' and 'roomID' query parameters.
 		name := c.QueryParam("name")
 		roomID := c.QueryParam("roomID")
 
+		ve := &ValidationError{}
+		if name == "" {
+			ve.add("name", "is required")
+		} else {
+			validateName(ve, "name", name)
+		}
+		if roomID == "" {
+			ve.add("roomID", "is required")
+		} else {
+			validateRoomID(ve, "roomID", roomID)
+		}
+		if err := ve.err(); err != nil {
+			span.SetAttributes(attribute.Bool("piirtul.invalid", true))
+			response := newValidationErrorResponse(err, "")
+			response.Message = "Invalid name or room ID"
+			return c.JSON(http.StatusBadRequest, response)
+		}
+
 		// Initialize the response with default success values.
 		response := map[string]bool{
 			"name_success": true,
@@ -30,6 +57,11 @@ func initiateHandler(roomService *RoomService, signalingServer *SignalingServer)
 			response["room_success"] = false
 		}
 
+		span.SetAttributes(
+			attribute.Bool("piirtul.name_success", response["name_success"]),
+			attribute.Bool("piirtul.room_success", response["room_success"]),
+		)
+
 		// Return both name and room success statuses.
 		return c.JSON(http.StatusOK, response)
 	}
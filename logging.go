@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// The attribute keys used in the structured logs.
+const (
+	logKeyRoom       = "room"
+	logKeyUser       = "user"
+	logKeyPeer       = "peer"
+	logKeyRemoteAddr = "remote_addr"
+	logKeyType       = "type"
+	logKeyError      = "error"
+)
+
+// The attributes that contain personal data and are redacted when redaction is enabled.
+var redactedLogKeys = map[string]bool{
+	logKeyUser:       true,
+	logKeyPeer:       true,
+	logKeyRemoteAddr: true,
+}
+
+// Options for the structured logger.
+type LogOptions struct {
+	// Either "text" or "json".
+	Format string     `yaml:"format"`
+	Level  slog.Level `yaml:"level"`
+	// Replaces user names and addresses with a short keyed hash, so log lines can still be correlated.
+	Redact bool `yaml:"redact"`
+	// The key of the redaction hash. Set it to correlate the logs across restarts and instances.
+	// A random key is used when empty.
+	RedactKey string `yaml:"redact_key"`
+}
+
+// Creates a new structured logger writing to w.
+func NewLogger(w io.Writer, options LogOptions) *slog.Logger {
+	handlerOptions := &slog.HandlerOptions{Level: options.Level}
+	if options.Redact {
+		key := []byte(options.RedactKey)
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			// Read never fails, see crypto/rand.
+			rand.Read(key)
+		}
+		handlerOptions.ReplaceAttr = redactAttr(key)
+	}
+
+	if options.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, handlerOptions))
+	}
+	return slog.New(slog.NewTextHandler(w, handlerOptions))
+}
+
+// Returns a ReplaceAttr function that replaces the value of personal data attributes with its hash.
+func redactAttr(key []byte) func(groups []string, attr slog.Attr) slog.Attr {
+	return func(groups []string, attr slog.Attr) slog.Attr {
+		if !redactedLogKeys[attr.Key] {
+			return attr
+		}
+		return slog.String(attr.Key, redact(key, attr.Value.String()))
+	}
+}
+
+// Returns a short HMAC of the value. Being keyed, short values like addresses and names can't be
+// recovered by hashing every candidate. Empty values stay empty.
+func redact(key []byte, value string) string {
+	if value == "" {
+		return value
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return "redacted:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Returns a logger with the remote address of the session and, once initiated, the name of its user.
+func (ss *SignalingServer) sessionLogger(session *Session) *slog.Logger {
+	logger := ss.logger.With(logKeyRemoteAddr, session.RemoteAddr())
+	if user := ss.UserFromSession(session); user != nil {
+		logger = logger.With(logKeyUser, user.Name)
+	}
+	return logger
+}
+
+// Returns a middleware that logs every HTTP request with the structured logger. Only the path is
+// logged, since the query of /initiate contains the user name.
+func requestLogger(logger *slog.Logger) echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:   true,
+		LogURIPath:  true,
+		LogStatus:   true,
+		LogRemoteIP: true,
+		LogLatency:  true,
+		LogError:    true,
+		HandleError: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("path", v.URIPath),
+				slog.Int("status", v.Status),
+				slog.String(logKeyRemoteAddr, v.RemoteIP),
+				slog.Duration("latency", v.Latency),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String(logKeyError, v.Error.Error()))
+				logger.LogAttrs(context.Background(), slog.LevelError, "Request failed", attrs...)
+				return nil
+			}
+			logger.LogAttrs(context.Background(), slog.LevelInfo, "Request", attrs...)
+			return nil
+		},
+	})
+}
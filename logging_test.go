@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRedactedLogs(t *testing.T) {
+	log := func(options LogOptions) string {
+		var buf bytes.Buffer
+		NewLogger(&buf, options).Info("User initialized", logKeyUser, "alice", logKeyRemoteAddr, "10.0.0.1:5000", logKeyRoom, "ROOM")
+		return buf.String()
+	}
+
+	line := log(LogOptions{Format: "text", Redact: true})
+	if strings.Contains(line, "alice") || strings.Contains(line, "10.0.0.1") || !strings.Contains(line, "room=ROOM") {
+		t.Errorf("logged %q, want the user and the address redacted and the room kept", line)
+	}
+	if line == log(LogOptions{Format: "text", Redact: true}) {
+		t.Error("two loggers without a key redacted the same way, want a random key each")
+	}
+	keyed := LogOptions{Format: "text", Redact: true, RedactKey: "key"}
+	first, second := log(keyed), log(keyed)
+	if strings.Contains(first, "alice") || first[strings.Index(first, "user="):] != second[strings.Index(second, "user="):] {
+		t.Errorf("logged %q and %q with the same key, want the same redacted values", first, second)
+	}
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"embed"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
 )
 
 type Template struct {
@@ -30,47 +41,258 @@ func staticRender(template string) echo.HandlerFunc {
 //go:embed embed/*
 var embededFiles embed.FS
 
+// How long the HTTP servers get to shut down after the connections have been drained.
+const shutdownTimeout = 5 * time.Second
+
 func main() {
+	config, err := LoadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		slog.Error("Invalid configuration", logKeyError, err)
+		os.Exit(2)
+	}
+	logger := NewLogger(os.Stderr, config.Log)
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		logger.Error("Failed to set up tracing", logKeyError, err)
+		os.Exit(1)
+	}
+
+	e, ss, wt, gs, err := newApp(&config, logger)
+	if err != nil {
+		logger.Error("Failed to set up the server", logKeyError, err)
+		os.Exit(1)
+	}
+
+	// The server drains on SIGINT and SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 3)
+	go func() {
+		logger.Info("Server starting", "address", config.ListenAddress, "tls", config.tlsDescription())
+		if config.TLSEnabled() {
+			serverErr <- startTLS(ctx, e, &config, logger)
+		} else {
+			serverErr <- e.Start(config.ListenAddress)
+		}
+	}()
+	if wt != nil {
+		go func() {
+			logger.Info("WebTransport starting", "address", config.WebTransport.ListenAddress)
+			serverErr <- wt.ListenAndServe(ctx)
+		}()
+	}
+	if gs != nil {
+		go func() {
+			logger.Info("gRPC starting", "address", config.GRPC.ListenAddress)
+			serverErr <- gs.ListenAndServe(ctx)
+		}()
+	}
+
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+		// Restore the default behaviour, so a second signal stops the server immediately.
+		stop()
+		logger.Info("Shutting down")
+		ss.Drain(context.Background(), config.Shutdown.GracePeriod)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err = e.Shutdown(shutdownCtx)
+		cancel()
+		if wt != nil {
+			wt.Close()
+		}
+		if gs != nil {
+			gs.Close()
+		}
+	}
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("Failed to flush traces", logKeyError, err)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Server stopped", logKeyError, err)
+		os.Exit(1)
+	}
+	logger.Info("Server stopped")
+}
+
+// Creates the echo app with the routes and the signaling server behind them, the WebTransport
+// server serving the app over HTTP/3 and the gRPC server, when they are enabled.
+func newApp(config *Config, logger *slog.Logger) (*echo.Echo, *SignalingServer, *WebTransportServer, *GRPCServer, error) {
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
 
 	viewFiles, err := fs.Sub(embededFiles, "embed/views")
 	if err != nil {
-		log.Fatalf("failed to open filesystem views: %s", err.Error())
+		return nil, nil, nil, nil, fmt.Errorf("opening the views: %w", err)
 	}
 	e.Renderer = &Template{
 		templates: template.Must(template.ParseFS(viewFiles, "*.html")),
 	}
 
-	e.Use(middleware.Logger())
+	originChecker, err := NewOriginChecker(config.AllowedOrigins, logger)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("invalid allowed origins: %w", err)
+	}
+	// Upgrade tokens are only minted when they are required.
+	var upgradeTokens *UpgradeTokens
+	if config.WebSocket.RequireToken {
+		upgradeTokens, err = NewUpgradeTokens(config.WebSocket.TokenSecret, config.WebSocket.TokenTTL, config.TLSEnabled())
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("setting up the upgrade tokens: %w", err)
+		}
+	}
+
+	// The client address is used by the rate limits.
+	if config.RateLimits.TrustForwardedFor {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	e.Use(requestLogger(logger))
 	e.Use(middleware.Secure())
 	e.Use(middleware.RemoveTrailingSlash())
 
-	ss := SignalingServer{
+	ss := &SignalingServer{
 		users: []*User{},
 		rooms: &RoomService{
-			DB: &RoomSlice{
-				rooms: make([]*Room, 0),
-			},
+			DB: config.NewRoomDatabase(),
 		},
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+			ReadBufferSize:  config.WebSocket.ReadBufferSize,
+			WriteBufferSize: config.WebSocket.WriteBufferSize,
+			CheckOrigin:     originChecker.Check,
 		},
+		activity: NewActivityMonitor(),
+		logger:   logger,
+		tracer:   otel.Tracer(tracerName),
+		limits:   config.Limits,
+		policy:   config.Policy,
+	}
+	ss.metrics = NewMetrics(ss)
+	ss.router = ss.newMessageRouter()
+	// Each connection gets its own buckets of these limits.
+	ss.messageLimits = ss.router.Limits(config.RateLimits.Messages)
+
+	// WebTransport is served over HTTP/3 by the same app.
+	var wt *WebTransportServer
+	if config.WebTransport.ListenAddress != "" {
+		wt, err = NewWebTransportServer(config, e, ss, originChecker.Check, logger)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("setting up WebTransport: %w", err)
+		}
 	}
 
 	resourcesFiles, err := fs.Sub(embededFiles, "embed/assets")
 	if err != nil {
-		log.Fatalf("failed to open filesystem assets: %s", err.Error())
+		return nil, nil, nil, nil, fmt.Errorf("opening the assets: %w", err)
 	}
 	e.GET("/assets/*", echo.WrapHandler(http.StripPrefix("/assets/", http.FileServer(http.FS(resourcesFiles)))))
 
 	e.GET("/", staticRender("landing"))
-	e.GET("/initiate", initiateHandler(ss.rooms, &ss))
-	e.GET("/room", staticRender("main"))
-	e.GET("/websocket", ss.Handler)
+	// New rooms and connections are rejected while the server is draining.
+	drainGuard := ss.rejectWhileDraining(config.Shutdown.GracePeriod)
+	// The limits are shared by the HTTP routes and the gRPC calls.
+	var checks grpcChecks
+	initiateMiddleware := []echo.MiddlewareFunc{drainGuard}
+	if limit := config.RateLimits.Initiate; limit.Enabled() {
+		checks.callLimiter = NewIPRateLimiter(limit)
+		initiateMiddleware = append(initiateMiddleware, ss.rateLimit("initiate", checks.callLimiter))
+	}
+	e.GET("/initiate", initiateHandler(ss.rooms, ss), initiateMiddleware...)
+	e.GET("/room", clientConfigRender("main", config, upgradeTokens, wt))
+	e.GET("/api/client-config", clientConfigHandler(config, upgradeTokens, wt))
+	e.GET("/api/errors", errorCatalogHandler)
+	e.GET("/api/schema", schemaHandler)
+	websocketMiddleware := []echo.MiddlewareFunc{drainGuard}
+	if limit := config.RateLimits.Upgrade; limit.Enabled() {
+		checks.upgradeLimiter = NewIPRateLimiter(limit)
+		websocketMiddleware = append(websocketMiddleware, ss.rateLimit("upgrade", checks.upgradeLimiter))
+	}
+	if config.RateLimits.MaxConnectionsPerIP > 0 {
+		checks.connLimiter = NewConnLimiter(config.RateLimits.MaxConnectionsPerIP)
+		websocketMiddleware = append(websocketMiddleware, ss.limitConnections(checks.connLimiter))
+	}
+	if upgradeTokens != nil {
+		checks.tokens = upgradeTokens
+		websocketMiddleware = append(websocketMiddleware, upgradeTokens.Guard(logger))
+	}
+	e.GET("/websocket", ss.Handler, websocketMiddleware...)
+	// The fallback for clients that can't open a WebSocket, guarded the same way.
+	e.GET("/signal/events", ss.EventStreamHandler, websocketMiddleware...)
+	// Every message of an event stream is a post, so the posts have a limit of their own, above the
+	// per connection limits of the messages.
+	var signalMiddleware []echo.MiddlewareFunc
+	if limit := config.RateLimits.Signal; limit.Enabled() {
+		signalMiddleware = append(signalMiddleware, ss.rateLimit("signal", NewIPRateLimiter(limit)))
+	}
+	e.POST("/signal", ss.EventStreamPostHandler, signalMiddleware...)
+	if wt != nil {
+		e.CONNECT("/webtransport", wt.Handler, websocketMiddleware...)
+	}
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(ss.metrics.Registry, promhttp.HandlerOpts{})))
+
+	// The admin dashboard publishes every room and user, so it is only served behind basic auth.
+	if password := config.Admin.Password; password != "" {
+		admin := e.Group("/admin")
+		admin.Use(middleware.BasicAuth(func(username, pass string, c echo.Context) (bool, error) {
+			validUser := subtle.ConstantTimeCompare([]byte(username), []byte("admin")) == 1
+			validPass := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+			return validUser && validPass, nil
+		}))
+		admin.GET("", staticRender("admin"))
+		admin.GET("/events", ss.AdminEventsHandler)
+	} else {
+		logger.Info("Admin dashboard disabled, set admin.password to enable it")
+	}
+
+	var gs *GRPCServer
+	if config.GRPC.ListenAddress != "" {
+		gs, err = NewGRPCServer(config, ss, checks, logger)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("setting up gRPC: %w", err)
+		}
+	}
+	return e, ss, wt, gs, nil
+}
+
+// Serves HTTPS with a certificate that is reloaded on SIGHUP and when its files change.
+// Plain HTTP is redirected to HTTPS when a redirect address is configured.
+func startTLS(ctx context.Context, e *echo.Echo, config *Config, logger *slog.Logger) error {
+	if config.TLS.SelfSigned {
+		generated, err := ensureSelfSignedCert(config.TLS.CertFile, config.TLS.KeyFile, config.selfSignedHosts())
+		if err != nil {
+			return err
+		}
+		if generated {
+			logger.Info("Generated a self-signed certificate", "cert_file", config.TLS.CertFile, "hosts", config.selfSignedHosts())
+		}
+	}
+
+	reloader, err := newCertReloader(config.TLS.CertFile, config.TLS.KeyFile, logger)
+	if err != nil {
+		return err
+	}
+	go reloader.Watch(ctx, config.TLS.ReloadInterval)
+
+	if config.TLS.RedirectAddress != "" {
+		go func() {
+			logger.Info("Redirecting plain HTTP to HTTPS", "address", config.TLS.RedirectAddress)
+			err := http.ListenAndServe(config.TLS.RedirectAddress, httpsRedirectHandler(config))
+			logger.Error("HTTPS redirect stopped", logKeyError, err)
+		}()
+	}
 
-	e.Logger.Fatal(e.Start("localhost:8080"))
+	e.TLSServer.Addr = config.ListenAddress
+	e.TLSServer.TLSConfig = reloader.TLSConfig()
+	return e.StartServer(e.TLSServer)
 }
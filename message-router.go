@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"signaling/protocol"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Who may send a message type.
+type Access int
+
+const (
+	// Anyone with an open connection.
+	accessAnyone Access = iota
+	// Connections that have not sent their initiation yet.
+	accessNewSession
+	// Users that have sent their initiation.
+	accessUser
+	// Users that are not in a room.
+	accessUserNotInRoom
+	// Users in a room.
+	accessRoomMember
+	// The owner of the room the user is in.
+	accessRoomOwner
+)
+
+// A registered message type and the handler for it.
+type Route struct {
+	Type string
+	// The payload fields the message type requires. Any other payload fields are rejected.
+	Fields []string
+	Access Access
+	// The per connection limit of the message type, used when the configuration has none for it.
+	RateLimit RateLimit
+	Handler   func(ss *SignalingServer, ctx context.Context, session *Session, message SocketMessage) error
+}
+
+// The message types of the signaling protocol.
+var messageRoutes = []Route{
+	{Type: protocol.TypeInitiation, Fields: []string{"name"}, Access: accessNewSession, Handler: (*SignalingServer).initiationEvent},
+	{Type: protocol.TypeRoomInitiation, Fields: []string{"name", "room_id", "role"}, Access: accessUserNotInRoom, Handler: (*SignalingServer).roomInitiationEvent},
+	{Type: protocol.TypeOffer, Fields: []string{"name", "offer"}, Access: accessRoomMember, Handler: (*SignalingServer).offerConnectionEvent},
+	{Type: protocol.TypeAnswer, Fields: []string{"name", "answer"}, Access: accessRoomMember, Handler: (*SignalingServer).answerConnectionEvent},
+	{Type: protocol.TypeCandidate, Fields: []string{"name", "candidate"}, Access: accessRoomMember, Handler: (*SignalingServer).candidateExchangingEvent},
+	{Type: protocol.TypeLeaveRoom, Fields: []string{}, Access: accessUser, Handler: (*SignalingServer).leaveRoomEvent},
+}
+
+// Returns whether the message type is one of the messageRoutes.
+func isMessageType(messageType string) bool {
+	for _, route := range messageRoutes {
+		if route.Type == messageType {
+			return true
+		}
+	}
+	return false
+}
+
+// A message being dispatched, passed along the middleware chain.
+type Dispatch struct {
+	Session *Session
+	Message SocketMessage
+	// The route of the message type, nil for unknown types.
+	Route *Route
+	// The message type used in metrics and logs. Unknown types are labelled as unknown
+	// so that clients can't blow up the metric cardinality.
+	Label   string
+	Limiter *MessageLimiter
+	Logger  *slog.Logger
+}
+
+// Handles a dispatched message.
+type MessageHandler func(ctx context.Context, dispatch *Dispatch) error
+
+// Wraps a message handler, e.g. to log or authorize the dispatch.
+type MessageMiddleware func(next MessageHandler) MessageHandler
+
+// Routes socket messages to the handlers of their types through a chain of middlewares.
+type MessageRouter struct {
+	routes      map[string]*Route
+	middlewares []MessageMiddleware
+	handler     MessageHandler
+}
+
+// Creates a MessageRouter with the routes. The handler is called at the end of the middleware chain.
+func NewMessageRouter(handler MessageHandler, routes ...Route) *MessageRouter {
+	router := &MessageRouter{routes: make(map[string]*Route), handler: handler}
+	for _, route := range routes {
+		router.Handle(route)
+	}
+	return router
+}
+
+// Registers the route of a message type. Registering a type twice is a programming error and panics.
+func (mr *MessageRouter) Handle(route Route) {
+	if _, ok := mr.routes[route.Type]; ok {
+		panic("message type registered twice: " + route.Type)
+	}
+	mr.routes[route.Type] = &route
+}
+
+// Appends middlewares to the chain. The first middleware is the outermost.
+func (mr *MessageRouter) Use(middlewares ...MessageMiddleware) {
+	mr.middlewares = append(mr.middlewares, middlewares...)
+}
+
+// Returns the route of a message type, or nil if the type is not registered.
+func (mr *MessageRouter) Route(messageType string) *Route {
+	return mr.routes[messageType]
+}
+
+// Returns the label used for a message type in metrics and on the dashboard.
+func (mr *MessageRouter) Label(messageType string) string {
+	if _, ok := mr.routes[messageType]; ok {
+		return messageType
+	}
+	return "unknown"
+}
+
+// Returns the per connection limits by message type: the configured ones, and the limits of the
+// routes the configuration has none for.
+func (mr *MessageRouter) Limits(configured map[string]RateLimit) map[string]RateLimit {
+	limits := make(map[string]RateLimit, len(configured))
+	for messageType, route := range mr.routes {
+		if route.RateLimit.Enabled() {
+			limits[messageType] = route.RateLimit
+		}
+	}
+	for messageType, limit := range configured {
+		limits[messageType] = limit
+	}
+	return limits
+}
+
+// Passes the message through the middleware chain to the handler.
+func (mr *MessageRouter) Dispatch(ctx context.Context, session *Session, message SocketMessage, limiter *MessageLimiter, logger *slog.Logger) error {
+	dispatch := &Dispatch{
+		Session: session,
+		Message: message,
+		Route:   mr.Route(message.Type),
+		Label:   mr.Label(message.Type),
+		Limiter: limiter,
+		Logger:  logger,
+	}
+	handler := mr.handler
+	for i := len(mr.middlewares) - 1; i >= 0; i-- {
+		handler = mr.middlewares[i](handler)
+	}
+	return handler(ctx, dispatch)
+}
+
+// Creates the router of the server with the messageRoutes and the default middleware chain.
+func (ss *SignalingServer) newMessageRouter() *MessageRouter {
+	router := NewMessageRouter(ss.handleDispatch, messageRoutes...)
+	router.Use(
+		ss.recoverMiddleware,
+		ss.logMiddleware,
+		ss.metricsMiddleware,
+		ss.rateLimitMiddleware,
+		ss.validationMiddleware,
+		ss.policyMiddleware,
+		ss.authorizationMiddleware,
+		ss.tracingMiddleware,
+	)
+	return router
+}
+
+// The end of the middleware chain, calling the handler of the route.
+func (ss *SignalingServer) handleDispatch(ctx context.Context, dispatch *Dispatch) error {
+	if dispatch.Route == nil {
+		return newSocketError(codeUnknownType, "Unrecognized command")
+	}
+	return dispatch.Route.Handler(ss, ctx, dispatch.Session, dispatch.Message)
+}
+
+// Turns a panic in a handler into an error, so it closes the connection instead of the server.
+func (ss *SignalingServer) recoverMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				dispatch.Logger.Error("Recovered from a panic in a message handler", logKeyType, dispatch.Label, "panic", recovered, "stack", string(debug.Stack()))
+				err = fmt.Errorf("panic while handling %s: %v", dispatch.Label, recovered)
+			}
+		}()
+		return next(ctx, dispatch)
+	}
+}
+
+// Logs the messages and the failures, and records them on the dashboard.
+func (ss *SignalingServer) logMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) error {
+		dispatch.Logger.Debug("Received a message", logKeyType, dispatch.Label)
+		ss.activity.RecordMessage(dispatch.Label)
+		err := next(ctx, dispatch)
+		if err != nil {
+			dispatch.Logger.Warn("Failed to handle a message", logKeyType, dispatch.Label, logKeyError, err)
+			ss.activity.RecordError(dispatch.Label, err)
+		}
+		return err
+	}
+}
+
+// Counts the messages and measures how long they take to handle.
+func (ss *SignalingServer) metricsMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) error {
+		ss.metrics.messages.WithLabelValues(dispatch.Label).Inc()
+		defer func(start time.Time) {
+			ss.metrics.handlerDuration.WithLabelValues(dispatch.Label).Observe(time.Since(start).Seconds())
+		}(time.Now())
+		return next(ctx, dispatch)
+	}
+}
+
+// Answers messages over the limit of their type with rate_limited. The connection stays open.
+func (ss *SignalingServer) rateLimitMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) error {
+		if ok, retryAfter := dispatch.Limiter.Allow(dispatch.Label); !ok {
+			ss.metrics.rateLimited.WithLabelValues(dispatch.Label).Inc()
+			dispatch.Logger.Debug("Rate limited a message", logKeyType, dispatch.Label)
+			response := newRateLimitedResponse("Too many "+dispatch.Label+" messages, slow down", retryAfter)
+			response.RequestID = dispatch.Message.RequestID
+			return ss.sendSocketResponse(dispatch.Session, response)
+		}
+		return next(ctx, dispatch)
+	}
+}
+
+// Rejects messages of unknown types and messages without the fields of their type.
+func (ss *SignalingServer) validationMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) error {
+		if dispatch.Route == nil {
+			if dispatch.Message.Type == "" {
+				ve := &ValidationError{}
+				ve.add("type", "is required")
+				return ve
+			}
+			return newSocketError(codeUnknownType, "Unrecognized command")
+		}
+		if err := validateMessage(dispatch.Message, dispatch.Route.Fields); err != nil {
+			return err
+		}
+		return next(ctx, dispatch)
+	}
+}
+
+// Applies the SDP and candidate policy. Dropped candidates end the dispatch silently.
+func (ss *SignalingServer) policyMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) error {
+		message, dropReason, err := ss.applyPolicy(dispatch.Logger, dispatch.Message)
+		if err != nil {
+			return err
+		}
+		if dropReason != "" {
+			dispatch.Logger.Debug("Dropped a candidate", "reason", dropReason)
+			return nil
+		}
+		dispatch.Message = message
+		return next(ctx, dispatch)
+	}
+}
+
+// Rejects messages the sender is not allowed to send in its current state.
+func (ss *SignalingServer) authorizationMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) error {
+		access := dispatch.Route.Access
+		if access == accessAnyone {
+			return next(ctx, dispatch)
+		}
+		user := ss.UserFromSession(dispatch.Session)
+		if access == accessNewSession {
+			if user != nil {
+				return newSocketError(codeUnauthorized, "The user is initiated already")
+			}
+			return next(ctx, dispatch)
+		}
+		if user == nil {
+			return newSocketError(codeUnauthorized, "Initiate the user first")
+		}
+		if access == accessUser {
+			return next(ctx, dispatch)
+		}
+		room, err := ss.rooms.GetFirstRoomWithUser(user)
+		if access == accessUserNotInRoom {
+			if err == nil && room != nil {
+				return newSocketError(codeUnauthorized, "Leave the room first")
+			}
+			return next(ctx, dispatch)
+		}
+		if err != nil || room == nil {
+			return newSocketError(codeUnauthorized, "Join a room first")
+		}
+		if access == accessRoomOwner && room.Owner != user {
+			return newSocketError(codeUnauthorized, "Only the owner of the room may do that")
+		}
+		return next(ctx, dispatch)
+	}
+}
+
+// Traces the handling of the message. Messages carrying a trace context continue the sender's
+// trace, others start a new one. Either way the dispatch is linked to the connection span.
+func (ss *SignalingServer) tracingMiddleware(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, dispatch *Dispatch) error {
+		spanOptions := []trace.SpanStartOption{
+			trace.WithLinks(trace.LinkFromContext(ctx)),
+			trace.WithAttributes(attribute.String("piirtul.message.type", dispatch.Label)),
+		}
+		if len(dispatch.Message.Trace) > 0 {
+			ctx = extractTraceContext(ctx, dispatch.Message)
+		} else {
+			spanOptions = append(spanOptions, trace.WithNewRoot())
+		}
+		ctx, span := ss.tracer.Start(ctx, "dispatch "+dispatch.Label, spanOptions...)
+		defer span.End()
+
+		err := next(ctx, dispatch)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Reasons for a user leaving, used as the leave metric label.
+const (
+	leaveRequested       = "requested"
+	leaveClosed          = "closed"
+	leaveUnexpectedClose = "unexpected_close"
+)
+
+// The Prometheus metrics of the signaling server.
+type Metrics struct {
+	Registry        *prometheus.Registry
+	connections     prometheus.Gauge
+	messages        *prometheus.CounterVec
+	relayFailures   *prometheus.CounterVec
+	leaves          *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	rateLimited     *prometheus.CounterVec
+	// Candidates not relayed because of the candidate policy.
+	candidatesDropped *prometheus.CounterVec
+}
+
+// Creates the metrics and registers them, together with the collector reading the
+// user and room state of the server, in a new registry.
+func NewMetrics(ss *SignalingServer) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "piirtul_websocket_connections",
+			Help: "Number of open WebSocket connections.",
+		}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "piirtul_messages_total",
+			Help: "Number of received socket messages by type.",
+		}, []string{"type"}),
+		relayFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "piirtul_relay_failures_total",
+			Help: "Number of messages that could not be relayed to their receiver, by type.",
+		}, []string{"type"}),
+		leaves: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "piirtul_leave_events_total",
+			Help: "Number of users leaving the server by reason.",
+		}, []string{"reason"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "piirtul_handler_duration_seconds",
+			Help:    "Time spent handling a socket message by type.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"type"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "piirtul_rate_limited_total",
+			Help: "Number of requests, connections and socket messages rejected by a rate limit, by limit.",
+		}, []string{"limit"}),
+		candidatesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "piirtul_candidates_dropped_total",
+			Help: "Number of ICE candidates dropped by the candidate policy, by reason.",
+		}, []string{"reason"}),
+	}
+
+	m.Registry.MustRegister(
+		m.connections,
+		m.messages,
+		m.relayFailures,
+		m.leaves,
+		m.handlerDuration,
+		m.rateLimited,
+		m.candidatesDropped,
+		&stateCollector{ss: ss},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// The bucket upper bounds of the room size histogram.
+var roomSizeBuckets = []float64{1, 2, 3, 4, 6, 8, 12, 16}
+
+var (
+	usersDesc = prometheus.NewDesc("piirtul_users",
+		"Number of initiated users.", nil, nil)
+	roomsDesc = prometheus.NewDesc("piirtul_rooms",
+		"Number of open rooms.", nil, nil)
+	roomSizeDesc = prometheus.NewDesc("piirtul_room_size",
+		"Distribution of the number of users in the open rooms.", nil, nil)
+)
+
+// A collector that reads the user and room counts from the server on every scrape,
+// so they can never drift from the actual state.
+type stateCollector struct {
+	ss *SignalingServer
+}
+
+func (sc *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersDesc
+	ch <- roomsDesc
+	ch <- roomSizeDesc
+}
+
+func (sc *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(sc.ss.UserCount()))
+
+	rooms, err := sc.ss.rooms.List()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(roomsDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(roomsDesc, prometheus.GaugeValue, float64(len(rooms)))
+
+	buckets := make(map[float64]uint64, len(roomSizeBuckets))
+	for _, bound := range roomSizeBuckets {
+		buckets[bound] = 0
+	}
+	var sum float64
+	for _, room := range rooms {
+		size := float64(len(room.Users))
+		sum += size
+		for _, bound := range roomSizeBuckets {
+			if size <= bound {
+				buckets[bound]++
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstHistogram(roomSizeDesc, uint64(len(rooms)), sum, buckets)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Compares the metrics of the registry with the names to the expected exposition text.
+func checkMetrics(t *testing.T, ss *SignalingServer, expected string, names ...string) {
+	t.Helper()
+	if err := testutil.CollectAndCompare(ss.metrics.Registry, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+}
+
+// The room size histogram of no rooms.
+const noRoomsMetrics = `
+# HELP piirtul_room_size Distribution of the number of users in the open rooms.
+# TYPE piirtul_room_size histogram
+piirtul_room_size_bucket{le="1"} 0
+piirtul_room_size_bucket{le="2"} 0
+piirtul_room_size_bucket{le="3"} 0
+piirtul_room_size_bucket{le="4"} 0
+piirtul_room_size_bucket{le="6"} 0
+piirtul_room_size_bucket{le="8"} 0
+piirtul_room_size_bucket{le="12"} 0
+piirtul_room_size_bucket{le="16"} 0
+piirtul_room_size_bucket{le="+Inf"} 0
+piirtul_room_size_sum 0
+piirtul_room_size_count 0
+# HELP piirtul_rooms Number of open rooms.
+# TYPE piirtul_rooms gauge
+piirtul_rooms 0
+# HELP piirtul_users Number of initiated users.
+# TYPE piirtul_users gauge
+piirtul_users 0
+`
+
+func TestMetrics(t *testing.T) {
+	_, ss := newTestApp(t, nil)
+	state := []string{"piirtul_users", "piirtul_rooms", "piirtul_room_size"}
+	checkMetrics(t, ss, noRoomsMetrics, state...)
+
+	alice := connectMemory(t, ss, "alice")
+	bob := connectMemory(t, ss, "bob")
+	alice.request(SocketMessage{Type: "initiation", Name: "alice"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"}, map[string]any{"success": true})
+	checkMetrics(t, ss, `
+# HELP piirtul_room_size Distribution of the number of users in the open rooms.
+# TYPE piirtul_room_size histogram
+piirtul_room_size_bucket{le="1"} 0
+piirtul_room_size_bucket{le="2"} 1
+piirtul_room_size_bucket{le="3"} 1
+piirtul_room_size_bucket{le="4"} 1
+piirtul_room_size_bucket{le="6"} 1
+piirtul_room_size_bucket{le="8"} 1
+piirtul_room_size_bucket{le="12"} 1
+piirtul_room_size_bucket{le="16"} 1
+piirtul_room_size_bucket{le="+Inf"} 1
+piirtul_room_size_sum 2
+piirtul_room_size_count 1
+# HELP piirtul_rooms Number of open rooms.
+# TYPE piirtul_rooms gauge
+piirtul_rooms 1
+# HELP piirtul_users Number of initiated users.
+# TYPE piirtul_users gauge
+piirtul_users 2
+`, state...)
+
+	bob.send(SocketMessage{Type: "offer", Name: "alice", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}})
+	alice.receive()
+	bob.request(SocketMessage{Type: "offer", Name: "nobody", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}}, map[string]any{"error": codePeerNotFound})
+	bob.request(SocketMessage{Type: "leaveRoom"}, map[string]any{"type": "leaveConfirmed"})
+	if left := alice.receive(); left["type"] != "peerLeavingRoom" {
+		t.Errorf("alice received %v, want bob leaving", left)
+	}
+	alice.transport.Close()
+	eventually(t, func() bool { return ss.UserCount() == 0 }, "alice's user is left after closing")
+
+	checkMetrics(t, ss, noRoomsMetrics, state...)
+	checkMetrics(t, ss, `
+# HELP piirtul_leave_events_total Number of users leaving the server by reason.
+# TYPE piirtul_leave_events_total counter
+piirtul_leave_events_total{reason="closed"} 1
+piirtul_leave_events_total{reason="requested"} 1
+# HELP piirtul_messages_total Number of received socket messages by type.
+# TYPE piirtul_messages_total counter
+piirtul_messages_total{type="initiation"} 2
+piirtul_messages_total{type="leaveRoom"} 1
+piirtul_messages_total{type="offer"} 2
+piirtul_messages_total{type="roomInitiation"} 2
+# HELP piirtul_relay_failures_total Number of messages that could not be relayed to their receiver, by type.
+# TYPE piirtul_relay_failures_total counter
+piirtul_relay_failures_total{type="offer"} 1
+`, "piirtul_leave_events_total", "piirtul_messages_total", "piirtul_relay_failures_total")
+}
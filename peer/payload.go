@@ -0,0 +1,58 @@
+package peer
+
+import (
+	"encoding/json"
+)
+
+// The payload types sent over the data channels, the same as in main.js.
+const (
+	payloadChat    = "chat"
+	payloadDrawing = "drawing"
+	payloadClear   = "clear"
+)
+
+// A chat message. The sender is the name the peer put in the message.
+type Chat struct {
+	Sender  string `json:"sender"`
+	Message string `json:"message"`
+}
+
+// A line drawn on the canvas from the previous point to the current one.
+type Drawing struct {
+	PrevX     float64 `json:"prevX"`
+	PrevY     float64 `json:"prevY"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Color     string  `json:"color"`
+	Thickness float64 `json:"thickness"`
+}
+
+// A data channel payload of any type.
+type payload struct {
+	Type string `json:"type"`
+	Chat
+	Drawing
+}
+
+// Encodes a chat message as main.js does.
+func encodeChat(chat Chat) ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Chat
+	}{payloadChat, chat})
+}
+
+// Encodes a drawn line as main.js does.
+func encodeDrawing(drawing Drawing) ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Drawing
+	}{payloadDrawing, drawing})
+}
+
+// Encodes the clearing of the canvas as main.js does.
+func encodeClear() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+	}{payloadClear})
+}
@@ -0,0 +1,483 @@
+// Package peer is a headless piirtul.io user. It joins rooms through the signaling server and talks
+// to the other users over WebRTC data channels, the same way main.js does in the browser, so bots
+// and end-to-end tests can take part in a room without a browser.
+//
+//	p, err := peer.Dial(ctx, "wss://piirtul.io/websocket", peer.Options{
+//		Client: client.Options{Name: "bot"},
+//		Handlers: peer.Handlers{
+//			OnChat: func(from string, chat peer.Chat) { ... },
+//		},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer p.Close()
+//	if _, err := p.JoinRoom(ctx, "ABCD"); err != nil {
+//		return err
+//	}
+//	err = p.SendChat("hello")
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"signaling/client"
+	"signaling/protocol"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// How often WaitOpen checks for the connection with a user that has not sent its offer yet.
+const waitInterval = 50 * time.Millisecond
+
+// The callbacks of the data channel payloads and the room events. They run on the goroutines
+// of the signaling client and of pion, so they must not block.
+type Handlers struct {
+	OnChat    func(from string, chat Chat)
+	OnDrawing func(from string, drawing Drawing)
+	OnClear   func(from string)
+	// The data channel with a peer is open.
+	OnOpen func(peer string)
+	// A peer left the room. When the peer was the owner, the room is gone and so are
+	// the connections to the other peers.
+	OnPeerLeft func(peer string, roomDestroyed bool)
+}
+
+// The options of a Peer.
+type Options struct {
+	// The options of the signaling client. The offer, answer, candidate and peer left handlers
+	// are used by the peer, the others are left as they are.
+	Client client.Options
+	// The ICE servers of the peer connections. When nil, those of /api/client-config are used.
+	ICEServers []webrtc.ICEServer
+	// The pion API creating the peer connections, e.g. one with a virtual network.
+	// When nil, the default API is used.
+	API      *webrtc.API
+	Handlers Handlers
+}
+
+// A user of a room with a WebRTC connection to each of the other users. The methods are safe
+// for concurrent use.
+type Peer struct {
+	client   *client.Client
+	api      *webrtc.API
+	config   webrtc.Configuration
+	handlers Handlers
+	logger   *slog.Logger
+
+	mux   sync.Mutex
+	conns map[string]*connection
+}
+
+// The connection with another user of the room.
+type connection struct {
+	pc *webrtc.PeerConnection
+	// Held while the local description is being sent, so that the local candidates
+	// are never relayed before it.
+	signalMux sync.Mutex
+	// Nil until the data channel has been created or received.
+	channel  *webrtc.DataChannel
+	open     chan struct{}
+	openOnce sync.Once
+	// The remote candidates received before the remote description, guarded by Peer.mux.
+	candidates []webrtc.ICECandidateInit
+}
+
+// Connects to the WebSocket URL of the signaling server and initiates the user.
+func Dial(ctx context.Context, serverURL string, options Options) (*Peer, error) {
+	if options.API == nil {
+		options.API = webrtc.NewAPI()
+	}
+	logger := options.Client.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	p := &Peer{
+		api:      options.API,
+		config:   webrtc.Configuration{ICEServers: options.ICEServers},
+		handlers: options.Handlers,
+		logger:   logger,
+		conns:    make(map[string]*connection),
+	}
+	if options.ICEServers == nil {
+		config, err := client.FetchConfig(ctx, options.Client.HTTPClient, serverURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetching the ICE servers: %w", err)
+		}
+		for _, server := range config.ICEServers {
+			p.config.ICEServers = append(p.config.ICEServers, webrtc.ICEServer{URLs: server.URLs, Username: server.Username, Credential: server.Credential})
+		}
+	}
+
+	onPeerLeft := options.Client.Handlers.OnPeerLeft
+	options.Client.Handlers.OnOffer = p.onOffer
+	options.Client.Handlers.OnAnswer = p.onAnswer
+	options.Client.Handlers.OnCandidate = p.onCandidate
+	options.Client.Handlers.OnPeerLeft = func(name string, roomDestroyed bool) {
+		p.onPeerLeft(name, roomDestroyed)
+		if onPeerLeft != nil {
+			onPeerLeft(name, roomDestroyed)
+		}
+	}
+	c, err := client.Dial(ctx, serverURL, options.Client)
+	if err != nil {
+		return nil, err
+	}
+	p.client = c
+	return p, nil
+}
+
+// Returns the signaling client of the peer.
+func (p *Peer) Client() *client.Client {
+	return p.client
+}
+
+// Returns the user name of the peer.
+func (p *Peer) Name() string {
+	return p.client.Name()
+}
+
+// Returns the names of the users with an open data channel, sorted.
+func (p *Peer) Peers() []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	var names []string
+	for name, conn := range p.conns {
+		select {
+		case <-conn.open:
+			names = append(names, name)
+		default:
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Creates a room and waits in it for the offers of the users joining.
+func (p *Peer) CreateRoom(ctx context.Context, roomID string) error {
+	return p.client.CreateRoom(ctx, roomID)
+}
+
+// Joins a room and sends an offer with a data channel to each of the users in it.
+// Returns the names of the users.
+func (p *Peer) JoinRoom(ctx context.Context, roomID string) ([]string, error) {
+	participants, err := p.client.JoinRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range participants {
+		if err := p.offer(name); err != nil {
+			return participants, fmt.Errorf("connecting to %s: %w", name, err)
+		}
+	}
+	return participants, nil
+}
+
+// Waits until the data channel with the user is open.
+func (p *Peer) WaitOpen(ctx context.Context, name string) error {
+	for {
+		p.mux.Lock()
+		conn := p.conns[name]
+		p.mux.Unlock()
+		if conn != nil {
+			select {
+			case <-conn.open:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		// The user's offer has not arrived yet.
+		select {
+		case <-time.After(waitInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Sends a chat message to every user with an open data channel.
+func (p *Peer) SendChat(message string) error {
+	data, err := encodeChat(Chat{Sender: p.Name(), Message: message})
+	if err != nil {
+		return err
+	}
+	return p.broadcast(data)
+}
+
+// Sends a drawn line to every user with an open data channel.
+func (p *Peer) SendDrawing(drawing Drawing) error {
+	data, err := encodeDrawing(drawing)
+	if err != nil {
+		return err
+	}
+	return p.broadcast(data)
+}
+
+// Tells every user with an open data channel to clear the canvas.
+func (p *Peer) SendClear() error {
+	data, err := encodeClear()
+	if err != nil {
+		return err
+	}
+	return p.broadcast(data)
+}
+
+// Closes the peer connections and leaves the room.
+func (p *Peer) Leave(ctx context.Context) error {
+	p.closeConnections()
+	return p.client.Leave(ctx)
+}
+
+// Closes the peer connections and the signaling connection.
+func (p *Peer) Close() error {
+	p.closeConnections()
+	return p.client.Close()
+}
+
+// Sends the data to every open data channel.
+func (p *Peer) broadcast(data []byte) error {
+	p.mux.Lock()
+	var channels []*webrtc.DataChannel
+	for _, conn := range p.conns {
+		if conn.channel != nil && conn.channel.ReadyState() == webrtc.DataChannelStateOpen {
+			channels = append(channels, conn.channel)
+		}
+	}
+	p.mux.Unlock()
+
+	var errs []error
+	for _, channel := range channels {
+		errs = append(errs, channel.SendText(string(data)))
+	}
+	return errors.Join(errs...)
+}
+
+// Creates the connection with a user, replacing an earlier one.
+func (p *Peer) newConnection(name string) (*connection, error) {
+	pc, err := p.api.NewPeerConnection(p.config)
+	if err != nil {
+		return nil, err
+	}
+	conn := &connection{pc: pc, open: make(chan struct{})}
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		init := candidate.ToJSON()
+		message := protocol.Candidate{Candidate: init.Candidate}
+		if init.SDPMid != nil {
+			message.SdpMid = *init.SDPMid
+		}
+		if init.SDPMLineIndex != nil {
+			message.SdpMLineIndex = int(*init.SDPMLineIndex)
+		}
+		if init.UsernameFragment != nil {
+			message.UsernameFragment = *init.UsernameFragment
+		}
+		conn.signalMux.Lock()
+		defer conn.signalMux.Unlock()
+		if err := p.client.SendCandidate(name, message); err != nil {
+			p.logger.Warn("Failed to send a candidate", "peer", name, "error", err)
+		}
+	})
+	pc.OnDataChannel(func(channel *webrtc.DataChannel) {
+		p.attach(name, conn, channel)
+	})
+
+	p.mux.Lock()
+	previous := p.conns[name]
+	p.conns[name] = conn
+	p.mux.Unlock()
+	if previous != nil {
+		previous.pc.Close()
+	}
+	return conn, nil
+}
+
+// Handles the data channel of a connection, created by either side.
+func (p *Peer) attach(name string, conn *connection, channel *webrtc.DataChannel) {
+	p.mux.Lock()
+	conn.channel = channel
+	p.mux.Unlock()
+
+	channel.OnOpen(func() {
+		conn.openOnce.Do(func() {
+			close(conn.open)
+			if p.handlers.OnOpen != nil {
+				p.handlers.OnOpen(name)
+			}
+		})
+	})
+	channel.OnMessage(func(message webrtc.DataChannelMessage) {
+		p.receive(name, message.Data)
+	})
+}
+
+// Passes a data channel payload to the handler of its type.
+func (p *Peer) receive(from string, data []byte) {
+	var received payload
+	if err := json.Unmarshal(data, &received); err != nil {
+		p.logger.Warn("Received a payload with incorrect format", "peer", from, "error", err)
+		return
+	}
+	switch received.Type {
+	case payloadChat:
+		if p.handlers.OnChat != nil {
+			p.handlers.OnChat(from, received.Chat)
+		}
+	case payloadDrawing:
+		if p.handlers.OnDrawing != nil {
+			p.handlers.OnDrawing(from, received.Drawing)
+		}
+	case payloadClear:
+		if p.handlers.OnClear != nil {
+			p.handlers.OnClear(from)
+		}
+	default:
+		p.logger.Debug("Ignored a payload", "peer", from, "type", received.Type)
+	}
+}
+
+// Connects to a user of the room: creates the data channel and sends the offer.
+func (p *Peer) offer(name string) error {
+	conn, err := p.newConnection(name)
+	if err != nil {
+		return err
+	}
+	channel, err := conn.pc.CreateDataChannel(p.Name()+"-"+name, nil)
+	if err != nil {
+		return err
+	}
+	p.attach(name, conn, channel)
+
+	conn.signalMux.Lock()
+	defer conn.signalMux.Unlock()
+	offer, err := conn.pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err := conn.pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	return p.client.SendOffer(name, protocol.Offer{Type: offer.Type.String(), Sdp: offer.SDP})
+}
+
+// Answers the offer of a user joining the room.
+func (p *Peer) onOffer(from string, offer protocol.Offer) {
+	conn, err := p.newConnection(from)
+	if err != nil {
+		p.logger.Warn("Failed to create a peer connection", "peer", from, "error", err)
+		return
+	}
+	conn.signalMux.Lock()
+	defer conn.signalMux.Unlock()
+	err = conn.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer.Sdp})
+	if err != nil {
+		p.logger.Warn("Failed to set the offer", "peer", from, "error", err)
+		return
+	}
+	p.addCandidates(from, conn)
+	answer, err := conn.pc.CreateAnswer(nil)
+	if err == nil {
+		err = conn.pc.SetLocalDescription(answer)
+	}
+	if err == nil {
+		err = p.client.SendAnswer(from, protocol.Answer{Type: answer.Type.String(), Sdp: answer.SDP})
+	}
+	if err != nil {
+		p.logger.Warn("Failed to answer an offer", "peer", from, "error", err)
+	}
+}
+
+// Completes the connection with the answer to our offer.
+func (p *Peer) onAnswer(from string, answer protocol.Answer) {
+	p.mux.Lock()
+	conn := p.conns[from]
+	p.mux.Unlock()
+	if conn == nil {
+		p.logger.Warn("Received an answer without an offer", "peer", from)
+		return
+	}
+	err := conn.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.Sdp})
+	if err != nil {
+		p.logger.Warn("Failed to set the answer", "peer", from, "error", err)
+		return
+	}
+	p.addCandidates(from, conn)
+}
+
+// Adds a candidate of a user, or keeps it until the user's description has been set.
+func (p *Peer) onCandidate(from string, candidate protocol.Candidate) {
+	sdpMLineIndex := uint16(candidate.SdpMLineIndex)
+	init := webrtc.ICECandidateInit{Candidate: candidate.Candidate, SDPMid: &candidate.SdpMid, SDPMLineIndex: &sdpMLineIndex}
+	if candidate.UsernameFragment != "" {
+		init.UsernameFragment = &candidate.UsernameFragment
+	}
+
+	p.mux.Lock()
+	conn := p.conns[from]
+	if conn != nil && conn.pc.RemoteDescription() == nil {
+		conn.candidates = append(conn.candidates, init)
+		conn = nil
+	}
+	p.mux.Unlock()
+	if conn == nil {
+		return
+	}
+	if err := conn.pc.AddICECandidate(init); err != nil {
+		p.logger.Warn("Failed to add a candidate", "peer", from, "error", err)
+	}
+}
+
+// Adds the candidates received before the remote description.
+func (p *Peer) addCandidates(from string, conn *connection) {
+	p.mux.Lock()
+	candidates := conn.candidates
+	conn.candidates = nil
+	p.mux.Unlock()
+	for _, candidate := range candidates {
+		if err := conn.pc.AddICECandidate(candidate); err != nil {
+			p.logger.Warn("Failed to add a candidate", "peer", from, "error", err)
+		}
+	}
+}
+
+// Closes the connection with a user that left, or all of them when the room is gone.
+func (p *Peer) onPeerLeft(name string, roomDestroyed bool) {
+	if roomDestroyed {
+		p.closeConnections()
+	} else {
+		p.mux.Lock()
+		conn := p.conns[name]
+		delete(p.conns, name)
+		p.mux.Unlock()
+		if conn != nil {
+			conn.pc.Close()
+		}
+	}
+	if p.handlers.OnPeerLeft != nil {
+		p.handlers.OnPeerLeft(name, roomDestroyed)
+	}
+}
+
+// Closes the connections with all users.
+func (p *Peer) closeConnections() {
+	p.mux.Lock()
+	conns := p.conns
+	p.conns = make(map[string]*connection)
+	p.mux.Unlock()
+	for _, conn := range conns {
+		conn.pc.Close()
+	}
+}
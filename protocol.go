@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"signaling/protocol"
+)
+
+// The versions of the signaling protocol, negotiated as WebSocket subprotocols. Clients that
+// don't ask for a subprotocol, like older cached pages, speak the legacy v1 format.
+// The v2 envelope is also available MessagePack encoded in binary frames.
+const (
+	protocolV1        = protocol.V1
+	protocolV2        = protocol.V2
+	protocolV2MsgPack = protocol.V2MsgPack
+)
+
+// The subprotocols the server speaks. The first one the client asks for is chosen.
+var supportedProtocols = []string{protocolV2, protocolV2MsgPack, protocolV1}
+
+// Translates between the frames of a protocol version and the messages the handlers work with,
+// so the handlers don't depend on the wire format.
+type ProtocolAdapter interface {
+	// The subprotocol name, e.g. "piirtul.v1".
+	Name() string
+	// The WebSocket message type of the frames.
+	FrameType() int
+	// Decodes an incoming frame. Malformed frames return a ValidationError or a syntax error.
+	Decode(raw []byte) (SocketMessage, error)
+	// Encodes an outgoing message, one of the response structs or a relayed SocketMessage.
+	Encode(message any) ([]byte, error)
+}
+
+// Returns the adapter of a negotiated subprotocol. No subprotocol means the legacy format.
+func protocolAdapter(name string) ProtocolAdapter {
+	switch name {
+	case protocolV2:
+		return envelopeProtocol{codec: jsonCodec{}}
+	case protocolV2MsgPack:
+		return envelopeProtocol{codec: msgpackCodec{}}
+	default:
+		return legacyProtocol{}
+	}
+}
+
+// Returns the first requested protocol the server speaks, or an empty string.
+func negotiateProtocol(requested []string) string {
+	for _, protocol := range requested {
+		for _, supported := range supportedProtocols {
+			if protocol == supported {
+				return protocol
+			}
+		}
+	}
+	return ""
+}
+
+// Decodes JSON into v, rejecting unknown fields and anything after the value. Unknown fields
+// are reported as a ValidationError, with the prefix added to the field name.
+func decodeStrict(raw []byte, v any, fieldPrefix string) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		// encoding/json only reports unknown fields in the error text.
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			validationErr := &ValidationError{}
+			validationErr.add(fieldPrefix+strings.Trim(field, `"`), "is not a known field")
+			return validationErr
+		}
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the message")
+	}
+	return nil
+}
+
+// The legacy format: flat JSON objects with the fields of SocketMessage and the response structs.
+type legacyProtocol struct{}
+
+func (legacyProtocol) Name() string {
+	return protocolV1
+}
+
+func (legacyProtocol) FrameType() int {
+	return jsonCodec{}.FrameType()
+}
+
+func (legacyProtocol) Decode(raw []byte) (SocketMessage, error) {
+	var message SocketMessage
+	err := decodeStrict(raw, &message, "")
+	return message, err
+}
+
+func (legacyProtocol) Encode(message any) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+// The envelope format of v2, see protocol.Envelope.
+type (
+	Envelope      = protocol.Envelope
+	EnvelopeError = protocol.EnvelopeError
+)
+
+// An incoming envelope. Only the fields a client may send are accepted.
+type inboundEnvelope struct {
+	Version int               `json:"v"`
+	Type    string            `json:"type"`
+	ID      string            `json:"id,omitempty"`
+	Data    rawValue          `json:"data,omitempty"`
+	Trace   map[string]string `json:"trace,omitempty"`
+}
+
+// The envelope format, encoded with the codec.
+type envelopeProtocol struct {
+	codec Codec
+}
+
+func (ep envelopeProtocol) Name() string {
+	if name := ep.codec.Name(); name != "" {
+		return protocolV2 + "+" + name
+	}
+	return protocolV2
+}
+
+func (ep envelopeProtocol) FrameType() int {
+	return ep.codec.FrameType()
+}
+
+func (ep envelopeProtocol) Decode(raw []byte) (SocketMessage, error) {
+	var envelope inboundEnvelope
+	if err := ep.codec.Unmarshal(raw, &envelope, ""); err != nil {
+		return SocketMessage{}, err
+	}
+	message := SocketMessage{Type: envelope.Type, RequestID: envelope.ID, Trace: envelope.Trace}
+	if envelope.Version != 2 {
+		validationErr := &ValidationError{}
+		validationErr.add("v", "must be 2")
+		return message, validationErr
+	}
+	if len(envelope.Data) > 0 {
+		var payload protocol.Payload
+		if err := ep.codec.Unmarshal(envelope.Data, &payload, "data."); err != nil {
+			return message, err
+		}
+		message.Name, message.RoomID, message.Role = payload.Name, payload.RoomID, payload.Role
+		message.Offer, message.Answer, message.Candidate = payload.Offer, payload.Answer, payload.Candidate
+	}
+	return message, nil
+}
+
+func (ep envelopeProtocol) Encode(message any) ([]byte, error) {
+	envelope, err := newEnvelope(message)
+	if err != nil {
+		return nil, err
+	}
+	return ep.codec.Marshal(envelope)
+}
+
+// Wraps any outgoing message in an envelope by moving the common fields of the flat format to the
+// envelope and the rest to data, so the handlers can keep building the flat response structs.
+func newEnvelope(message any) (Envelope, error) {
+	// Relayed messages are most of the traffic, so they skip the detour through the flat format.
+	if relayed, ok := message.(SocketMessage); ok {
+		return Envelope{
+			Version: 2,
+			Type:    relayed.Type,
+			ID:      relayed.RequestID,
+			Data: protocol.Payload{
+				Name: relayed.Name, RoomID: relayed.RoomID, Role: relayed.Role,
+				Offer: relayed.Offer, Answer: relayed.Answer, Candidate: relayed.Candidate,
+			},
+			Trace: relayed.Trace,
+		}, nil
+	}
+
+	flat, err := json.Marshal(message)
+	if err != nil {
+		return Envelope{}, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(flat, &fields); err != nil {
+		return Envelope{}, err
+	}
+
+	envelope := Envelope{Version: 2}
+	envelope.Type, _ = fields["type"].(string)
+	envelope.ID, _ = fields["request_id"].(string)
+	if success, ok := fields["success"].(bool); ok {
+		envelope.OK = &success
+	}
+	if code, ok := fields["error"].(string); ok && code != "" {
+		envelope.Error = &EnvelopeError{Code: code}
+		envelope.Error.Message, _ = fields["message"].(string)
+		if retryAfter, ok := fields["retry_after_ms"].(float64); ok {
+			envelope.Error.RetryAfterMs = int64(retryAfter)
+		}
+		if response, ok := message.(ValidationErrorResponse); ok {
+			envelope.Error.Fields = response.Fields
+		}
+		for _, key := range []string{"message", "retry_after_ms", "fields"} {
+			delete(fields, key)
+		}
+	}
+	if trace, ok := fields["trace"].(map[string]any); ok {
+		envelope.Trace = make(map[string]string, len(trace))
+		for key, value := range trace {
+			envelope.Trace[key], _ = value.(string)
+		}
+	}
+	for _, key := range []string{"type", "request_id", "success", "error", "trace"} {
+		delete(fields, key)
+	}
+	if len(fields) > 0 {
+		envelope.Data = fields
+	}
+	return envelope, nil
+}
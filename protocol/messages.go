@@ -0,0 +1,134 @@
+package protocol
+
+// Offer struct
+type Offer struct {
+	Type string `json:"type"`
+	Sdp  string `json:"sdp"`
+}
+
+// Answer struct
+type Answer struct {
+	Type string `json:"type"`
+	Sdp  string `json:"sdp"`
+}
+
+// Candidate struct
+type Candidate struct {
+	Candidate     string `json:"candidate"`
+	SdpMid        string `json:"sdpMid"`
+	SdpMLineIndex int    `json:"sdpMLineIndex"`
+	// Browsers include the ICE username fragment when serializing a candidate.
+	UsernameFragment string `json:"usernameFragment,omitempty"`
+}
+
+// A struct for incoming socket messages.
+type SocketMessage struct {
+	Type      string     `json:"type"`
+	RoomID    string     `json:"room_id,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Offer     *Offer     `json:"offer,omitempty"`
+	Answer    *Answer    `json:"answer,omitempty"`
+	Candidate *Candidate `json:"candidate,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	// W3C trace context of the sender, carried along with relayed messages.
+	Trace map[string]string `json:"trace,omitempty"`
+	// An optional ID chosen by the client, echoed in the response to the message.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// A struct for default outgoing messages.
+type SocketResponse struct {
+	Type    string `json:"type"`
+	Success bool   `json:"success"`
+	// The error code of a failed request, see /api/errors.
+	Error     string `json:"error,omitempty"`
+	Message   string `json:"message,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// A more spesific struct for Room Initiation response, sending also participants and the RoomID
+type RoomSocketResponse struct {
+	Type         string   `json:"type"`
+	Success      bool     `json:"success"`
+	RoomID       string   `json:"room_id,omitempty"`
+	Participants []string `json:"participants,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Message      string   `json:"message,omitempty"`
+	RequestID    string   `json:"request_id,omitempty"`
+}
+
+// A more specific struct for LeavingResponse
+type LeavingResponse struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	RoomDestroy bool   `json:"room_destroy"`
+}
+
+// The message sent to every client when the server starts draining.
+type DrainingResponse struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// How long the client should wait before reconnecting.
+	ReconnectAfterMs int64 `json:"reconnect_after_ms"`
+}
+
+// A single invalid field of a socket message.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// The response sent for a socket message that is malformed or not valid.
+type ValidationErrorResponse struct {
+	Type    string       `json:"type"`
+	Success bool         `json:"success"`
+	Error   string       `json:"error"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+	// The request ID of the invalid message, if it could be read.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// The response sent when a client exceeds a limit, over HTTP as well as over the WebSocket.
+type RateLimitedResponse struct {
+	Type    string `json:"type"`
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// How long the client should wait before trying again.
+	RetryAfterMs int64  `json:"retry_after_ms"`
+	RequestID    string `json:"request_id,omitempty"`
+}
+
+// The envelope format of v2. Every frame has the version, the type and the request ID on the top
+// level, the payload in data, and responses the outcome in ok and error:
+//
+//	{"v": 2, "type": "roomInitiation", "id": "r1", "data": {"room_id": "ABCD", "role": "participant"}}
+//	{"v": 2, "type": "roomInitiation", "id": "r1", "ok": false, "error": {"code": "room_full", "message": "Room is full"}}
+type Envelope struct {
+	Version int               `json:"v"`
+	Type    string            `json:"type"`
+	ID      string            `json:"id,omitempty"`
+	OK      *bool             `json:"ok,omitempty"`
+	Error   *EnvelopeError    `json:"error,omitempty"`
+	Data    any               `json:"data,omitempty"`
+	Trace   map[string]string `json:"trace,omitempty"`
+}
+
+// The error of a failed request in the envelope format.
+type EnvelopeError struct {
+	Code         string       `json:"code"`
+	Message      string       `json:"message,omitempty"`
+	Fields       []FieldError `json:"fields,omitempty"`
+	RetryAfterMs int64        `json:"retry_after_ms,omitempty"`
+}
+
+// The payload of a request envelope and of a relayed message.
+type Payload struct {
+	Name      string     `json:"name,omitempty"`
+	RoomID    string     `json:"room_id,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	Offer     *Offer     `json:"offer,omitempty"`
+	Answer    *Answer    `json:"answer,omitempty"`
+	Candidate *Candidate `json:"candidate,omitempty"`
+}
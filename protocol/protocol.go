@@ -0,0 +1,53 @@
+// Package protocol has the messages of the piirtul.io signaling protocol, shared by the server
+// and the Go client.
+package protocol
+
+// The versions of the protocol, negotiated as WebSocket subprotocols. Clients that don't ask for
+// a subprotocol speak V1. The V2 envelope is also available MessagePack encoded in binary frames.
+const (
+	V1        = "piirtul.v1"
+	V2        = "piirtul.v2"
+	V2MsgPack = "piirtul.v2+msgpack"
+)
+
+// The types of the messages a client sends.
+const (
+	TypeInitiation     = "initiation"
+	TypeRoomInitiation = "roomInitiation"
+	TypeOffer          = "offer"
+	TypeAnswer         = "answer"
+	TypeCandidate      = "candidate"
+	TypeLeaveRoom      = "leaveRoom"
+)
+
+// The types of the messages only the server sends.
+const (
+	TypeError           = "error"
+	TypePeerLeavingRoom = "peerLeavingRoom"
+	TypeLeaveConfirmed  = "leaveConfirmed"
+	TypeServerDraining  = "serverDraining"
+)
+
+// The roles of a roomInitiation.
+const (
+	RoleCreator     = "creator"
+	RoleParticipant = "participant"
+)
+
+// The stable, machine-readable error codes of the socket protocol and the HTTP API.
+// The messages next to them are for humans and may change.
+const (
+	CodeNameTaken           = "name_taken"
+	CodeRoomNotFound        = "room_not_found"
+	CodeRoomFull            = "room_full"
+	CodeRoomExists          = "room_exists"
+	CodeTooManyRooms        = "too_many_rooms"
+	CodeServerFull          = "server_full"
+	CodePeerNotFound        = "peer_not_found"
+	CodeUnauthorized        = "unauthorized"
+	CodeInvalidPayload      = "invalid_payload"
+	CodeUnknownType         = "unknown_type"
+	CodeUnsupportedProtocol = "unsupported_protocol"
+	CodeRateLimited         = "rate_limited"
+	CodeInternal            = "internal_error"
+)
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	for _, tt := range []struct {
+		requested []string
+		want      string
+	}{
+		{nil, ""},
+		{[]string{protocolV1}, protocolV1},
+		{[]string{protocolV2}, protocolV2},
+		{[]string{protocolV2MsgPack}, protocolV2MsgPack},
+		{[]string{protocolV2MsgPack, protocolV2}, protocolV2MsgPack},
+		{[]string{protocolV1, protocolV2}, protocolV1},
+		{[]string{"piirtul.v3", protocolV2}, protocolV2},
+		{[]string{"piirtul.v3"}, ""},
+	} {
+		if got := negotiateProtocol(tt.requested); got != tt.want {
+			t.Errorf("negotiated %q for %v, want %q", got, tt.requested, tt.want)
+		}
+	}
+}
+
+func TestProtocolNegotiation(t *testing.T) {
+	ts := newTestServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false"})
+	legacy := map[string]any{"type": "initiation", "success": true, "request_id": "r1"}
+	envelope := map[string]any{"v": float64(2), "type": "initiation", "id": "r1", "ok": true}
+
+	for i, tt := range []struct {
+		name      string
+		requested []string
+		want      string
+		frameType int
+		reply     map[string]any
+	}{
+		{"no protocol", nil, "", websocket.TextMessage, legacy},
+		{"v1", []string{protocolV1}, protocolV1, websocket.TextMessage, legacy},
+		{"v2", []string{protocolV2}, protocolV2, websocket.TextMessage, envelope},
+		{"v2 over MessagePack", []string{protocolV2MsgPack}, protocolV2MsgPack, websocket.BinaryMessage, envelope},
+		{"the first of several", []string{protocolV2MsgPack, protocolV2}, protocolV2MsgPack, websocket.BinaryMessage, envelope},
+		{"an unknown and v2", []string{"piirtul.v3", protocolV2}, protocolV2, websocket.TextMessage, envelope},
+	} {
+		dialer := websocket.Dialer{Subprotocols: tt.requested}
+		ws, _, err := dialer.Dial(ts.wsURL, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		defer ws.Close()
+		if got := ws.Subprotocol(); got != tt.want {
+			t.Errorf("%s: negotiated %q, want %q", tt.name, got, tt.want)
+		}
+
+		name := "user" + string(rune('a'+i))
+		var frame []byte
+		switch tt.want {
+		case protocolV2:
+			frame, err = json.Marshal(map[string]any{"v": 2, "type": "initiation", "id": "r1", "data": map[string]any{"name": name}})
+		case protocolV2MsgPack:
+			frame, err = msgpack.Marshal(map[string]any{"v": 2, "type": "initiation", "id": "r1", "data": map[string]any{"name": name}})
+		default:
+			frame, err = json.Marshal(SocketMessage{Type: "initiation", Name: name, RequestID: "r1"})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ws.WriteMessage(tt.frameType, frame); err != nil {
+			t.Fatal(err)
+		}
+
+		frameType, reply, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := map[string]any{}
+		if frameType == websocket.BinaryMessage {
+			// The MessagePack integers are compared as the JSON numbers.
+			var decoded map[string]any
+			if err := msgpack.Unmarshal(reply, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			reply, _ = json.Marshal(decoded)
+		}
+		if err := json.Unmarshal(reply, &got); err != nil {
+			t.Fatal(err)
+		}
+		if frameType != tt.frameType || !maps.Equal(got, tt.reply) {
+			t.Errorf("%s: replied %v in a frame of type %d, want %v in %d", tt.name, got, frameType, tt.reply, tt.frameType)
+		}
+	}
+
+	// Upgrades asking only for unknown versions are turned away before the upgrade.
+	dialer := websocket.Dialer{Subprotocols: []string{"piirtul.v3"}}
+	_, response, err := dialer.Dial(ts.wsURL, nil)
+	if err == nil || response == nil || response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("an unknown version connected with %v, %v, want %d", response, err, http.StatusBadRequest)
+	}
+	defer response.Body.Close()
+	var rejected SocketResponse
+	if err := json.NewDecoder(response.Body).Decode(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Error != codeUnsupportedProtocol || !strings.Contains(rejected.Message, protocolV2) {
+		t.Errorf("an unknown version was rejected with %+v, want %s listing the versions", rejected, codeUnsupportedProtocol)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"signaling/protocol"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// How long the limiter of an address is kept after its last request.
+const ipLimiterIdleTimeout = 10 * time.Minute
+
+// How often the idle limiters are removed.
+const ipLimiterSweepInterval = time.Minute
+
+// The message type limit applied to the message types without their own limit.
+const defaultMessageLimit = "default"
+
+// A token bucket limit: the bucket holds up to Burst tokens and refills at Rate tokens per second.
+// A rate of zero means unlimited.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Returns whether the limit is enabled.
+func (rl RateLimit) Enabled() bool {
+	return rl.Rate > 0
+}
+
+// Returns a new token bucket for the limit.
+func (rl RateLimit) newLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(rl.Rate), rl.Burst)
+}
+
+// Parses a limit written as "<rate>/<burst>", e.g. "2/10".
+func parseRateLimit(value string) (RateLimit, error) {
+	rateValue, burstValue, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("expected <rate>/<burst>")
+	}
+	limitRate, err := strconv.ParseFloat(rateValue, 64)
+	if err != nil {
+		return RateLimit{}, err
+	}
+	burst, err := strconv.Atoi(burstValue)
+	if err != nil {
+		return RateLimit{}, err
+	}
+	return RateLimit{Rate: limitRate, Burst: burst}, nil
+}
+
+// The response sent when a client exceeds a limit, over HTTP as well as over the WebSocket.
+type RateLimitedResponse = protocol.RateLimitedResponse
+
+// Creates a rate limited response.
+func newRateLimitedResponse(message string, retryAfter time.Duration) RateLimitedResponse {
+	return RateLimitedResponse{
+		Type:         "error",
+		Success:      false,
+		Error:        codeRateLimited,
+		Message:      message,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	}
+}
+
+// Takes a token from the bucket if one is available. Otherwise returns how long it takes
+// until one is, without taking it.
+func takeToken(limiter *rate.Limiter, now time.Time) (bool, time.Duration) {
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return false, time.Second
+	}
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// A token bucket per client address.
+type IPRateLimiter struct {
+	limit     RateLimit
+	mux       sync.Mutex
+	limiters  map[string]*ipLimiter
+	lastSweep time.Time
+	// The clock, replaced in the tests.
+	now func() time.Time
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Creates an IPRateLimiter with a bucket of the limit for every address.
+func NewIPRateLimiter(limit RateLimit) *IPRateLimiter {
+	return &IPRateLimiter{limit: limit, limiters: make(map[string]*ipLimiter), lastSweep: time.Now(), now: time.Now}
+}
+
+// Returns whether a request from the address is allowed, and if not, how long until it is.
+func (l *IPRateLimiter) Allow(ip string) (bool, time.Duration) {
+	now := l.now()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if now.Sub(l.lastSweep) > ipLimiterSweepInterval {
+		for addr, entry := range l.limiters {
+			if now.Sub(entry.lastSeen) > ipLimiterIdleTimeout {
+				delete(l.limiters, addr)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	entry, ok := l.limiters[ip]
+	if !ok {
+		entry = &ipLimiter{limiter: l.limit.newLimiter()}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = now
+	return takeToken(entry.limiter, now)
+}
+
+// Counts the open connections per client address.
+type ConnLimiter struct {
+	max   int
+	mux   sync.Mutex
+	conns map[string]int
+}
+
+// Creates a ConnLimiter allowing max connections per address. Zero means unlimited.
+func NewConnLimiter(max int) *ConnLimiter {
+	return &ConnLimiter{max: max, conns: make(map[string]int)}
+}
+
+// Counts a new connection from the address, unless the address has reached the maximum.
+func (l *ConnLimiter) Acquire(ip string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.max > 0 && l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+// Stops counting a connection from the address.
+func (l *ConnLimiter) Release(ip string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.conns[ip] <= 1 {
+		delete(l.conns, ip)
+		return
+	}
+	l.conns[ip]--
+}
+
+// The token buckets of a single connection, one per message type.
+type MessageLimiter struct {
+	limits   map[string]RateLimit
+	limiters map[string]*rate.Limiter
+	// The clock, replaced in the tests.
+	now func() time.Time
+}
+
+// Creates a MessageLimiter for the limits by message type. Only used by the goroutine reading
+// the connection, so it has no lock.
+func NewMessageLimiter(limits map[string]RateLimit) *MessageLimiter {
+	return &MessageLimiter{limits: limits, limiters: make(map[string]*rate.Limiter), now: time.Now}
+}
+
+// Returns whether a message of the type is allowed, and if not, how long until it is.
+// The message type must be a label from MessageRouter.Label.
+func (l *MessageLimiter) Allow(messageType string) (bool, time.Duration) {
+	limiter, ok := l.limiters[messageType]
+	if !ok {
+		limit, ok := l.limits[messageType]
+		if !ok {
+			limit = l.limits[defaultMessageLimit]
+		}
+		if !limit.Enabled() {
+			return true, 0
+		}
+		limiter = limit.newLimiter()
+		l.limiters[messageType] = limiter
+	}
+	return takeToken(limiter, l.now())
+}
+
+// A middleware that limits the request rate of every client address. The limit name is
+// used in the metrics and the logs.
+func (ss *SignalingServer) rateLimit(name string, limiter *IPRateLimiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := c.RealIP()
+			if ok, retryAfter := limiter.Allow(ip); !ok {
+				ss.metrics.rateLimited.WithLabelValues(name).Inc()
+				ss.logger.Debug("Rate limited a request", "limit", name, logKeyRemoteAddr, ip)
+				return rateLimitedHTTPResponse(c, "Too many requests, slow down", retryAfter)
+			}
+			return next(c)
+		}
+	}
+}
+
+// A middleware that caps the number of open WebSocket connections of every client address.
+// The connection counts as open until the handler returns.
+func (ss *SignalingServer) limitConnections(limiter *ConnLimiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := c.RealIP()
+			if !limiter.Acquire(ip) {
+				ss.metrics.rateLimited.WithLabelValues("connections").Inc()
+				ss.logger.Warn("Rejected a connection over the per address limit", logKeyRemoteAddr, ip)
+				return rateLimitedHTTPResponse(c, "Too many connections from your address", time.Second)
+			}
+			defer limiter.Release(ip)
+			return next(c)
+		}
+	}
+}
+
+// Answers a request with 429 Too Many Requests and a Retry-After header.
+func rateLimitedHTTPResponse(c echo.Context, message string, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	return c.JSON(http.StatusTooManyRequests, newRateLimitedResponse(message, retryAfter))
+}
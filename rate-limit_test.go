@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// A clock the tests move by hand.
+type testClock struct {
+	time time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.time
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.time = c.time.Add(d)
+}
+
+// Creates an IPRateLimiter on a test clock.
+func newTestIPRateLimiter(limit RateLimit) (*IPRateLimiter, *testClock) {
+	clock := &testClock{time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewIPRateLimiter(limit)
+	limiter.now, limiter.lastSweep = clock.now, clock.time
+	return limiter, clock
+}
+
+func TestIPRateLimiter(t *testing.T) {
+	limiter, clock := newTestIPRateLimiter(RateLimit{Rate: 1, Burst: 2})
+	allow := func(ip string, want bool, wantRetryAfter time.Duration) {
+		t.Helper()
+		if ok, retryAfter := limiter.Allow(ip); ok != want || retryAfter != wantRetryAfter {
+			t.Errorf("a request from %s at %s: allowed %t retry after %s, want %t retry after %s", ip, clock.time.Format(time.TimeOnly), ok, retryAfter, want, wantRetryAfter)
+		}
+	}
+
+	allow("10.0.0.1", true, 0)
+	allow("10.0.0.1", true, 0)
+	allow("10.0.0.1", false, time.Second)
+	allow("10.0.0.2", true, 0)
+	clock.advance(400 * time.Millisecond)
+	allow("10.0.0.1", false, 600*time.Millisecond)
+	clock.advance(600 * time.Millisecond)
+	allow("10.0.0.1", true, 0)
+	allow("10.0.0.1", false, time.Second)
+
+	// The sweep runs once a minute and removes the addresses idle for longer than the timeout.
+	clock.advance(ipLimiterIdleTimeout - time.Second)
+	allow("10.0.0.2", true, 0)
+	clock.advance(2 * time.Second)
+	allow("10.0.0.3", true, 0)
+	if len(limiter.limiters) != 3 {
+		t.Errorf("%d addresses before the sweep interval passed, want 3", len(limiter.limiters))
+	}
+	clock.advance(ipLimiterSweepInterval)
+	allow("10.0.0.3", true, 0)
+	if _, ok := limiter.limiters["10.0.0.1"]; ok || len(limiter.limiters) != 2 {
+		t.Errorf("the addresses %v are left after the sweep, want 10.0.0.1 removed", limiter.limiters)
+	}
+	// A swept address starts with a full bucket.
+	allow("10.0.0.1", true, 0)
+	allow("10.0.0.1", true, 0)
+}
+
+func TestConnLimiter(t *testing.T) {
+	limiter := NewConnLimiter(2)
+	for i, want := range []bool{true, true, false} {
+		if got := limiter.Acquire("10.0.0.1"); got != want {
+			t.Errorf("connection %d acquired %t, want %t", i+1, got, want)
+		}
+	}
+	if !limiter.Acquire("10.0.0.2") {
+		t.Error("another address was rejected")
+	}
+	limiter.Release("10.0.0.1")
+	if !limiter.Acquire("10.0.0.1") {
+		t.Error("a connection after a release was rejected")
+	}
+	limiter.Release("10.0.0.1")
+	limiter.Release("10.0.0.1")
+	limiter.Release("10.0.0.2")
+	// Releasing more than acquired must not let the address go negative.
+	limiter.Release("10.0.0.2")
+	if len(limiter.conns) != 0 {
+		t.Errorf("the counts %v are left after releasing every connection", limiter.conns)
+	}
+	if !limiter.Acquire("10.0.0.2") || !limiter.Acquire("10.0.0.2") || limiter.Acquire("10.0.0.2") {
+		t.Error("the maximum does not hold after releasing more than acquired")
+	}
+
+	unlimited := NewConnLimiter(0)
+	for range 100 {
+		if !unlimited.Acquire("10.0.0.1") {
+			t.Fatal("an unlimited limiter rejected a connection")
+		}
+	}
+}
+
+func TestMessageLimiter(t *testing.T) {
+	clock := &testClock{time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewMessageLimiter(map[string]RateLimit{
+		"offer":             {Rate: 0.5, Burst: 1},
+		"candidate":         {},
+		defaultMessageLimit: {Rate: 10, Burst: 2},
+	})
+	limiter.now = clock.now
+	allow := func(messageType string, want bool, wantRetryAfter time.Duration) {
+		t.Helper()
+		if ok, retryAfter := limiter.Allow(messageType); ok != want || retryAfter != wantRetryAfter {
+			t.Errorf("a %s message: allowed %t retry after %s, want %t retry after %s", messageType, ok, retryAfter, want, wantRetryAfter)
+		}
+	}
+
+	allow("offer", true, 0)
+	allow("offer", false, 2*time.Second)
+	// Types have their own buckets, and the types without a limit use the default one.
+	allow("answer", true, 0)
+	allow("answer", true, 0)
+	allow("answer", false, 100*time.Millisecond)
+	allow("leaveRoom", true, 0)
+	// A disabled limit is unlimited.
+	for range 100 {
+		allow("candidate", true, 0)
+	}
+	// A rejected message does not take a token.
+	clock.advance(1500 * time.Millisecond)
+	allow("offer", false, 500*time.Millisecond)
+	clock.advance(500 * time.Millisecond)
+	allow("offer", true, 0)
+}
+
+func TestRateLimitedHTTPResponse(t *testing.T) {
+	e := echo.New()
+	for _, tt := range []struct {
+		retryAfter time.Duration
+		header     string
+	}{
+		{100 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{30 * time.Second, "30"},
+	} {
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/initiate", nil), recorder)
+		if err := rateLimitedHTTPResponse(c, "Too many requests, slow down", tt.retryAfter); err != nil {
+			t.Fatal(err)
+		}
+		var response RateLimitedResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != tt.header {
+			t.Errorf("retrying after %s answered %d with Retry-After %q, want %d with %q", tt.retryAfter, recorder.Code, recorder.Header().Get("Retry-After"), http.StatusTooManyRequests, tt.header)
+		}
+		if response.Error != codeRateLimited || response.RetryAfterMs != tt.retryAfter.Milliseconds() {
+			t.Errorf("retrying after %s answered %+v, want %s retrying after %d ms", tt.retryAfter, response, codeRateLimited, tt.retryAfter.Milliseconds())
+		}
+	}
+}
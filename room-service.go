@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"sync"
 )
 
 // Context room service key.
@@ -20,12 +21,15 @@ type RoomDatabase interface {
 	// Creates a new room for a user and returns it.
 	Create(user *User, roomID string) (*Room, error)
 
-	// Gets a room.
+	// Gets a snapshot of a room.
 	Get(roomID string) (*Room, error)
 
-	// Gets the first room with the user.
+	// Gets a snapshot of the first room with the user.
 	GetFirstRoomWithUser(user *User) (*Room, error)
 
+	// Lists a snapshot of all rooms.
+	List() ([]Room, error)
+
 	// Joins a room.
 	Join(roomID string, user *User) error
 
@@ -37,6 +41,11 @@ type RoomDatabase interface {
 	Clear() error
 }
 
+// Implemented by room databases that can persist their state, e.g. before a shutdown.
+type RoomPersister interface {
+	Persist() error
+}
+
 // The service for handling room operations.
 type RoomService struct {
 	DB RoomDatabase
@@ -57,6 +66,11 @@ func (roomService *RoomService) GetFirstRoomWithUser(user *User) (*Room, error)
 	return roomService.DB.GetFirstRoomWithUser(user)
 }
 
+// Lists a snapshot of all rooms.
+func (roomService *RoomService) List() ([]Room, error) {
+	return roomService.DB.List()
+}
+
 // Joins a room.
 func (roomService *RoomService) Join(roomID string, user *User) error {
 	return roomService.DB.Join(roomID, user)
@@ -75,9 +89,31 @@ func (roomService *RoomService) Clear() error {
 	return roomService.DB.Clear()
 }
 
+// Persists the rooms if the database supports it. Returns whether the rooms were persisted.
+func (roomService *RoomService) Persist() (bool, error) {
+	persister, ok := roomService.DB.(RoomPersister)
+	if !ok {
+		return false, nil
+	}
+	return true, persister.Persist()
+}
+
+// Errors returned when a room limit is reached, the room ID is taken or the user is in a room
+// already.
+var (
+	errTooManyRooms = errors.New("too many rooms")
+	errRoomFull     = errors.New("room is full")
+	errRoomExists   = errors.New("room exists already")
+	errUserInRoom   = errors.New("user is in a room already")
+)
+
 // The implementation of room database as a slice.
 type RoomSlice struct {
 	rooms []*Room
+	// The maximum number of rooms and users in a room. Zero means unlimited.
+	maxRooms    int
+	maxRoomSize int
+	mux         sync.Mutex
 }
 
 // Creates a new room for a user and returns it.
@@ -85,17 +121,43 @@ func (roomSlice *RoomSlice) Create(user *User, roomID string) (*Room, error) {
 	if user == nil {
 		return nil, errors.New("user is nil")
 	}
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
+
+	if roomSlice.maxRooms > 0 && len(roomSlice.rooms) >= roomSlice.maxRooms {
+		return nil, errTooManyRooms
+	}
+	if _, err := roomSlice.get(roomID); err == nil {
+		return nil, errRoomExists
+	}
+	// Checked under the same lock as the creation, so concurrent requests of the user can't
+	// put it in two rooms.
+	if roomSlice.roomWithUser(user) != nil {
+		return nil, errUserInRoom
+	}
 	room := &Room{
 		ID:    roomID,
 		Owner: user,
 		Users: []*User{user},
 	}
 	roomSlice.rooms = append(roomSlice.rooms, room)
-	return room, nil
+	return room.snapshot(), nil
 }
 
-// Gets a room.
+// Gets a snapshot of a room, whose user list may be read without holding the lock.
 func (roomSlice *RoomSlice) Get(roomID string) (*Room, error) {
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
+
+	room, err := roomSlice.get(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return room.snapshot(), nil
+}
+
+// Gets a room. The caller must hold the lock.
+func (roomSlice *RoomSlice) get(roomID string) (*Room, error) {
 	for i := 0; i < len(roomSlice.rooms); i++ {
 		room := roomSlice.rooms[i]
 		if room.ID == roomID {
@@ -105,17 +167,52 @@ func (roomSlice *RoomSlice) Get(roomID string) (*Room, error) {
 	return nil, errors.New("no room found")
 }
 
-// Gets the first room with the user.
+// Gets a snapshot of the first room with the user, whose user list may be read without holding
+// the lock.
 func (roomSlice *RoomSlice) GetFirstRoomWithUser(user *User) (*Room, error) {
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
+
+	room := roomSlice.roomWithUser(user)
+	if room == nil {
+		return nil, nil
+	}
+	return room.snapshot(), nil
+}
+
+// Returns the first room with the user, or nil. The caller must hold the lock.
+func (roomSlice *RoomSlice) roomWithUser(user *User) *Room {
 	for i := 0; i < len(roomSlice.rooms); i++ {
 		room := roomSlice.rooms[i]
 		for j := 0; j < len(room.Users); j++ {
 			if user == room.Users[j] {
-				return room, nil
+				return room
 			}
 		}
 	}
-	return nil, nil
+	return nil
+}
+
+// Lists a snapshot of all rooms. The returned rooms have their own copy of the user list.
+func (roomSlice *RoomSlice) List() ([]Room, error) {
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
+
+	rooms := make([]Room, 0, len(roomSlice.rooms))
+	for _, room := range roomSlice.rooms {
+		rooms = append(rooms, *room.snapshot())
+	}
+	return rooms, nil
+}
+
+// Returns a copy of the room with its own copy of the user list. The caller must hold the lock
+// of the room database.
+func (room *Room) snapshot() *Room {
+	return &Room{
+		ID:    room.ID,
+		Owner: room.Owner,
+		Users: append([]*User{}, room.Users...),
+	}
 }
 
 // Joins a room.
@@ -123,13 +220,22 @@ func (roomSlice *RoomSlice) Join(roomID string, user *User) error {
 	if user == nil {
 		return errors.New("user is nil")
 	}
-	room, err := roomSlice.Get(roomID)
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
+
+	room, err := roomSlice.get(roomID)
 	if err != nil {
 		return err
 	}
 	if room == nil {
 		return errors.New("no room found")
 	}
+	if roomSlice.maxRoomSize > 0 && len(room.Users) >= roomSlice.maxRoomSize {
+		return errRoomFull
+	}
+	if roomSlice.roomWithUser(user) != nil {
+		return errUserInRoom
+	}
 
 	room.Users = append(room.Users, user)
 	return nil
@@ -139,7 +245,10 @@ func (roomSlice *RoomSlice) RemoveUserFromRoom(roomID string, user *User) error
 	if roomID == "" || user == nil {
 		return errors.New("request is missing data")
 	}
-	room, err := roomSlice.Get(roomID)
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
+
+	room, err := roomSlice.get(roomID)
 	if err != nil {
 		return err
 	}
@@ -157,6 +266,8 @@ func (roomSlice *RoomSlice) RemoveUserFromRoom(roomID string, user *User) error
 }
 
 func (roomSlice *RoomSlice) DeleteRoom(roomID string) error {
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
 
 	for i, room := range roomSlice.rooms {
 		if room.ID == roomID {
@@ -169,6 +280,9 @@ func (roomSlice *RoomSlice) DeleteRoom(roomID string) error {
 
 // Clears all rooms.
 func (roomSlice *RoomSlice) Clear() error {
+	roomSlice.mux.Lock()
+	defer roomSlice.mux.Unlock()
+
 	roomSlice.rooms = []*Room{}
 	return nil
 }
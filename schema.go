@@ -0,0 +1,20 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:generate go run ./tools/schemagen -asyncapi embed/schema/asyncapi.json -typescript embed/assets/protocol.d.ts
+
+// The AsyncAPI document of the signaling protocol, generated from the message structs.
+//
+//go:embed embed/schema/asyncapi.json
+var asyncAPIDocument []byte
+
+// A handler for the /api/schema endpoint that publishes the AsyncAPI document of the protocol.
+func schemaHandler(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, asyncAPIDocument)
+}
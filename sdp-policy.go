@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/sdp/v3"
+)
+
+// The candidate policies.
+const (
+	candidatesAll       = "all"
+	candidatesNoHost    = "no_host"
+	candidatesRelayOnly = "relay_only"
+)
+
+// Reasons for dropping a candidate, used as the metric label.
+const (
+	dropHost           = "host"
+	dropNotRelay       = "not_relay"
+	dropPrivateAddress = "private_address"
+)
+
+// Policies applied to the offers, answers and candidates relayed between the peers.
+type PolicyConfig struct {
+	// Reject session descriptions with audio or video, only allowing data channels.
+	DataChannelOnly bool `yaml:"data_channel_only"`
+	// Which candidates are relayed: "all", "no_host" or "relay_only".
+	Candidates string `yaml:"candidates"`
+	// Drop candidates with private, loopback and link-local addresses, and hide such related addresses.
+	StripPrivateAddresses bool `yaml:"strip_private_addresses"`
+}
+
+// A session description after the policies have been applied.
+type sanitizedSDP struct {
+	SDP string
+	// The media sections, e.g. "application UDP/DTLS/SCTP mid=0".
+	Sections []string
+	// The candidates removed from the description by reason.
+	Dropped map[string]int
+}
+
+// Parses the session description, rejects it if it breaks the policy, and removes the
+// candidates the policy does not allow. The description is returned verbatim when nothing
+// was removed.
+func (p PolicyConfig) sanitizeSDP(raw string) (sanitizedSDP, error) {
+	result := sanitizedSDP{SDP: raw, Dropped: map[string]int{}}
+
+	var description sdp.SessionDescription
+	if err := description.UnmarshalString(raw); err != nil {
+		return result, fmt.Errorf("is not a valid session description: %w", err)
+	}
+
+	changed := false
+	for _, media := range description.MediaDescriptions {
+		section := media.MediaName.Media + " " + strings.Join(media.MediaName.Protos, "/")
+		if mid, ok := media.Attribute("mid"); ok {
+			section += " mid=" + mid
+		}
+		result.Sections = append(result.Sections, section)
+
+		if p.DataChannelOnly && media.MediaName.Media != "application" {
+			return result, fmt.Errorf("has %s media, only data channels are allowed", media.MediaName.Media)
+		}
+
+		attributes := media.Attributes[:0]
+		for _, attribute := range media.Attributes {
+			if attribute.Key != "candidate" {
+				attributes = append(attributes, attribute)
+				continue
+			}
+			value, reason, err := p.filterCandidate(attribute.Value)
+			if err != nil {
+				return result, err
+			}
+			if reason != "" {
+				result.Dropped[reason]++
+				changed = true
+				continue
+			}
+			if value != attribute.Value {
+				attribute.Value = value
+				changed = true
+			}
+			attributes = append(attributes, attribute)
+		}
+		media.Attributes = attributes
+	}
+
+	if changed {
+		sanitized, err := description.Marshal()
+		if err != nil {
+			return result, err
+		}
+		result.SDP = string(sanitized)
+	}
+	return result, nil
+}
+
+// Parses an ICE candidate and checks it against the policy. Returns the candidate to relay, or
+// the reason the candidate is dropped. An empty candidate signals the end of the candidates.
+func (p PolicyConfig) filterCandidate(raw string) (string, string, error) {
+	if raw == "" {
+		return raw, "", nil
+	}
+	candidate, err := ice.UnmarshalCandidate(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("is not a valid ICE candidate: %w", err)
+	}
+
+	switch {
+	case p.Candidates == candidatesRelayOnly && candidate.Type() != ice.CandidateTypeRelay:
+		return "", dropNotRelay, nil
+	case p.Candidates == candidatesNoHost && candidate.Type() == ice.CandidateTypeHost:
+		return "", dropHost, nil
+	case p.StripPrivateAddresses && isPrivateAddress(candidate.Address()):
+		return "", dropPrivateAddress, nil
+	}
+
+	// Reflexive and relay candidates carry the local address they were gathered from.
+	if related := candidate.RelatedAddress(); p.StripPrivateAddresses && related != nil && isPrivateAddress(related.Address) {
+		raw = hideRelatedAddress(raw)
+	}
+	return raw, "", nil
+}
+
+// Returns whether the address is a private, loopback, link-local or unspecified IP address.
+// Host names, like the mDNS names browsers hide the local addresses behind, are not private.
+func isPrivateAddress(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
+
+// Replaces the related address and port of a candidate with 0.0.0.0 and 0, like browsers do
+// when they hide the local addresses.
+func hideRelatedAddress(raw string) string {
+	fields := strings.Fields(raw)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "raddr":
+			fields[i+1] = "0.0.0.0"
+		case "rport":
+			fields[i+1] = "0"
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// Applies the policies to an offer, answer or candidate message. Returns the message to relay,
+// or the reason a candidate is dropped. Malformed payloads and policy violations are reported
+// as a ValidationError.
+func (ss *SignalingServer) applyPolicy(logger *slog.Logger, message SocketMessage) (SocketMessage, string, error) {
+	ve := &ValidationError{}
+	switch {
+	case message.Offer != nil:
+		offer := *message.Offer
+		offer.Sdp = ss.applySDPPolicy(logger, ve, "offer.sdp", offer.Sdp)
+		message.Offer = &offer
+	case message.Answer != nil:
+		answer := *message.Answer
+		answer.Sdp = ss.applySDPPolicy(logger, ve, "answer.sdp", answer.Sdp)
+		message.Answer = &answer
+	case message.Candidate != nil:
+		candidate := *message.Candidate
+		value, reason, err := ss.policy.filterCandidate(candidate.Candidate)
+		if err != nil {
+			ve.add("candidate.candidate", "%s", err)
+			return message, "", ve
+		}
+		if reason != "" {
+			ss.metrics.candidatesDropped.WithLabelValues(reason).Inc()
+			return message, reason, nil
+		}
+		candidate.Candidate = value
+		message.Candidate = &candidate
+	}
+	return message, "", ve.err()
+}
+
+func (ss *SignalingServer) applySDPPolicy(logger *slog.Logger, ve *ValidationError, field, raw string) string {
+	sanitized, err := ss.policy.sanitizeSDP(raw)
+	if err != nil {
+		ve.add(field, "%s", err)
+		return raw
+	}
+	for reason, count := range sanitized.Dropped {
+		ss.metrics.candidatesDropped.WithLabelValues(reason).Add(float64(count))
+	}
+	logger.Debug("Negotiated media sections", "field", field, "sections", sanitized.Sections)
+	return sanitized.SDP
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Candidates of every type and address family, as browsers send them.
+const (
+	hostPrivate    = "candidate:1 1 udp 2122260223 192.168.0.196 46243 typ host generation 0"
+	hostPublic     = "candidate:2 1 udp 2122260223 203.0.113.7 46243 typ host generation 0"
+	hostLoopback   = "candidate:3 1 udp 2122260223 127.0.0.1 46243 typ host generation 0"
+	hostMDNS       = "candidate:4 1 udp 2122260223 9b4e3f0c-52a6-4b51-9d3c-8a1c3e0f2b7d.local 46243 typ host generation 0"
+	hostIPv6ULA    = "candidate:5 1 udp 2122262783 fd12:3456:789a::1 46244 typ host generation 0"
+	hostIPv6Link   = "candidate:6 1 udp 2122262783 fe80::1 46244 typ host generation 0"
+	hostIPv6Global = "candidate:7 1 udp 2122262783 2001:db8::7 46244 typ host generation 0"
+	srflxPrivate   = "candidate:8 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243 generation 0"
+	srflxHidden    = "candidate:8 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 0.0.0.0 rport 0 generation 0"
+	srflxIPv6      = "candidate:9 1 udp 1686052607 2001:db8::7 46244 typ srflx raddr fd12:3456:789a::1 rport 46244 generation 0"
+	srflxIPv6Hide  = "candidate:9 1 udp 1686052607 2001:db8::7 46244 typ srflx raddr 0.0.0.0 rport 0 generation 0"
+	relayPublic    = "candidate:10 1 udp 41885439 198.51.100.5 3478 typ relay raddr 203.0.113.7 rport 46243 generation 0"
+	relayPrivate   = "candidate:11 1 udp 41885439 10.0.0.5 3478 typ relay raddr 192.168.0.196 rport 46243 generation 0"
+)
+
+func TestFilterCandidate(t *testing.T) {
+	all := PolicyConfig{Candidates: candidatesAll}
+	noHost := PolicyConfig{Candidates: candidatesNoHost}
+	relayOnly := PolicyConfig{Candidates: candidatesRelayOnly}
+	strip := PolicyConfig{Candidates: candidatesAll, StripPrivateAddresses: true}
+
+	for _, tt := range []struct {
+		name      string
+		policy    PolicyConfig
+		candidate string
+		want      string
+		reason    string
+	}{
+		{"the end of the candidates", relayOnly, "", "", ""},
+		{"a host candidate", all, hostPrivate, hostPrivate, ""},
+		{"a srflx candidate", all, srflxPrivate, srflxPrivate, ""},
+		{"a host candidate without hosts", noHost, hostPublic, "", dropHost},
+		{"an mDNS candidate without hosts", noHost, hostMDNS, "", dropHost},
+		{"an IPv6 host candidate without hosts", noHost, hostIPv6Global, "", dropHost},
+		{"a srflx candidate without hosts", noHost, srflxPrivate, srflxPrivate, ""},
+		{"a relay candidate without hosts", noHost, relayPublic, relayPublic, ""},
+		{"a host candidate with relays only", relayOnly, hostPublic, "", dropNotRelay},
+		{"a srflx candidate with relays only", relayOnly, srflxPrivate, "", dropNotRelay},
+		{"a relay candidate with relays only", relayOnly, relayPublic, relayPublic, ""},
+		{"a private host candidate", strip, hostPrivate, "", dropPrivateAddress},
+		{"a loopback host candidate", strip, hostLoopback, "", dropPrivateAddress},
+		{"a public host candidate", strip, hostPublic, hostPublic, ""},
+		{"an mDNS candidate", strip, hostMDNS, hostMDNS, ""},
+		{"a unique local IPv6 candidate", strip, hostIPv6ULA, "", dropPrivateAddress},
+		{"a link-local IPv6 candidate", strip, hostIPv6Link, "", dropPrivateAddress},
+		{"a global IPv6 candidate", strip, hostIPv6Global, hostIPv6Global, ""},
+		{"a srflx candidate with a private raddr", strip, srflxPrivate, srflxHidden, ""},
+		{"a srflx candidate with a hidden raddr", strip, srflxHidden, srflxHidden, ""},
+		{"an IPv6 srflx candidate with a private raddr", strip, srflxIPv6, srflxIPv6Hide, ""},
+		{"a relay candidate with a public raddr", strip, relayPublic, relayPublic, ""},
+		{"a private relay candidate", strip, relayPrivate, "", dropPrivateAddress},
+	} {
+		got, reason, err := tt.policy.filterCandidate(tt.candidate)
+		if err != nil || got != tt.want || reason != tt.reason {
+			t.Errorf("%s: got %q dropped for %q, %v, want %q dropped for %q", tt.name, got, reason, err, tt.want, tt.reason)
+		}
+	}
+
+	for _, invalid := range []string{"candidate:", "hello", "candidate:1 1 udp 1 192.168.0.1 port typ host", "candidate:1 1 udp 1 192.168.0.1 1 typ nope"} {
+		if _, _, err := all.filterCandidate(invalid); err == nil {
+			t.Errorf("filtered %q, want an error", invalid)
+		}
+	}
+}
+
+// Returns a session description with a data channel section with the candidates and the other
+// media sections.
+func testSDP(candidates []string, media ...string) string {
+	var sb strings.Builder
+	sb.WriteString("v=0\r\no=- 4611731400430051336 2 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n")
+	sb.WriteString("m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\nc=IN IP4 0.0.0.0\r\n")
+	for _, candidate := range candidates {
+		sb.WriteString("a=" + candidate + "\r\n")
+	}
+	sb.WriteString("a=ice-ufrag:ZuSG\r\na=ice-pwd:kyyD6pVr6f2qsUXn2ZQr4GJ+\r\na=mid:0\r\na=sctp-port:5000\r\n")
+	for i, kind := range media {
+		sb.WriteString("m=" + kind + " 9 UDP/TLS/RTP/SAVPF 111\r\nc=IN IP4 0.0.0.0\r\na=mid:" + string(rune('1'+i)) + "\r\n")
+	}
+	return sb.String()
+}
+
+func TestSanitizeSDP(t *testing.T) {
+	candidates := []string{hostPrivate, hostMDNS, hostIPv6ULA, srflxPrivate, relayPublic}
+	raw := testSDP(candidates)
+
+	for _, tt := range []struct {
+		name    string
+		policy  PolicyConfig
+		raw     string
+		want    string
+		dropped map[string]int
+	}{
+		{"all candidates", PolicyConfig{Candidates: candidatesAll}, raw, raw, map[string]int{}},
+		{"no hosts", PolicyConfig{Candidates: candidatesNoHost}, raw, testSDP([]string{srflxPrivate, relayPublic}), map[string]int{dropHost: 3}},
+		{"relays only", PolicyConfig{Candidates: candidatesRelayOnly}, raw, testSDP([]string{relayPublic}), map[string]int{dropNotRelay: 4}},
+		{"no private addresses", PolicyConfig{Candidates: candidatesAll, StripPrivateAddresses: true}, raw, testSDP([]string{hostMDNS, srflxHidden, relayPublic}), map[string]int{dropPrivateAddress: 2}},
+		{"data channels only", PolicyConfig{Candidates: candidatesAll, DataChannelOnly: true}, raw, raw, map[string]int{}},
+	} {
+		got, err := tt.policy.sanitizeSDP(tt.raw)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.SDP != tt.want || !maps.Equal(got.Dropped, tt.dropped) {
+			t.Errorf("%s: got\n%s dropped %v, want\n%s dropped %v", tt.name, got.SDP, got.Dropped, tt.want, tt.dropped)
+		}
+		if !slices.Equal(got.Sections, []string{"application UDP/DTLS/SCTP mid=0"}) {
+			t.Errorf("%s: got the sections %v", tt.name, got.Sections)
+		}
+	}
+
+	withMedia := testSDP(candidates, "audio", "video")
+	got, err := PolicyConfig{Candidates: candidatesAll}.sanitizeSDP(withMedia)
+	if err != nil || !slices.Equal(got.Sections, []string{"application UDP/DTLS/SCTP mid=0", "audio UDP/TLS/RTP/SAVPF mid=1", "video UDP/TLS/RTP/SAVPF mid=2"}) {
+		t.Errorf("got the sections %v, %v, want the data channel, audio and video", got.Sections, err)
+	}
+	if _, err := (PolicyConfig{Candidates: candidatesAll, DataChannelOnly: true}).sanitizeSDP(withMedia); err == nil {
+		t.Error("sanitized a description with audio and video for data channels only, want an error")
+	}
+	if _, err := (PolicyConfig{Candidates: candidatesAll}).sanitizeSDP("v=0\r\nnot a description"); err == nil {
+		t.Error("sanitized a malformed description, want an error")
+	}
+	if _, err := (PolicyConfig{Candidates: candidatesAll}).sanitizeSDP(testSDP([]string{"candidate:hello"})); err == nil {
+		t.Error("sanitized a description with a malformed candidate, want an error")
+	}
+}
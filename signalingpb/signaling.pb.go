@@ -0,0 +1,1051 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: signaling.proto
+
+// The gRPC API of the signaling server, for native and server-side clients. The Signal stream
+// speaks the v2 envelope of the WebSocket protocol in protobuf, and its users share the rooms
+// with the users of the other transports.
+
+package signalingpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A message of the client, like a v2 envelope.
+type ClientMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The message type, e.g. "initiation" or "offer".
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// An optional ID chosen by the client, echoed in the response to the message.
+	Id   string   `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Data *Payload `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	// The W3C trace context of a relayed message, sent back with the reply to it.
+	Trace         map[string]string `protobuf:"bytes,4,rep,name=trace,proto3" json:"trace,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClientMessage) Reset() {
+	*x = ClientMessage{}
+	mi := &file_signaling_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClientMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientMessage) ProtoMessage() {}
+
+func (x *ClientMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientMessage.ProtoReflect.Descriptor instead.
+func (*ClientMessage) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ClientMessage) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ClientMessage) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ClientMessage) GetData() *Payload {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ClientMessage) GetTrace() map[string]string {
+	if x != nil {
+		return x.Trace
+	}
+	return nil
+}
+
+// The payload of a client message. Each message type requires its own fields and no others.
+type Payload struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Name   string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	RoomId string                 `protobuf:"bytes,2,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	// "creator" or "participant".
+	Role          string              `protobuf:"bytes,3,opt,name=role,proto3" json:"role,omitempty"`
+	Offer         *SessionDescription `protobuf:"bytes,4,opt,name=offer,proto3" json:"offer,omitempty"`
+	Answer        *SessionDescription `protobuf:"bytes,5,opt,name=answer,proto3" json:"answer,omitempty"`
+	Candidate     *IceCandidate       `protobuf:"bytes,6,opt,name=candidate,proto3" json:"candidate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Payload) Reset() {
+	*x = Payload{}
+	mi := &file_signaling_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Payload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payload) ProtoMessage() {}
+
+func (x *Payload) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payload.ProtoReflect.Descriptor instead.
+func (*Payload) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Payload) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Payload) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *Payload) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *Payload) GetOffer() *SessionDescription {
+	if x != nil {
+		return x.Offer
+	}
+	return nil
+}
+
+func (x *Payload) GetAnswer() *SessionDescription {
+	if x != nil {
+		return x.Answer
+	}
+	return nil
+}
+
+func (x *Payload) GetCandidate() *IceCandidate {
+	if x != nil {
+		return x.Candidate
+	}
+	return nil
+}
+
+type SessionDescription struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Sdp           string                 `protobuf:"bytes,2,opt,name=sdp,proto3" json:"sdp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionDescription) Reset() {
+	*x = SessionDescription{}
+	mi := &file_signaling_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionDescription) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionDescription) ProtoMessage() {}
+
+func (x *SessionDescription) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionDescription.ProtoReflect.Descriptor instead.
+func (*SessionDescription) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SessionDescription) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *SessionDescription) GetSdp() string {
+	if x != nil {
+		return x.Sdp
+	}
+	return ""
+}
+
+type IceCandidate struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Candidate        string                 `protobuf:"bytes,1,opt,name=candidate,proto3" json:"candidate,omitempty"`
+	SdpMid           string                 `protobuf:"bytes,2,opt,name=sdp_mid,json=sdpMid,proto3" json:"sdp_mid,omitempty"`
+	SdpMLineIndex    int32                  `protobuf:"varint,3,opt,name=sdp_m_line_index,json=sdpMLineIndex,proto3" json:"sdp_m_line_index,omitempty"`
+	UsernameFragment string                 `protobuf:"bytes,4,opt,name=username_fragment,json=usernameFragment,proto3" json:"username_fragment,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *IceCandidate) Reset() {
+	*x = IceCandidate{}
+	mi := &file_signaling_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IceCandidate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IceCandidate) ProtoMessage() {}
+
+func (x *IceCandidate) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IceCandidate.ProtoReflect.Descriptor instead.
+func (*IceCandidate) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *IceCandidate) GetCandidate() string {
+	if x != nil {
+		return x.Candidate
+	}
+	return ""
+}
+
+func (x *IceCandidate) GetSdpMid() string {
+	if x != nil {
+		return x.SdpMid
+	}
+	return ""
+}
+
+func (x *IceCandidate) GetSdpMLineIndex() int32 {
+	if x != nil {
+		return x.SdpMLineIndex
+	}
+	return 0
+}
+
+func (x *IceCandidate) GetUsernameFragment() string {
+	if x != nil {
+		return x.UsernameFragment
+	}
+	return ""
+}
+
+// A message of the server: a response, a relayed message or a notice.
+type ServerMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Type  string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// The ID of the message this is the response to.
+	Id string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	// Whether the request succeeded. Unset in the messages that are no responses.
+	Ok *bool `protobuf:"varint,3,opt,name=ok,proto3,oneof" json:"ok,omitempty"`
+	// Why the request failed.
+	Error         *Error            `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	Data          *ServerPayload    `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	Trace         map[string]string `protobuf:"bytes,6,rep,name=trace,proto3" json:"trace,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerMessage) Reset() {
+	*x = ServerMessage{}
+	mi := &file_signaling_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerMessage) ProtoMessage() {}
+
+func (x *ServerMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerMessage.ProtoReflect.Descriptor instead.
+func (*ServerMessage) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ServerMessage) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ServerMessage) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ServerMessage) GetOk() bool {
+	if x != nil && x.Ok != nil {
+		return *x.Ok
+	}
+	return false
+}
+
+func (x *ServerMessage) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetData() *ServerPayload {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetTrace() map[string]string {
+	if x != nil {
+		return x.Trace
+	}
+	return nil
+}
+
+// The error of a failed request. The unary calls carry it in the details of their status.
+type Error struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The stable error code, see /api/errors.
+	Code    string        `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message string        `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Fields  []*FieldError `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty"`
+	// How long the client should wait before trying again.
+	RetryAfterMs  int64 `protobuf:"varint,4,opt,name=retry_after_ms,json=retryAfterMs,proto3" json:"retry_after_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_signaling_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetFields() []*FieldError {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *Error) GetRetryAfterMs() int64 {
+	if x != nil {
+		return x.RetryAfterMs
+	}
+	return 0
+}
+
+// A single invalid field of a client message.
+type FieldError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FieldError) Reset() {
+	*x = FieldError{}
+	mi := &file_signaling_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FieldError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldError) ProtoMessage() {}
+
+func (x *FieldError) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldError.ProtoReflect.Descriptor instead.
+func (*FieldError) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FieldError) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *FieldError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// The payload of a server message.
+type ServerPayload struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The sender of a relayed message or the user leaving the room.
+	Name      string              `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	RoomId    string              `protobuf:"bytes,2,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Role      string              `protobuf:"bytes,3,opt,name=role,proto3" json:"role,omitempty"`
+	Offer     *SessionDescription `protobuf:"bytes,4,opt,name=offer,proto3" json:"offer,omitempty"`
+	Answer    *SessionDescription `protobuf:"bytes,5,opt,name=answer,proto3" json:"answer,omitempty"`
+	Candidate *IceCandidate       `protobuf:"bytes,6,opt,name=candidate,proto3" json:"candidate,omitempty"`
+	// The other users of the joined room.
+	Participants []string `protobuf:"bytes,7,rep,name=participants,proto3" json:"participants,omitempty"`
+	// Whether the room is destroyed because its owner left.
+	RoomDestroy bool `protobuf:"varint,8,opt,name=room_destroy,json=roomDestroy,proto3" json:"room_destroy,omitempty"`
+	// A human readable message, e.g. of a leave confirmation.
+	Message string `protobuf:"bytes,9,opt,name=message,proto3" json:"message,omitempty"`
+	// How long the client should wait before reconnecting when the server is draining.
+	ReconnectAfterMs int64 `protobuf:"varint,10,opt,name=reconnect_after_ms,json=reconnectAfterMs,proto3" json:"reconnect_after_ms,omitempty"`
+	// The session token of the stream, in the first message.
+	Session       string `protobuf:"bytes,11,opt,name=session,proto3" json:"session,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerPayload) Reset() {
+	*x = ServerPayload{}
+	mi := &file_signaling_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerPayload) ProtoMessage() {}
+
+func (x *ServerPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerPayload.ProtoReflect.Descriptor instead.
+func (*ServerPayload) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ServerPayload) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ServerPayload) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *ServerPayload) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *ServerPayload) GetOffer() *SessionDescription {
+	if x != nil {
+		return x.Offer
+	}
+	return nil
+}
+
+func (x *ServerPayload) GetAnswer() *SessionDescription {
+	if x != nil {
+		return x.Answer
+	}
+	return nil
+}
+
+func (x *ServerPayload) GetCandidate() *IceCandidate {
+	if x != nil {
+		return x.Candidate
+	}
+	return nil
+}
+
+func (x *ServerPayload) GetParticipants() []string {
+	if x != nil {
+		return x.Participants
+	}
+	return nil
+}
+
+func (x *ServerPayload) GetRoomDestroy() bool {
+	if x != nil {
+		return x.RoomDestroy
+	}
+	return false
+}
+
+func (x *ServerPayload) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ServerPayload) GetReconnectAfterMs() int64 {
+	if x != nil {
+		return x.ReconnectAfterMs
+	}
+	return 0
+}
+
+func (x *ServerPayload) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+type CreateRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRoomRequest) Reset() {
+	*x = CreateRoomRequest{}
+	mi := &file_signaling_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRoomRequest) ProtoMessage() {}
+
+func (x *CreateRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRoomRequest.ProtoReflect.Descriptor instead.
+func (*CreateRoomRequest) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CreateRoomRequest) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+type GetRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRoomRequest) Reset() {
+	*x = GetRoomRequest{}
+	mi := &file_signaling_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRoomRequest) ProtoMessage() {}
+
+func (x *GetRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRoomRequest.ProtoReflect.Descriptor instead.
+func (*GetRoomRequest) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetRoomRequest) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+type Room struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	RoomId string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	// The name of the user that created the room.
+	Owner string `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`
+	// The number of users in the room, the owner included.
+	Size          int32 `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Room) Reset() {
+	*x = Room{}
+	mi := &file_signaling_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Room) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Room) ProtoMessage() {}
+
+func (x *Room) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Room.ProtoReflect.Descriptor instead.
+func (*Room) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Room) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *Room) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Room) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type ListParticipantsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListParticipantsRequest) Reset() {
+	*x = ListParticipantsRequest{}
+	mi := &file_signaling_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListParticipantsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListParticipantsRequest) ProtoMessage() {}
+
+func (x *ListParticipantsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListParticipantsRequest.ProtoReflect.Descriptor instead.
+func (*ListParticipantsRequest) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListParticipantsRequest) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+type ListParticipantsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The names of the users in the room, the owner first.
+	Participants  []string `protobuf:"bytes,1,rep,name=participants,proto3" json:"participants,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListParticipantsResponse) Reset() {
+	*x = ListParticipantsResponse{}
+	mi := &file_signaling_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListParticipantsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListParticipantsResponse) ProtoMessage() {}
+
+func (x *ListParticipantsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListParticipantsResponse.ProtoReflect.Descriptor instead.
+func (*ListParticipantsResponse) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListParticipantsResponse) GetParticipants() []string {
+	if x != nil {
+		return x.Participants
+	}
+	return nil
+}
+
+var File_signaling_proto protoreflect.FileDescriptor
+
+const file_signaling_proto_rawDesc = "" +
+	"\n" +
+	"\x0fsignaling.proto\x12\x14piirtul.signaling.v1\"\xe6\x01\n" +
+	"\rClientMessage\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x121\n" +
+	"\x04data\x18\x03 \x01(\v2\x1d.piirtul.signaling.v1.PayloadR\x04data\x12D\n" +
+	"\x05trace\x18\x04 \x03(\v2..piirtul.signaling.v1.ClientMessage.TraceEntryR\x05trace\x1a8\n" +
+	"\n" +
+	"TraceEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8e\x02\n" +
+	"\aPayload\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x17\n" +
+	"\aroom_id\x18\x02 \x01(\tR\x06roomId\x12\x12\n" +
+	"\x04role\x18\x03 \x01(\tR\x04role\x12>\n" +
+	"\x05offer\x18\x04 \x01(\v2(.piirtul.signaling.v1.SessionDescriptionR\x05offer\x12@\n" +
+	"\x06answer\x18\x05 \x01(\v2(.piirtul.signaling.v1.SessionDescriptionR\x06answer\x12@\n" +
+	"\tcandidate\x18\x06 \x01(\v2\".piirtul.signaling.v1.IceCandidateR\tcandidate\":\n" +
+	"\x12SessionDescription\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x10\n" +
+	"\x03sdp\x18\x02 \x01(\tR\x03sdp\"\x9b\x01\n" +
+	"\fIceCandidate\x12\x1c\n" +
+	"\tcandidate\x18\x01 \x01(\tR\tcandidate\x12\x17\n" +
+	"\asdp_mid\x18\x02 \x01(\tR\x06sdpMid\x12'\n" +
+	"\x10sdp_m_line_index\x18\x03 \x01(\x05R\rsdpMLineIndex\x12+\n" +
+	"\x11username_fragment\x18\x04 \x01(\tR\x10usernameFragment\"\xbb\x02\n" +
+	"\rServerMessage\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x13\n" +
+	"\x02ok\x18\x03 \x01(\bH\x00R\x02ok\x88\x01\x01\x121\n" +
+	"\x05error\x18\x04 \x01(\v2\x1b.piirtul.signaling.v1.ErrorR\x05error\x127\n" +
+	"\x04data\x18\x05 \x01(\v2#.piirtul.signaling.v1.ServerPayloadR\x04data\x12D\n" +
+	"\x05trace\x18\x06 \x03(\v2..piirtul.signaling.v1.ServerMessage.TraceEntryR\x05trace\x1a8\n" +
+	"\n" +
+	"TraceEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x05\n" +
+	"\x03_ok\"\x95\x01\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x128\n" +
+	"\x06fields\x18\x03 \x03(\v2 .piirtul.signaling.v1.FieldErrorR\x06fields\x12$\n" +
+	"\x0eretry_after_ms\x18\x04 \x01(\x03R\fretryAfterMs\"<\n" +
+	"\n" +
+	"FieldError\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\xbd\x03\n" +
+	"\rServerPayload\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x17\n" +
+	"\aroom_id\x18\x02 \x01(\tR\x06roomId\x12\x12\n" +
+	"\x04role\x18\x03 \x01(\tR\x04role\x12>\n" +
+	"\x05offer\x18\x04 \x01(\v2(.piirtul.signaling.v1.SessionDescriptionR\x05offer\x12@\n" +
+	"\x06answer\x18\x05 \x01(\v2(.piirtul.signaling.v1.SessionDescriptionR\x06answer\x12@\n" +
+	"\tcandidate\x18\x06 \x01(\v2\".piirtul.signaling.v1.IceCandidateR\tcandidate\x12\"\n" +
+	"\fparticipants\x18\a \x03(\tR\fparticipants\x12!\n" +
+	"\froom_destroy\x18\b \x01(\bR\vroomDestroy\x12\x18\n" +
+	"\amessage\x18\t \x01(\tR\amessage\x12,\n" +
+	"\x12reconnect_after_ms\x18\n" +
+	" \x01(\x03R\x10reconnectAfterMs\x12\x18\n" +
+	"\asession\x18\v \x01(\tR\asession\",\n" +
+	"\x11CreateRoomRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\")\n" +
+	"\x0eGetRoomRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\"I\n" +
+	"\x04Room\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x14\n" +
+	"\x05owner\x18\x02 \x01(\tR\x05owner\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x05R\x04size\"2\n" +
+	"\x17ListParticipantsRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\">\n" +
+	"\x18ListParticipantsResponse\x12\"\n" +
+	"\fparticipants\x18\x01 \x03(\tR\fparticipants2\xf6\x02\n" +
+	"\tSignaling\x12V\n" +
+	"\x06Signal\x12#.piirtul.signaling.v1.ClientMessage\x1a#.piirtul.signaling.v1.ServerMessage(\x010\x01\x12Q\n" +
+	"\n" +
+	"CreateRoom\x12'.piirtul.signaling.v1.CreateRoomRequest\x1a\x1a.piirtul.signaling.v1.Room\x12K\n" +
+	"\aGetRoom\x12$.piirtul.signaling.v1.GetRoomRequest\x1a\x1a.piirtul.signaling.v1.Room\x12q\n" +
+	"\x10ListParticipants\x12-.piirtul.signaling.v1.ListParticipantsRequest\x1a..piirtul.signaling.v1.ListParticipantsResponseB\x17Z\x15signaling/signalingpbb\x06proto3"
+
+var (
+	file_signaling_proto_rawDescOnce sync.Once
+	file_signaling_proto_rawDescData []byte
+)
+
+func file_signaling_proto_rawDescGZIP() []byte {
+	file_signaling_proto_rawDescOnce.Do(func() {
+		file_signaling_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_signaling_proto_rawDesc), len(file_signaling_proto_rawDesc)))
+	})
+	return file_signaling_proto_rawDescData
+}
+
+var file_signaling_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_signaling_proto_goTypes = []any{
+	(*ClientMessage)(nil),            // 0: piirtul.signaling.v1.ClientMessage
+	(*Payload)(nil),                  // 1: piirtul.signaling.v1.Payload
+	(*SessionDescription)(nil),       // 2: piirtul.signaling.v1.SessionDescription
+	(*IceCandidate)(nil),             // 3: piirtul.signaling.v1.IceCandidate
+	(*ServerMessage)(nil),            // 4: piirtul.signaling.v1.ServerMessage
+	(*Error)(nil),                    // 5: piirtul.signaling.v1.Error
+	(*FieldError)(nil),               // 6: piirtul.signaling.v1.FieldError
+	(*ServerPayload)(nil),            // 7: piirtul.signaling.v1.ServerPayload
+	(*CreateRoomRequest)(nil),        // 8: piirtul.signaling.v1.CreateRoomRequest
+	(*GetRoomRequest)(nil),           // 9: piirtul.signaling.v1.GetRoomRequest
+	(*Room)(nil),                     // 10: piirtul.signaling.v1.Room
+	(*ListParticipantsRequest)(nil),  // 11: piirtul.signaling.v1.ListParticipantsRequest
+	(*ListParticipantsResponse)(nil), // 12: piirtul.signaling.v1.ListParticipantsResponse
+	nil,                              // 13: piirtul.signaling.v1.ClientMessage.TraceEntry
+	nil,                              // 14: piirtul.signaling.v1.ServerMessage.TraceEntry
+}
+var file_signaling_proto_depIdxs = []int32{
+	1,  // 0: piirtul.signaling.v1.ClientMessage.data:type_name -> piirtul.signaling.v1.Payload
+	13, // 1: piirtul.signaling.v1.ClientMessage.trace:type_name -> piirtul.signaling.v1.ClientMessage.TraceEntry
+	2,  // 2: piirtul.signaling.v1.Payload.offer:type_name -> piirtul.signaling.v1.SessionDescription
+	2,  // 3: piirtul.signaling.v1.Payload.answer:type_name -> piirtul.signaling.v1.SessionDescription
+	3,  // 4: piirtul.signaling.v1.Payload.candidate:type_name -> piirtul.signaling.v1.IceCandidate
+	5,  // 5: piirtul.signaling.v1.ServerMessage.error:type_name -> piirtul.signaling.v1.Error
+	7,  // 6: piirtul.signaling.v1.ServerMessage.data:type_name -> piirtul.signaling.v1.ServerPayload
+	14, // 7: piirtul.signaling.v1.ServerMessage.trace:type_name -> piirtul.signaling.v1.ServerMessage.TraceEntry
+	6,  // 8: piirtul.signaling.v1.Error.fields:type_name -> piirtul.signaling.v1.FieldError
+	2,  // 9: piirtul.signaling.v1.ServerPayload.offer:type_name -> piirtul.signaling.v1.SessionDescription
+	2,  // 10: piirtul.signaling.v1.ServerPayload.answer:type_name -> piirtul.signaling.v1.SessionDescription
+	3,  // 11: piirtul.signaling.v1.ServerPayload.candidate:type_name -> piirtul.signaling.v1.IceCandidate
+	0,  // 12: piirtul.signaling.v1.Signaling.Signal:input_type -> piirtul.signaling.v1.ClientMessage
+	8,  // 13: piirtul.signaling.v1.Signaling.CreateRoom:input_type -> piirtul.signaling.v1.CreateRoomRequest
+	9,  // 14: piirtul.signaling.v1.Signaling.GetRoom:input_type -> piirtul.signaling.v1.GetRoomRequest
+	11, // 15: piirtul.signaling.v1.Signaling.ListParticipants:input_type -> piirtul.signaling.v1.ListParticipantsRequest
+	4,  // 16: piirtul.signaling.v1.Signaling.Signal:output_type -> piirtul.signaling.v1.ServerMessage
+	10, // 17: piirtul.signaling.v1.Signaling.CreateRoom:output_type -> piirtul.signaling.v1.Room
+	10, // 18: piirtul.signaling.v1.Signaling.GetRoom:output_type -> piirtul.signaling.v1.Room
+	12, // 19: piirtul.signaling.v1.Signaling.ListParticipants:output_type -> piirtul.signaling.v1.ListParticipantsResponse
+	16, // [16:20] is the sub-list for method output_type
+	12, // [12:16] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_signaling_proto_init() }
+func file_signaling_proto_init() {
+	if File_signaling_proto != nil {
+		return
+	}
+	file_signaling_proto_msgTypes[4].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_signaling_proto_rawDesc), len(file_signaling_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_signaling_proto_goTypes,
+		DependencyIndexes: file_signaling_proto_depIdxs,
+		MessageInfos:      file_signaling_proto_msgTypes,
+	}.Build()
+	File_signaling_proto = out.File
+	file_signaling_proto_goTypes = nil
+	file_signaling_proto_depIdxs = nil
+}
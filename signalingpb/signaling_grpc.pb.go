@@ -0,0 +1,250 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: signaling.proto
+
+// The gRPC API of the signaling server, for native and server-side clients. The Signal stream
+// speaks the v2 envelope of the WebSocket protocol in protobuf, and its users share the rooms
+// with the users of the other transports.
+
+package signalingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Signaling_Signal_FullMethodName           = "/piirtul.signaling.v1.Signaling/Signal"
+	Signaling_CreateRoom_FullMethodName       = "/piirtul.signaling.v1.Signaling/CreateRoom"
+	Signaling_GetRoom_FullMethodName          = "/piirtul.signaling.v1.Signaling/GetRoom"
+	Signaling_ListParticipants_FullMethodName = "/piirtul.signaling.v1.Signaling/ListParticipants"
+)
+
+// SignalingClient is the client API for Signaling service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SignalingClient interface {
+	// Signals as one user, with the messages of the WebSocket protocol: an initiation, a
+	// roomInitiation, offers, answers and candidates to the other users of the room, and a
+	// leaveRoom. The first message of the server is a session message with the token the unary
+	// calls of the user carry in the x-piirtul-session metadata.
+	Signal(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ClientMessage, ServerMessage], error)
+	// Creates a room owned by the user of the session, like a roomInitiation as the creator. The
+	// user must be in no room.
+	CreateRoom(ctx context.Context, in *CreateRoomRequest, opts ...grpc.CallOption) (*Room, error)
+	// Gets a room, with its owner and size. Only the users of the room may get it.
+	GetRoom(ctx context.Context, in *GetRoomRequest, opts ...grpc.CallOption) (*Room, error)
+	// Lists the users of a room. Only the users of the room may list them.
+	ListParticipants(ctx context.Context, in *ListParticipantsRequest, opts ...grpc.CallOption) (*ListParticipantsResponse, error)
+}
+
+type signalingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSignalingClient(cc grpc.ClientConnInterface) SignalingClient {
+	return &signalingClient{cc}
+}
+
+func (c *signalingClient) Signal(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ClientMessage, ServerMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Signaling_ServiceDesc.Streams[0], Signaling_Signal_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ClientMessage, ServerMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Signaling_SignalClient = grpc.BidiStreamingClient[ClientMessage, ServerMessage]
+
+func (c *signalingClient) CreateRoom(ctx context.Context, in *CreateRoomRequest, opts ...grpc.CallOption) (*Room, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Room)
+	err := c.cc.Invoke(ctx, Signaling_CreateRoom_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signalingClient) GetRoom(ctx context.Context, in *GetRoomRequest, opts ...grpc.CallOption) (*Room, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Room)
+	err := c.cc.Invoke(ctx, Signaling_GetRoom_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signalingClient) ListParticipants(ctx context.Context, in *ListParticipantsRequest, opts ...grpc.CallOption) (*ListParticipantsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListParticipantsResponse)
+	err := c.cc.Invoke(ctx, Signaling_ListParticipants_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SignalingServer is the server API for Signaling service.
+// All implementations must embed UnimplementedSignalingServer
+// for forward compatibility.
+type SignalingServer interface {
+	// Signals as one user, with the messages of the WebSocket protocol: an initiation, a
+	// roomInitiation, offers, answers and candidates to the other users of the room, and a
+	// leaveRoom. The first message of the server is a session message with the token the unary
+	// calls of the user carry in the x-piirtul-session metadata.
+	Signal(grpc.BidiStreamingServer[ClientMessage, ServerMessage]) error
+	// Creates a room owned by the user of the session, like a roomInitiation as the creator. The
+	// user must be in no room.
+	CreateRoom(context.Context, *CreateRoomRequest) (*Room, error)
+	// Gets a room, with its owner and size. Only the users of the room may get it.
+	GetRoom(context.Context, *GetRoomRequest) (*Room, error)
+	// Lists the users of a room. Only the users of the room may list them.
+	ListParticipants(context.Context, *ListParticipantsRequest) (*ListParticipantsResponse, error)
+	mustEmbedUnimplementedSignalingServer()
+}
+
+// UnimplementedSignalingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSignalingServer struct{}
+
+func (UnimplementedSignalingServer) Signal(grpc.BidiStreamingServer[ClientMessage, ServerMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method Signal not implemented")
+}
+func (UnimplementedSignalingServer) CreateRoom(context.Context, *CreateRoomRequest) (*Room, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRoom not implemented")
+}
+func (UnimplementedSignalingServer) GetRoom(context.Context, *GetRoomRequest) (*Room, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRoom not implemented")
+}
+func (UnimplementedSignalingServer) ListParticipants(context.Context, *ListParticipantsRequest) (*ListParticipantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListParticipants not implemented")
+}
+func (UnimplementedSignalingServer) mustEmbedUnimplementedSignalingServer() {}
+func (UnimplementedSignalingServer) testEmbeddedByValue()                   {}
+
+// UnsafeSignalingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SignalingServer will
+// result in compilation errors.
+type UnsafeSignalingServer interface {
+	mustEmbedUnimplementedSignalingServer()
+}
+
+func RegisterSignalingServer(s grpc.ServiceRegistrar, srv SignalingServer) {
+	// If the following call pancis, it indicates UnimplementedSignalingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Signaling_ServiceDesc, srv)
+}
+
+func _Signaling_Signal_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SignalingServer).Signal(&grpc.GenericServerStream[ClientMessage, ServerMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Signaling_SignalServer = grpc.BidiStreamingServer[ClientMessage, ServerMessage]
+
+func _Signaling_CreateRoom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRoomRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignalingServer).CreateRoom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Signaling_CreateRoom_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignalingServer).CreateRoom(ctx, req.(*CreateRoomRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signaling_GetRoom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRoomRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignalingServer).GetRoom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Signaling_GetRoom_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignalingServer).GetRoom(ctx, req.(*GetRoomRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signaling_ListParticipants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListParticipantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignalingServer).ListParticipants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Signaling_ListParticipants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignalingServer).ListParticipants(ctx, req.(*ListParticipantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Signaling_ServiceDesc is the grpc.ServiceDesc for Signaling service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Signaling_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "piirtul.signaling.v1.Signaling",
+	HandlerType: (*SignalingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateRoom",
+			Handler:    _Signaling_CreateRoom_Handler,
+		},
+		{
+			MethodName: "GetRoom",
+			Handler:    _Signaling_GetRoom_Handler,
+		},
+		{
+			MethodName: "ListParticipants",
+			Handler:    _Signaling_ListParticipants_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Signal",
+			Handler:       _Signaling_Signal_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "signaling.proto",
+}
@@ -0,0 +1,5 @@
+// Package signalingpb has the gRPC API of the piirtul.io signaling server, generated from
+// signaling.proto. Run go generate after changing it.
+package signalingpb
+
+//go:generate go run ../tools/protogen signaling.proto
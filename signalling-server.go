@@ -2,9 +2,12 @@ package main
 
 import (
 	"errors"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // The server instance
@@ -12,27 +15,122 @@ type SignalingServer struct {
 	users    []*User
 	rooms    *RoomService
 	upgrader websocket.Upgrader
-	mux      sync.Mutex
+	activity *ActivityMonitor
+	metrics  *Metrics
+	logger   *slog.Logger
+	tracer   trace.Tracer
+	limits   LimitsConfig
+	// Routes the socket messages to their handlers.
+	router *MessageRouter
+	// The per connection limits by message type.
+	messageLimits map[string]RateLimit
+	policy        PolicyConfig
+	mux           sync.Mutex
+	// The sessions of the open connections.
+	sessions   map[*Session]struct{}
+	sessionMux sync.Mutex
+	// The transports of the event stream sessions by their session token.
+	eventStreams   map[string]*EventStreamTransport
+	eventStreamMux sync.Mutex
+	draining       atomic.Bool
 }
 
-// The User struct. Each User contains its name, its peer's name, and the WebSocket connection.
+// An open connection: the transport carrying it and the protocol spoken over it.
+type Session struct {
+	transport Transport
+	// Serializes writes, since the sessions are written to from the goroutines of other users too.
+	writeMux sync.Mutex
+	// The negotiated protocol version.
+	protocol ProtocolAdapter
+}
+
+// Creates a session speaking the protocol over the transport.
+func NewSession(transport Transport, protocol ProtocolAdapter) *Session {
+	return &Session{transport: transport, protocol: protocol}
+}
+
+// Reads the next message. Frames that can't be decoded return the decoding error along with
+// whatever could be decoded, so the error can be answered.
+func (s *Session) Receive() (SocketMessage, error) {
+	frame, err := s.transport.ReadFrame()
+	if err != nil {
+		return SocketMessage{}, &receiveError{err}
+	}
+	return s.protocol.Decode(frame)
+}
+
+// Encodes the message in the protocol of the session and writes it. Writes are serialized.
+func (s *Session) Send(message any) error {
+	frame, err := s.protocol.Encode(message)
+	if err != nil {
+		return err
+	}
+
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+
+	return s.transport.WriteFrame(s.protocol.FrameType(), frame)
+}
+
+// Closes the transport of the session.
+func (s *Session) Close() error {
+	return s.transport.Close()
+}
+
+// Returns the address of the client.
+func (s *Session) RemoteAddr() string {
+	return s.transport.RemoteAddr()
+}
+
+// An error of the transport while receiving, as opposed to a message that could not be decoded.
+type receiveError struct {
+	err error
+}
+
+func (e *receiveError) Error() string {
+	return e.err.Error()
+}
+
+func (e *receiveError) Unwrap() error {
+	return e.err
+}
+
+// The User struct. Each User contains its name and the session of its connection.
 type User struct {
-	Name string
-	Conn *websocket.Conn
+	Name    string
+	Session *Session
 }
 
+// Error returned when the maximum number of users is reached.
+var errTooManyUsers = errors.New("too many users")
+
 // Adds a new user to the list of connected users. The User struct contains the Connection and the Name.
-func (ss *SignalingServer) AddUser(conn *websocket.Conn, name string) {
+func (ss *SignalingServer) AddUser(session *Session, name string) error {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+
+	if ss.limits.MaxUsers > 0 && len(ss.users) >= ss.limits.MaxUsers {
+		return errTooManyUsers
+	}
+	ss.users = append(ss.users, &User{Name: name, Session: session})
+	return nil
+}
+
+// Returns the number of connected users.
+func (ss *SignalingServer) UserCount() int {
 	ss.mux.Lock()
 	defer ss.mux.Unlock()
 
-	ss.users = append(ss.users, &User{Name: name, Conn: conn})
+	return len(ss.users)
 }
 
-// Returns a User associated with the given connection.
-func (ss *SignalingServer) UserFromConn(conn *websocket.Conn) *User {
+// Returns a User associated with the given session.
+func (ss *SignalingServer) UserFromSession(session *Session) *User {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+
 	for _, user := range ss.users {
-		if user.Conn == conn {
+		if user.Session == session {
 			return user
 		}
 	}
@@ -42,6 +140,9 @@ func (ss *SignalingServer) UserFromConn(conn *websocket.Conn) *User {
 
 // Returns a User with the specified name.
 func (ss *SignalingServer) UserFromName(name string) *User {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+
 	for _, user := range ss.users {
 		if user.Name == name {
 			return user
@@ -51,13 +152,13 @@ func (ss *SignalingServer) UserFromName(name string) *User {
 	return nil
 }
 
-// Removes user the user with this connection.
-func (ss *SignalingServer) RemoveUser(conn *websocket.Conn) error {
+// Removes user the user with this session.
+func (ss *SignalingServer) RemoveUser(session *Session) error {
 	ss.mux.Lock()
 	defer ss.mux.Unlock()
 
 	for i, user := range ss.users {
-		if user.Conn == conn {
+		if user.Session == session {
 			// Remove the user from the list by appending everything before and after the user
 			ss.users = append(ss.users[:i], ss.users[i+1:]...)
 			return nil
@@ -66,3 +167,42 @@ func (ss *SignalingServer) RemoveUser(conn *websocket.Conn) error {
 
 	return errors.New("user not found")
 }
+
+// Registers the session of an open connection.
+func (ss *SignalingServer) AddSession(session *Session) {
+	ss.sessionMux.Lock()
+	defer ss.sessionMux.Unlock()
+
+	if ss.sessions == nil {
+		ss.sessions = make(map[*Session]struct{})
+	}
+	ss.sessions[session] = struct{}{}
+}
+
+// Unregisters the session of a closed connection.
+func (ss *SignalingServer) RemoveSession(session *Session) {
+	ss.sessionMux.Lock()
+	defer ss.sessionMux.Unlock()
+
+	delete(ss.sessions, session)
+}
+
+// Returns the number of open connections.
+func (ss *SignalingServer) ConnCount() int {
+	ss.sessionMux.Lock()
+	defer ss.sessionMux.Unlock()
+
+	return len(ss.sessions)
+}
+
+// Returns the sessions of all open connections.
+func (ss *SignalingServer) Sessions() []*Session {
+	ss.sessionMux.Lock()
+	defer ss.sessionMux.Unlock()
+
+	sessions := make([]*Session, 0, len(ss.sessions))
+	for session := range ss.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
@@ -1,190 +1,207 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"log"
+	"net/http"
+	"strings"
+
+	"signaling/protocol"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Offer struct
-type Offer struct {
-	Type string `json:"type"`
-	Sdp  string `json:"sdp"`
-}
-
-// Answer struct
-type Answer struct {
-	Type string `json:"type"`
-	Sdp  string `json:"sdp"`
-}
-
-// Candidate struct
-type Candidate struct {
-	Candidate     string `json:"candidate"`
-	SdpMid        string `json:"sdpMid"`
-	SdpMLineIndex int    `json:"sdpMLineIndex"`
-}
-
-// A struct for incoming socket messages.
-type SocketMessage struct {
-	Type      string     `json:"type"`
-	RoomID    string     `json:"room_id,omitempty"`
-	Name      string     `json:"name,omitempty"`
-	Offer     *Offer     `json:"offer,omitempty"`
-	Answer    *Answer    `json:"answer,omitempty"`
-	Candidate *Candidate `json:"candidate,omitempty"`
-	Role      string     `json:"role,omitempty"`
-}
-
-// A struct for default outgoing messages.
-type SocketResponse struct {
-	Type    string `json:"type"`
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
-}
-
-// A more spesific struct for Room Initiation response, sending also participants and the RoomID
-type RoomSocketResponse struct {
-	Type         string   `json:"type"`
-	Success      bool     `json:"success"`
-	RoomID       string   `json:"room_id,omitempty"`
-	Participants []string `json:"participants,omitempty"`
-	Message      string   `json:"message,omitempty"`
-}
-
-// A more specific struct for LeavingResponse
-type LeavingResponse struct {
-	Type        string `json:"type"`
-	Name        string `json:"name"`
-	RoomDestroy bool   `json:"room_destroy"`
-}
+// The messages are shared with the Go client in the protocol package.
+type (
+	Offer              = protocol.Offer
+	Answer             = protocol.Answer
+	Candidate          = protocol.Candidate
+	SocketMessage      = protocol.SocketMessage
+	SocketResponse     = protocol.SocketResponse
+	RoomSocketResponse = protocol.RoomSocketResponse
+	LeavingResponse    = protocol.LeavingResponse
+)
 
 // Handler is a HTTP handler function that upgrades the HTTP request to a WebSocket connection,
 // routes WebSocket messages and manages the connection lifecycle.
 func (ss *SignalingServer) Handler(c echo.Context) error {
-	ws, err := ss.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	// Clients asking only for protocol versions the server doesn't speak are turned away,
+	// since they would close the connection anyway.
+	requested := websocket.Subprotocols(c.Request())
+	negotiated := negotiateProtocol(requested)
+	if len(requested) > 0 && negotiated == "" {
+		response := SocketResponse{Type: "error", Success: false, Error: codeUnsupportedProtocol, Message: "Supported protocols: " + strings.Join(supportedProtocols, ", ")}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+	// The upgrader has no subprotocols of its own, since it would pick the server's first choice
+	// instead of the client's.
+	var header http.Header
+	if negotiated != "" {
+		header = http.Header{"Sec-Websocket-Protocol": {negotiated}}
+	}
+	ws, err := ss.upgrader.Upgrade(c.Response(), c.Request(), header)
 	if err != nil {
 		return err
 	}
-	c.Logger().Debugf("%v accesses the server", ws.RemoteAddr())
+	ws.SetReadLimit(ss.limits.MaxMessageSize)
+	session := NewSession(NewWebSocketTransport(ws), protocolAdapter(ws.Subprotocol()))
+	return ss.Serve(c.Request().Context(), session)
+}
 
-	// Handle events/messages for this WebSocket connection
+// Serves a session until its connection ends: the messages are received and dispatched, and the user
+// leaves its room when the connection closes. Every transport hands its sessions to Serve.
+func (ss *SignalingServer) Serve(ctx context.Context, session *Session) error {
+	ss.sessionLogger(session).Debug("Connection opened", "protocol", session.protocol.Name())
+	ss.metrics.connections.Inc()
+	defer ss.metrics.connections.Dec()
+	ss.AddSession(session)
+	defer ss.RemoveSession(session)
+	defer session.Close()
+
+	// The connection span lives as long as the connection.
+	ctx, span := ss.tracer.Start(ctx, "websocket.connection", trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("piirtul.protocol", session.protocol.Name())))
+	defer span.End()
+
+	// Handle events/messages for this connection
+	limiter := NewMessageLimiter(ss.messageLimits)
 	for {
-		err := ss.connHandler(ws)
+		err := ss.sessionHandler(ctx, session, limiter)
 		if err != nil {
 			// Client closed the browser
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				user := ss.UserFromConn(ws)
-				if user == nil {
-					//c.Logger().Debugf("Connection closed for %v", ws.RemoteAddr())
-				} else {
-					ss.leaveEvent(ws)
-					//c.Logger().Debugf("Connection closed for user %v", user.Name)
+			if errors.Is(err, errClientClosed) {
+				ss.sessionLogger(session).Debug("Connection closed")
+				if ss.UserFromSession(session) != nil {
+					ss.leaveEvent(session, leaveClosed, "")
+				}
+				return nil
+			}
+			// The client sent a message over the read limit, the connection has been closed
+			if errors.Is(err, errFrameTooLarge) {
+				ss.sessionLogger(session).Warn("Connection closed for a message over the read limit", "limit", ss.limits.MaxMessageSize)
+				ss.activity.RecordError("connection", err)
+				if ss.UserFromSession(session) != nil {
+					ss.leaveEvent(session, leaveUnexpectedClose, "")
 				}
 				return nil
 			}
 			// Connection closed unexpectedly
-			if websocket.IsUnexpectedCloseError(err) {
-				//c.Logger().Errorf("Unexpected WebSocket closure for %v: %v", ws.RemoteAddr(), err)
-				ss.leaveEvent(ws)
+			if errors.Is(err, errConnectionLost) {
+				ss.sessionLogger(session).Warn("Connection closed unexpectedly", logKeyError, err)
+				ss.leaveEvent(session, leaveUnexpectedClose, "")
 				return err
 			}
 
 			// Log any other errors
-			c.Logger().Errorf("Error occurred while handling WebSocket connection: %v", err)
+			ss.sessionLogger(session).Error("Error occurred while handling the connection", logKeyError, err)
+			ss.activity.RecordError("connection", err)
+			if ss.UserFromSession(session) != nil {
+				ss.leaveEvent(session, leaveUnexpectedClose, "")
+			}
 			return err
 		}
 	}
 }
 
-// This is the handler for incoming WebSocket messages. The messages are read, and based on the message type
-// are then routed to their corresponding functions.
-func (ss *SignalingServer) connHandler(connection *websocket.Conn) error {
-	var message SocketMessage
-	_, raw, err := connection.ReadMessage()
-	if err != nil {
+// This is the handler for incoming messages. The messages are received, decoded, and then
+// routed to the handlers of their types by the message router.
+func (ss *SignalingServer) sessionHandler(ctx context.Context, session *Session, limiter *MessageLimiter) error {
+	message, err := session.Receive()
+	var receiveErr *receiveError
+	if errors.As(err, &receiveErr) {
 		return err
 	}
-	err = json.Unmarshal(raw, &message)
 	if err != nil {
-		response := SocketResponse{Type: "error", Success: false, Message: "Incorrect message format"}
-		return sendSocketResponse(connection, response)
+		ss.sessionLogger(session).Warn("Received a message with incorrect format", logKeyError, err)
+		ss.activity.RecordError("message", err)
+		return ss.sendSocketResponse(session, newValidationErrorResponse(err, message.RequestID))
 	}
 
-	// Handle different message types
-	switch message.Type {
-	case "initiation":
-		err = ss.initiationEvent(connection, message)
-	case "roomInitiation":
-		err = ss.roomInitiationEvent(connection, message)
-	case "offer":
-		err = ss.offerConnectionEvent(connection, message)
-	case "answer":
-		err = ss.answerConnectionEvent(connection, message)
-	case "candidate":
-		err = ss.candidateExchangingEvent(connection, message)
-	case "leaveRoom":
-		err = ss.leaveEvent(connection)
-	default:
-		err = unknownCommandEvent(connection)
+	// Return any errors from the router. Invalid messages and errors of the request are answered
+	// with their code and keep the connection open, other errors close it.
+	err = ss.router.Dispatch(ctx, session, message, limiter, ss.sessionLogger(session))
+	if err == nil {
+		return nil
 	}
-
-	// Return any errors from the event handlers
-	if err != nil {
-		SocketResponse := SocketResponse{Type: "error", Success: false, Message: err.Error()}
-		_ = sendSocketResponse(connection, SocketResponse)
-		return err
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return ss.sendSocketResponse(session, newValidationErrorResponse(err, message.RequestID))
 	}
-	return nil
+	var socketErr *SocketError
+	if errors.As(err, &socketErr) {
+		SocketResponse := SocketResponse{Type: "error", Success: false, Error: socketErr.Code, Message: socketErr.Message, RequestID: message.RequestID}
+		return ss.sendSocketResponse(session, SocketResponse)
+	}
+	SocketResponse := SocketResponse{Type: "error", Success: false, Error: codeInternal, Message: err.Error(), RequestID: message.RequestID}
+	_ = ss.sendSocketResponse(session, SocketResponse)
+	return err
 }
 
 // The initiationEvent adds the User with this connection to the server.
-func (ss *SignalingServer) initiationEvent(conn *websocket.Conn, data SocketMessage) error {
+func (ss *SignalingServer) initiationEvent(ctx context.Context, session *Session, data SocketMessage) error {
 	user := ss.UserFromName(data.Name)
 	if user != nil {
-		SocketResponse := SocketResponse{Type: "initiation", Success: false, Message: "User with the given name exists already"}
-		return sendSocketResponse(conn, SocketResponse)
+		SocketResponse := SocketResponse{Type: "initiation", Success: false, Error: codeNameTaken, Message: "User with the given name exists already", RequestID: data.RequestID}
+		return ss.sendSocketResponse(session, SocketResponse)
 	}
-	ss.AddUser(conn, data.Name)
-	log.Printf("[SERVER] Initialized for user %s", data.Name)
-	SocketResponse := SocketResponse{Type: "initiation", Success: true}
-	return sendSocketResponse(conn, SocketResponse)
+	if err := ss.AddUser(session, data.Name); err != nil {
+		SocketResponse := SocketResponse{Type: "initiation", Success: false, Error: codeServerFull, Message: "The server is full", RequestID: data.RequestID}
+		return ss.sendSocketResponse(session, SocketResponse)
+	}
+	ss.sessionLogger(session).Info("User initialized")
+	SocketResponse := SocketResponse{Type: "initiation", Success: true, RequestID: data.RequestID}
+	return ss.sendSocketResponse(session, SocketResponse)
 }
 
 // The roomInitiationEvent checks if a room with this ID exists, joins it, and sends the other participants. If we are a creator, we create the room first.
-func (ss *SignalingServer) roomInitiationEvent(conn *websocket.Conn, data SocketMessage) error {
-	user := ss.UserFromConn(conn)
-	if user == nil {
-		response := RoomSocketResponse{Type: "roomInitiation", Success: false, Message: "User does not exist"}
-		return sendSocketResponse(conn, response)
+func (ss *SignalingServer) roomInitiationEvent(ctx context.Context, session *Session, data SocketMessage) error {
+	failure := func(code, message string) error {
+		response := RoomSocketResponse{Type: "roomInitiation", Success: false, Error: code, Message: message, RequestID: data.RequestID}
+		return ss.sendSocketResponse(session, response)
 	}
 
+	// The route only lets initiated users through.
+	user := ss.UserFromSession(session)
+
 	//If we are a creator, create the room and return a success response.
 	if data.Role == "creator" {
 		_, err := ss.rooms.Create(user, data.RoomID)
+		if errors.Is(err, errTooManyRooms) {
+			return failure(codeTooManyRooms, "Too many rooms")
+		}
+		if errors.Is(err, errRoomExists) {
+			return failure(codeRoomExists, "A room with the given ID exists already")
+		}
+		if errors.Is(err, errUserInRoom) {
+			return failure(codeUnauthorized, "Leave the room first")
+		}
 		if err != nil {
-			response := RoomSocketResponse{Type: "roomInitiation", Success: false, Message: "Failed to create room"}
-			return sendSocketResponse(conn, response)
+			return failure(codeInternal, "Failed to create room")
 		}
-		log.Printf("[SERVER] %s created room %s\n", user.Name, data.RoomID)
-		response := RoomSocketResponse{Type: "roomInitiation", Success: true, RoomID: data.RoomID, Participants: []string{}}
-		return sendSocketResponse(conn, response)
+		ss.sessionLogger(session).Info("Room created", logKeyRoom, data.RoomID)
+		response := RoomSocketResponse{Type: "roomInitiation", Success: true, RoomID: data.RoomID, Participants: []string{}, RequestID: data.RequestID}
+		return ss.sendSocketResponse(session, response)
 
 		//If we are a participant, try to find that room, gather the participants and return the success with the other participants.
 	} else if data.Role == "participant" {
 		room, err := ss.rooms.Get(data.RoomID)
 		if err != nil || room == nil {
-			response := RoomSocketResponse{Type: "roomInitiation", Success: false, Message: "Room not found"}
-			return sendSocketResponse(conn, response)
+			return failure(codeRoomNotFound, "Room not found")
 		}
 
 		err = ss.rooms.Join(data.RoomID, user)
+		if errors.Is(err, errRoomFull) {
+			return failure(codeRoomFull, "Room is full")
+		}
+		if errors.Is(err, errUserInRoom) {
+			return failure(codeUnauthorized, "Leave the room first")
+		}
 		if err != nil {
-			response := RoomSocketResponse{Type: "roomInitiation", Success: false, Message: "Failed to join room"}
-			return sendSocketResponse(conn, response)
+			return failure(codeInternal, "Failed to join room")
 		}
 
 		participants := []string{}
@@ -193,185 +210,189 @@ func (ss *SignalingServer) roomInitiationEvent(conn *websocket.Conn, data Socket
 				participants = append(participants, roomUser.Name)
 			}
 		}
-		log.Printf("[%s] User '%s' joined\n", data.RoomID, user.Name)
-		response := RoomSocketResponse{Type: "roomInitiation", Success: true, RoomID: room.ID, Participants: participants}
-		return sendSocketResponse(conn, response)
+		ss.sessionLogger(session).Info("User joined", logKeyRoom, data.RoomID)
+		response := RoomSocketResponse{Type: "roomInitiation", Success: true, RoomID: room.ID, Participants: participants, RequestID: data.RequestID}
+		return ss.sendSocketResponse(session, response)
 
 	} else {
-		response := RoomSocketResponse{Type: "roomInitiation", Success: false, Message: "Invalid role"}
-		return sendSocketResponse(conn, response)
+		return failure(codeInvalidPayload, "Invalid role")
 	}
 }
 
-// Handler that forwards an offer from the sender to the receiver
-func (ss *SignalingServer) offerConnectionEvent(conn *websocket.Conn, data SocketMessage) error {
-	sender := ss.UserFromConn(conn)
+// Returns the sender of a relayed message, the receiver with the given name, and their room.
+// Messages are only relayed between the users of the same room.
+func (ss *SignalingServer) relayParties(session *Session, receiverName string) (*User, *User, *Room, error) {
+	sender := ss.UserFromSession(session)
 	if sender == nil {
-		return errors.New("the sender does not exist")
+		return nil, nil, nil, newSocketError(codeUnauthorized, "Initiate the user first")
+	}
+	room, err := ss.rooms.GetFirstRoomWithUser(sender)
+	if err != nil || room == nil {
+		return nil, nil, nil, newSocketError(codeUnauthorized, "Join a room first")
 	}
-	receiver := ss.UserFromName(data.Name)
+	receiver := ss.UserFromName(receiverName)
 	if receiver == nil {
-		return errors.New("the offer receiver does not exist")
+		return nil, nil, nil, newSocketError(codePeerNotFound, "The receiver does not exist")
 	}
-	SocketResponse := SocketMessage{
-		Type:  "offer",
-		Name:  sender.Name,
-		Offer: data.Offer,
+	receiverRoom, err := ss.rooms.GetFirstRoomWithUser(receiver)
+	if err != nil || receiverRoom == nil || receiverRoom.ID != room.ID {
+		return nil, nil, nil, newSocketError(codePeerNotFound, "The receiver is not in your room")
 	}
+	return sender, receiver, room, nil
+}
 
-	// Get the room room (for logging purposes only)
-	room, err := ss.rooms.GetFirstRoomWithUser(sender)
+// Handler that forwards an offer from the sender to the receiver
+func (ss *SignalingServer) offerConnectionEvent(ctx context.Context, session *Session, data SocketMessage) error {
+	sender, receiver, room, err := ss.relayParties(session, data.Name)
 	if err != nil {
+		ss.metrics.relayFailures.WithLabelValues("offer").Inc()
 		return err
 	}
-	log.Printf("[%s] Offer sent from '%s' to '%s'", room.ID, sender.Name, receiver.Name)
-	return sendSocketResponse(receiver.Conn, SocketResponse)
+	SocketResponse := SocketMessage{
+		Type:  "offer",
+		Name:  sender.Name,
+		Offer: data.Offer,
+	}
+	ss.sessionLogger(session).Info("Offer sent", logKeyRoom, room.ID, logKeyPeer, receiver.Name)
+	return ss.relay(ctx, receiver, SocketResponse)
 }
 
 // Handler that forwards an answer from the sender to the receiver.
-func (ss *SignalingServer) answerConnectionEvent(conn *websocket.Conn, data SocketMessage) error {
-	sender := ss.UserFromConn(conn)
-	if sender == nil {
-		return errors.New("the answer sender does not exist")
-	}
-	receiver := ss.UserFromName(data.Name)
-	if receiver == nil {
-		return errors.New("the answer receiver does not exist")
+func (ss *SignalingServer) answerConnectionEvent(ctx context.Context, session *Session, data SocketMessage) error {
+	sender, receiver, room, err := ss.relayParties(session, data.Name)
+	if err != nil {
+		ss.metrics.relayFailures.WithLabelValues("answer").Inc()
+		return err
 	}
 	SocketResponse := SocketMessage{
 		Type:   "answer",
 		Name:   sender.Name,
 		Answer: data.Answer,
 	}
-
-	// Get the room room (for logging purposes only)
-	room, err := ss.rooms.GetFirstRoomWithUser(sender)
-	if err != nil {
-		return err
-	}
-	log.Printf("[%s] Answer sent from '%s' to '%s'", room.ID, sender.Name, receiver.Name)
-	return sendSocketResponse(receiver.Conn, SocketResponse)
+	ss.sessionLogger(session).Info("Answer sent", logKeyRoom, room.ID, logKeyPeer, receiver.Name)
+	return ss.relay(ctx, receiver, SocketResponse)
 }
 
 // Handler that forwards ICE candidates from the sender to the receiver.
-func (ss *SignalingServer) candidateExchangingEvent(conn *websocket.Conn, data SocketMessage) error {
-	sender := ss.UserFromConn(conn)
-	if sender == nil {
-		return errors.New("the candidate sender does not exist")
-	}
-	receiver := ss.UserFromName(data.Name)
-	if receiver == nil {
-		return errors.New("the candidate receiver does not exist")
+func (ss *SignalingServer) candidateExchangingEvent(ctx context.Context, session *Session, data SocketMessage) error {
+	sender, receiver, room, err := ss.relayParties(session, data.Name)
+	if err != nil {
+		ss.metrics.relayFailures.WithLabelValues("candidate").Inc()
+		return err
 	}
 	sm := SocketMessage{
 		Type:      "candidate",
 		Name:      sender.Name,
 		Candidate: data.Candidate,
 	}
-	err := sendSocketResponse(receiver.Conn, sm)
-	if err != nil {
-		return err
-	}
-
-	// Get the room room (for logging purposes only)
-	room, err := ss.rooms.GetFirstRoomWithUser(sender)
-	if err != nil {
+	if err := ss.relay(ctx, receiver, sm); err != nil {
 		return err
 	}
-	log.Printf("[%s] Candidate sent from '%s' to '%s'", room.ID, sender.Name, receiver.Name)
+	ss.sessionLogger(session).Debug("Candidate sent", logKeyRoom, room.ID, logKeyPeer, receiver.Name)
 	return nil
 }
 
-func (ss *SignalingServer) leaveEvent(conn *websocket.Conn) error {
-	if conn == nil {
-		return errors.New("invalid connection")
+// Handler for the leaveRoom message.
+func (ss *SignalingServer) leaveRoomEvent(ctx context.Context, session *Session, data SocketMessage) error {
+	return ss.leaveEvent(session, leaveRequested, data.RequestID)
+}
+
+// Handler that removes the user from its room and the server. The reason is only used for metrics.
+// The request ID is echoed in the confirmation.
+func (ss *SignalingServer) leaveEvent(session *Session, reason, requestID string) error {
+	if session == nil {
+		return errors.New("invalid session")
 	}
+	ss.metrics.leaves.WithLabelValues(reason).Inc()
 
-	leavingUser := ss.UserFromConn(conn)
+	logger := ss.sessionLogger(session)
+	leavingUser := ss.UserFromSession(session)
 	if leavingUser == nil {
-		log.Println("[SERVER] Leaving user is nil")
+		logger.Warn("Leaving user does not exist")
 		return errors.New("the leaving user does not exist")
 	}
 
-	log.Printf("[SERVER] User %s is attempting to leave", leavingUser.Name)
+	logger.Info("User is attempting to leave", "reason", reason)
 
 	// Attempt to get the user's room
 	room, err := ss.rooms.GetFirstRoomWithUser(leavingUser)
 	if err != nil {
-		log.Printf("[SERVER] Error finding room for user %s: %v", leavingUser.Name, err)
+		logger.Error("Error finding room for user", logKeyError, err)
 	}
 
 	roomDestroy := false
 	if room != nil {
 		// Check if room should be destroyed
 		roomDestroy = room.Owner != nil && room.Owner == leavingUser
-		log.Printf("[%s] User %s is leaving the room. Room is going to shut down: %t", room.ID, leavingUser.Name, roomDestroy)
+		logger = logger.With(logKeyRoom, room.ID)
+		logger.Info("User is leaving the room", "room_destroy", roomDestroy)
 
 		// Notify other participants
 		leavingResponse := LeavingResponse{Type: "peerLeavingRoom", Name: leavingUser.Name, RoomDestroy: roomDestroy}
 		for _, user := range room.Users {
-			if user == nil || user.Conn == nil || user.Name == leavingUser.Name {
+			if user == nil || user.Session == nil || user.Name == leavingUser.Name {
 				continue
 			}
-			err := sendSocketResponse(user.Conn, leavingResponse)
+			err := ss.sendSocketResponse(user.Session, leavingResponse)
 			if err != nil {
-				log.Printf("[%s] Failed to send leaving notification to user %s: %v", room.ID, user.Name, err)
+				ss.metrics.relayFailures.WithLabelValues("peerLeavingRoom").Inc()
+				logger.Warn("Failed to send leaving notification", logKeyPeer, user.Name, logKeyError, err)
 				continue
 			}
-			log.Printf("[%s] Sent leaving notification to user %s", room.ID, user.Name)
+			logger.Debug("Sent leaving notification", logKeyPeer, user.Name)
 		}
 
 		// Remove room if needed
 		if roomDestroy {
 			if err := ss.rooms.DeleteRoom(room.ID); err != nil {
-				log.Printf("[%s] Failed to delete room: %v", room.ID, err)
+				logger.Error("Failed to delete room", logKeyError, err)
 			} else {
-				log.Printf("[%s] Room deleted because owner %s left", room.ID, leavingUser.Name)
+				logger.Info("Room deleted because the owner left")
 			}
 		} else {
 			if err := ss.rooms.RemoveUserFromRoom(room.ID, leavingUser); err != nil {
-				log.Printf("[%s] Failed to remove user from room: %v", room.ID, err)
+				logger.Error("Failed to remove user from room", logKeyError, err)
 			}
 		}
 	} else {
-		log.Printf("[SERVER] Room not found for user %s. Proceeding with user removal only.", leavingUser.Name)
+		logger.Info("Room not found for user, proceeding with user removal only")
 	}
 
 	// Remove user from server
-	if err := ss.RemoveUser(conn); err != nil {
-		log.Printf("[SERVER] Failed to remove user from server %s: %v", leavingUser.Name, err)
+	if err := ss.RemoveUser(session); err != nil {
+		logger.Error("Failed to remove user from server", logKeyError, err)
 		return err
 	}
 
 	// Send leave confirmation response to the leaving user
-	confirmationResponse := SocketResponse{Type: "leaveConfirmed", Success: true, Message: "User successfully left the room"}
-	err = sendSocketResponse(conn, confirmationResponse)
+	confirmationResponse := SocketResponse{Type: "leaveConfirmed", Success: true, Message: "User successfully left the room", RequestID: requestID}
+	err = ss.sendSocketResponse(session, confirmationResponse)
 	if err != nil {
-		log.Printf("[SERVER] Failed to send confirmation: %v", err)
+		logger.Warn("Failed to send leave confirmation", logKeyError, err)
 	}
 
-	conn.Close()
+	session.Close()
 	return err
 }
 
-// Handler for messages with unknown commands. Returns an error message.
-func unknownCommandEvent(conn *websocket.Conn) error {
-	log.Printf("[SERVER] Received an unknown command")
-	SocketResponse := SocketResponse{Type: "error", Success: false, Message: "Unrecognized command"}
-	return sendSocketResponse(conn, SocketResponse)
-}
+// Relays a message to its receiver within a span of its own. The trace context of the span travels
+// along with the message, so the receiver can continue the trace in its reply.
+func (ss *SignalingServer) relay(ctx context.Context, receiver *User, message SocketMessage) error {
+	ctx, span := ss.tracer.Start(ctx, "relay "+message.Type, trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
 
-// A helper function that Marshals data to JSON and sends it to the WebSocket.
-// Returns nil if no errors, otherwise returns the error.
-func sendSocketResponse(conn *websocket.Conn, data interface{}) error {
-	SocketResponse, err := json.Marshal(data)
+	injectTraceContext(ctx, &message)
+	err := ss.sendSocketResponse(receiver.Session, message)
 	if err != nil {
-		return err
+		ss.metrics.relayFailures.WithLabelValues(message.Type).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
+	return err
+}
 
-	err = conn.WriteMessage(websocket.TextMessage, SocketResponse)
-	if err != nil {
-		return err
-	}
-	return nil
+// A helper function that encodes data in the protocol of the session and sends it.
+// Writes to the same session are serialized. Returns nil if no errors, otherwise returns the error.
+func (ss *SignalingServer) sendSocketResponse(session *Session, data interface{}) error {
+	return session.Send(data)
 }
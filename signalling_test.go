@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A client of a session on an in-memory transport, speaking the legacy protocol.
+type memoryClient struct {
+	t         *testing.T
+	transport *MemoryTransport
+}
+
+// Serves a session on an in-memory transport and returns the client end of it.
+func connectMemory(t *testing.T, ss *SignalingServer, addr string) *memoryClient {
+	t.Helper()
+	server, client := NewMemoryTransports(addr)
+	go ss.Serve(context.Background(), NewSession(server, legacyProtocol{}))
+	t.Cleanup(func() { client.Close() })
+	return &memoryClient{t: t, transport: client}
+}
+
+func (c *memoryClient) send(message SocketMessage) {
+	c.t.Helper()
+	frame, err := json.Marshal(message)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.transport.WriteFrame(0, frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Returns the next message from the server, decoded in a map.
+func (c *memoryClient) receive() map[string]any {
+	c.t.Helper()
+	frames := make(chan []byte, 1)
+	go func() {
+		frame, err := c.transport.ReadFrame()
+		if err == nil {
+			frames <- frame
+		}
+		close(frames)
+	}()
+	select {
+	case frame, ok := <-frames:
+		if !ok {
+			c.t.Fatal("the connection was closed")
+		}
+		var message map[string]any
+		if err := json.Unmarshal(frame, &message); err != nil {
+			c.t.Fatal(err)
+		}
+		return message
+	case <-time.After(testTimeout):
+		c.t.Fatal("no message from the server")
+	}
+	return nil
+}
+
+// Sends the message and checks the fields of the answer.
+func (c *memoryClient) request(message SocketMessage, want map[string]any) {
+	c.t.Helper()
+	c.send(message)
+	got := c.receive()
+	for key, value := range want {
+		if got[key] != value {
+			c.t.Errorf("%s answered with %s %v, want %v (%v)", message.Type, key, got[key], value, got)
+		}
+	}
+}
+
+func TestInitiation(t *testing.T) {
+	_, ss := newTestApp(t, nil)
+	alice := connectMemory(t, ss, "alice")
+	impostor := connectMemory(t, ss, "impostor")
+
+	alice.request(SocketMessage{Type: "initiation", Name: "alice", RequestID: "1"}, map[string]any{"type": "initiation", "success": true, "request_id": "1"})
+	impostor.request(SocketMessage{Type: "initiation", Name: "alice"}, map[string]any{"success": false, "error": codeNameTaken})
+	impostor.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"}, map[string]any{"type": "error", "error": codeUnauthorized})
+
+	if user := ss.UserFromName("alice"); user == nil || user.Session == nil {
+		t.Fatal("alice is not a user with a session")
+	}
+	if count := ss.UserCount(); count != 1 {
+		t.Errorf("%d users, want 1", count)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	_, ss := newTestApp(t, nil)
+	alice := connectMemory(t, ss, "alice")
+	bob := connectMemory(t, ss, "bob")
+
+	alice.request(SocketMessage{Type: "initiation", Name: "alice"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"}, map[string]any{"success": true, "room_id": "ROOM"})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"}, map[string]any{"success": true, "room_id": "ROOM"})
+
+	bob.send(SocketMessage{Type: "offer", Name: "alice", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}})
+	offer := alice.receive()
+	if offer["type"] != "offer" || offer["name"] != "bob" {
+		t.Errorf("alice received %v, want an offer from bob", offer)
+	}
+	bob.request(SocketMessage{Type: "offer", Name: "nobody", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}}, map[string]any{"type": "error", "error": codePeerNotFound})
+}
+
+func TestClosedSessionLeaves(t *testing.T) {
+	_, ss := newTestApp(t, nil)
+	alice := connectMemory(t, ss, "alice")
+	bob := connectMemory(t, ss, "bob")
+
+	alice.request(SocketMessage{Type: "initiation", Name: "alice"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"}, map[string]any{"success": true})
+
+	alice.transport.Close()
+	left := bob.receive()
+	if left["type"] != "peerLeavingRoom" || left["name"] != "alice" || left["room_destroy"] != true {
+		t.Errorf("bob received %v, want alice leaving and destroying the room", left)
+	}
+	eventually(t, func() bool { return ss.UserCount() == 1 && ss.ConnCount() == 1 }, "alice's user and session are left after closing")
+}
+
+func TestAccess(t *testing.T) {
+	_, ss := newTestApp(t, nil)
+	alice := connectMemory(t, ss, "alice")
+	bob := connectMemory(t, ss, "bob")
+
+	alice.request(SocketMessage{Type: "leaveRoom"}, map[string]any{"type": "error", "error": codeUnauthorized})
+	alice.request(SocketMessage{Type: "initiation", Name: "alice"}, map[string]any{"success": true})
+	alice.request(SocketMessage{Type: "initiation", Name: "alice2"}, map[string]any{"type": "error", "error": codeUnauthorized})
+	alice.request(SocketMessage{Type: "offer", Name: "bob", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}}, map[string]any{"type": "error", "error": codeUnauthorized})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"}, map[string]any{"success": true})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "MORE", Role: "creator"}, map[string]any{"type": "error", "error": codeUnauthorized})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "participant"}, map[string]any{"type": "error", "error": codeUnauthorized})
+
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"}, map[string]any{"type": "error", "error": codeUnauthorized})
+
+	if count := ss.UserCount(); count != 2 {
+		t.Errorf("%d users, want 2", count)
+	}
+	rooms, err := ss.rooms.List()
+	if err != nil || len(rooms) != 1 || len(rooms[0].Users) != 2 {
+		t.Errorf("the rooms are %v, %v, want one room with alice and bob", rooms, err)
+	}
+}
+
+func TestConcurrentJoinAndLeave(t *testing.T) {
+	_, ss := newTestApp(t, nil)
+	alice := connectMemory(t, ss, "alice")
+	alice.request(SocketMessage{Type: "initiation", Name: "alice"}, map[string]any{"success": true})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"}, map[string]any{"success": true})
+	clients := []*memoryClient{alice}
+	for i := range 50 {
+		name := fmt.Sprintf("peer%d", i)
+		participant := connectMemory(t, ss, name)
+		participant.request(SocketMessage{Type: "initiation", Name: name}, map[string]any{"success": true})
+		clients = append(clients, participant)
+	}
+
+	// Every session is served on its own goroutine, so the participants join and leave the room
+	// concurrently and the race detector sees any user list read without the lock. The answers and
+	// the leaving notices are read and dropped, so the sessions never wait for their clients.
+	for _, client := range clients {
+		go func() {
+			for {
+				if _, err := client.transport.ReadFrame(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	for i, participant := range clients[1:] {
+		participant.send(SocketMessage{Type: "roomInitiation", Name: fmt.Sprintf("peer%d", i), RoomID: "ROOM", Role: "participant"})
+	}
+	for _, participant := range clients[1:] {
+		participant.send(SocketMessage{Type: "leaveRoom"})
+	}
+	eventually(t, func() bool {
+		room, err := ss.rooms.Get("ROOM")
+		return err == nil && len(room.Users) == 1 && ss.UserCount() == 1
+	}, "the participants are left after leaving")
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How long generated self-signed certificates are valid.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// Keeps the TLS certificate loaded from disk and reloads it when the files change or
+// on SIGHUP. Only new handshakes pick up the new certificate, so open connections stay alive.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+	mux      sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// Creates a certReloader and loads the certificate.
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// Loads the certificate from disk. The previous certificate is kept if loading fails.
+func (cr *certReloader) Reload() error {
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.mux.Lock()
+	defer cr.mux.Unlock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	return nil
+}
+
+// Returns the current certificate. Used as tls.Config.GetCertificate.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mux.RLock()
+	defer cr.mux.RUnlock()
+
+	return cr.cert, nil
+}
+
+// Reloads the certificate on SIGHUP and whenever the files have changed, checking every interval,
+// until the context is done.
+func (cr *certReloader) Watch(ctx context.Context, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			cr.reloadAndLog("SIGHUP")
+		case <-ticker.C:
+			modTime, err := cr.latestModTime()
+			if err != nil {
+				cr.logger.Warn("Failed to check the TLS certificate files", logKeyError, err)
+				continue
+			}
+			cr.mux.RLock()
+			changed := modTime.After(cr.modTime)
+			cr.mux.RUnlock()
+			if changed {
+				cr.reloadAndLog("file change")
+			}
+		}
+	}
+}
+
+func (cr *certReloader) reloadAndLog(trigger string) {
+	if err := cr.Reload(); err != nil {
+		cr.logger.Error("Failed to reload the TLS certificate, keeping the previous one", "trigger", trigger, logKeyError, err)
+		return
+	}
+	cr.logger.Info("Reloaded the TLS certificate", "trigger", trigger)
+}
+
+// Returns the latest modification time of the certificate and key files.
+func (cr *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Returns the TLS configuration serving the certificate of the reloader.
+func (cr *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: cr.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// Writes a self-signed certificate and its key for the hosts when neither file exists. Only one
+// of them existing is an error, so a certificate or key is never overwritten. Browsers only allow
+// WebRTC on secure origins, so this makes the app usable on other hosts than localhost during
+// development.
+func ensureSelfSignedCert(certFile, keyFile string, hosts []string) (bool, error) {
+	certExists, err := fileExists(certFile)
+	if err != nil {
+		return false, err
+	}
+	keyExists, err := fileExists(keyFile)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case certExists && keyExists:
+		return false, nil
+	case certExists:
+		return false, fmt.Errorf("the certificate %s exists without the key %s, remove it to generate both", certFile, keyFile)
+	case keyExists:
+		return false, fmt.Errorf("the key %s exists without the certificate %s, remove it to generate both", keyFile, certFile)
+	}
+
+	der, key, err := newSelfSignedCert(hosts, selfSignedValidity)
+	if err != nil {
+		return false, err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns whether the file exists.
+func fileExists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Returns a handler that redirects every plain HTTP request to HTTPS. The target host is taken from
+// the public URL when it is configured, otherwise from the request host and the HTTPS listen port.
+func httpsRedirectHandler(config *Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if config.PublicURL != "" {
+			publicURL, _ := url.Parse(config.PublicURL)
+			host = publicURL.Host
+		} else {
+			if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = hostname
+			}
+			if _, port, err := net.SplitHostPort(config.ListenAddress); err == nil && port != "443" {
+				host = net.JoinHostPort(host, port)
+			}
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+}
+
+// Creates a self-signed ECDSA certificate for the hosts, valid from now for the validity.
+// Returns the DER encoded certificate and its key.
+func newSelfSignedCert(hosts []string, validity time.Duration) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"piirtul.io development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return der, key, nil
+}
+
+// Returns the hosts a generated self-signed certificate is valid for.
+func (config *Config) selfSignedHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(config.ListenAddress); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+	hosts = append(hosts, config.TLS.Hosts...)
+
+	unique := []string{}
+	for _, host := range hosts {
+		if !slices.Contains(unique, host) {
+			unique = append(unique, host)
+		}
+	}
+	return unique
+}
+
+// Describes the TLS setup for the startup log.
+func (config *Config) tlsDescription() string {
+	if !config.TLSEnabled() {
+		return "disabled"
+	}
+	if config.TLS.SelfSigned {
+		return fmt.Sprintf("self-signed (%s)", config.TLS.CertFile)
+	}
+	return config.TLS.CertFile
+}
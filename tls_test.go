@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	generated, err := ensureSelfSignedCert(certFile, keyFile, []string{"localhost"})
+	if err != nil || !generated {
+		t.Fatalf("generating a certificate returned %t, %v", generated, err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatalf("the generated certificate does not load: %v", err)
+	}
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated, err := ensureSelfSignedCert(certFile, keyFile, []string{"localhost"}); err != nil || generated {
+		t.Errorf("ensuring an existing certificate returned %t, %v, want it kept", generated, err)
+	}
+
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if generated, err := ensureSelfSignedCert(certFile, keyFile, []string{"localhost"}); err == nil || generated {
+		t.Errorf("ensuring a certificate without its key returned %t, %v, want an error", generated, err)
+	}
+	if kept, err := os.ReadFile(certFile); err != nil || string(kept) != string(cert) {
+		t.Errorf("the certificate was overwritten: %v", err)
+	}
+
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if generated, err := ensureSelfSignedCert(certFile, keyFile, []string{"localhost"}); err == nil || generated {
+		t.Errorf("ensuring a key without its certificate returned %t, %v, want an error", generated, err)
+	}
+	if _, err := os.Stat(certFile); err == nil {
+		t.Error("a certificate was written next to the key")
+	}
+}
@@ -0,0 +1,115 @@
+// Protogen generates the Go code of the gRPC API from its protobuf definition with the official
+// protoc-gen-go and protoc-gen-go-grpc plugins, which are tools of the module. It stands in for
+// protoc: the definition is compiled in Go and handed to the plugins run with go tool, so protoc
+// doesn't need to be installed. With protoc, the same files are generated with
+//
+//	protoc --plugin=protoc-gen-go=<path> --go_out=. --go_opt=paths=source_relative \
+//		--plugin=protoc-gen-go-grpc=<path> --go-grpc_out=. --go-grpc_opt=paths=source_relative signaling.proto
+//
+// Usage, from the directory of the proto files:
+//
+//	go run ../tools/protogen signaling.proto
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// The plugins run on the definition, tools of the module.
+var plugins = []string{"protoc-gen-go", "protoc-gen-go-grpc"}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: protogen file.proto...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	request, err := compile(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, plugin := range plugins {
+		response, err := run(plugin, request)
+		if err != nil {
+			log.Fatalf("%s: %v", plugin, err)
+		}
+		for _, generated := range response.GetFile() {
+			if err := os.WriteFile(generated.GetName(), []byte(generated.GetContent()), 0o644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// Compiles the proto files into the request a protoc plugin gets. The generated files are
+// written next to the proto files.
+func compile(names []string) (*pluginpb.CodeGeneratorRequest, error) {
+	compiler := protocompile.Compiler{
+		Resolver:       protocompile.WithStandardImports(&protocompile.SourceResolver{}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	files, err := compiler.Compile(context.Background(), names...)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &pluginpb.CodeGeneratorRequest{FileToGenerate: names, Parameter: proto.String("paths=source_relative")}
+	// The plugins expect the imports before the files importing them.
+	seen := make(map[string]bool)
+	var add func(file protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		imports := file.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		request.ProtoFile = append(request.ProtoFile, protodesc.ToFileDescriptorProto(file))
+	}
+	for _, file := range files {
+		add(file)
+	}
+	return request, nil
+}
+
+// Runs the plugin with go tool like protoc does: the request on its stdin and the response on
+// its stdout.
+func run(plugin string, request *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	input, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var output bytes.Buffer
+	cmd := exec.Command("go", "tool", plugin)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(input), &output, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	response := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(output.Bytes(), response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("%s", response.GetError())
+	}
+	return response, nil
+}
@@ -0,0 +1,453 @@
+// Schemagen generates the AsyncAPI document and the TypeScript types of the signaling protocol
+// from the message structs of the server, so the clients stay in sync with the server.
+// It reads the Go sources instead of importing them, since the server is a main package.
+//
+//	go run ./tools/schemagen -asyncapi embed/schema/asyncapi.json -typescript embed/assets/protocol.d.ts
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The enumerations, and the fields holding them by struct and JSON name.
+const (
+	messageTypeEnum = "MessageType"
+	errorCodeEnum   = "ErrorCode"
+)
+
+var enumFields = map[string]string{
+	"SocketMessage.type":            messageTypeEnum,
+	"SocketResponse.error":          errorCodeEnum,
+	"RoomSocketResponse.error":      errorCodeEnum,
+	"ValidationErrorResponse.error": errorCodeEnum,
+	"RateLimitedResponse.error":     errorCodeEnum,
+	"EnvelopeError.code":            errorCodeEnum,
+}
+
+func main() {
+	dirs := flag.String("dirs", ".,protocol", "the directories of the server and the protocol packages, comma separated")
+	receive := flag.String("receive", "SocketMessage,Envelope", "the messages the server receives, comma separated")
+	send := flag.String("send", "SocketResponse,RoomSocketResponse,LeavingResponse,ValidationErrorResponse,RateLimitedResponse,DrainingResponse,SocketMessage,Envelope", "the messages the server sends, comma separated")
+	asyncAPIPath := flag.String("asyncapi", "", "the AsyncAPI document to write")
+	typeScriptPath := flag.String("typescript", "", "the TypeScript declarations to write")
+	flag.Parse()
+
+	pkg, err := parsePackages(strings.Split(*dirs, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	received, sent := strings.Split(*receive, ","), strings.Split(*send, ",")
+	names, err := pkg.reachable(append(slices.Clone(received), sent...))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asyncAPIPath != "" {
+		document, err := json.MarshalIndent(pkg.asyncAPI(names, received, sent), "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*asyncAPIPath, append(document, '\n'), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *typeScriptPath != "" {
+		if err := os.WriteFile(*typeScriptPath, pkg.typeScript(names, received, sent), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// A struct of the server package.
+type structType struct {
+	doc    string
+	fields []field
+}
+
+// A field of a struct as it appears in JSON.
+type field struct {
+	name     string
+	doc      string
+	expr     ast.Expr
+	optional bool
+}
+
+// The parts of the server and the protocol packages the generator needs.
+type goPackage struct {
+	structs map[string]structType
+	// The string constants by name, without the package.
+	constants    map[string]string
+	routes       ast.Expr
+	messageTypes []string
+	errorCodes   []string
+}
+
+// Parses the non-test files of the packages in the directories.
+func parsePackages(dirs []string) (*goPackage, error) {
+	fset := token.NewFileSet()
+	pkg := &goPackage{structs: make(map[string]structType), constants: make(map[string]string)}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			file, err := parser.ParseFile(fset, dir+"/"+name, nil, parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+			for _, decl := range file.Decls {
+				if genDecl, ok := decl.(*ast.GenDecl); ok {
+					pkg.collect(genDecl)
+				}
+			}
+		}
+	}
+	pkg.messageTypes = pkg.routeTypes(pkg.routes)
+	return pkg, nil
+}
+
+// Collects the structs, the messageRoutes, the string constants and the error codes.
+func (p *goPackage) collect(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			doc := spec.Doc
+			if doc == nil {
+				doc = decl.Doc
+			}
+			p.structs[spec.Name.Name] = structType{doc: docText(doc, nil), fields: structFields(st)}
+		case *ast.ValueSpec:
+			for i, name := range spec.Names {
+				if i >= len(spec.Values) {
+					break
+				}
+				if name.Name == "messageRoutes" {
+					p.routes = spec.Values[i]
+				}
+				value, ok := stringLiteral(spec.Values[i])
+				if !ok || decl.Tok != token.CONST {
+					continue
+				}
+				p.constants[name.Name] = value
+				if strings.HasPrefix(name.Name, "Code") {
+					p.errorCodes = append(p.errorCodes, value)
+				}
+			}
+		}
+	}
+}
+
+// Returns the Type of every route in the messageRoutes literal.
+func (p *goPackage) routeTypes(expr ast.Expr) []string {
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil
+	}
+	var types []string
+	for _, element := range literal.Elts {
+		route, ok := element.(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		for _, element := range route.Elts {
+			keyValue, ok := element.(*ast.KeyValueExpr)
+			if key, isIdent := keyValue.Key.(*ast.Ident); ok && isIdent && key.Name == "Type" {
+				if value, ok := p.stringValue(keyValue.Value); ok {
+					types = append(types, value)
+				}
+			}
+		}
+	}
+	return types
+}
+
+// Returns the value of a string literal or a string constant.
+func (p *goPackage) stringValue(expr ast.Expr) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		value, ok := p.constants[expr.Name]
+		return value, ok
+	case *ast.SelectorExpr:
+		value, ok := p.constants[expr.Sel.Name]
+		return value, ok
+	}
+	return stringLiteral(expr)
+}
+
+func stringLiteral(expr ast.Expr) (string, bool) {
+	literal, ok := expr.(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(literal.Value)
+	return value, err == nil
+}
+
+// Returns the fields of a struct the way encoding/json sees them.
+func structFields(st *ast.StructType) []field {
+	var fields []field
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			value, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(value)
+		}
+		jsonName, options, _ := strings.Cut(tag.Get("json"), ",")
+		for _, name := range f.Names {
+			if !name.IsExported() || jsonName == "-" {
+				continue
+			}
+			fieldName := jsonName
+			if fieldName == "" {
+				fieldName = name.Name
+			}
+			fields = append(fields, field{
+				name:     fieldName,
+				doc:      docText(f.Doc, f.Comment),
+				expr:     f.Type,
+				optional: slices.Contains(strings.Split(options, ","), "omitempty"),
+			})
+		}
+	}
+	return fields
+}
+
+// Joins the comments into a single line of text.
+func docText(groups ...*ast.CommentGroup) string {
+	var parts []string
+	for _, group := range groups {
+		if text := strings.TrimSpace(group.Text()); text != "" {
+			parts = append(parts, strings.Join(strings.Fields(text), " "))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Returns the roots and every struct their fields refer to, in a stable order.
+func (p *goPackage) reachable(roots []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		if seen[name] {
+			return nil
+		}
+		st, ok := p.structs[name]
+		if !ok {
+			return fmt.Errorf("no struct named %s", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+		for _, f := range st.fields {
+			for _, ref := range structRefs(f.expr, p.structs) {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := visit(root); err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func structRefs(expr ast.Expr, structs map[string]structType) []string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if _, ok := structs[expr.Name]; ok {
+			return []string{expr.Name}
+		}
+	case *ast.StarExpr:
+		return structRefs(expr.X, structs)
+	case *ast.ArrayType:
+		return structRefs(expr.Elt, structs)
+	case *ast.MapType:
+		return structRefs(expr.Value, structs)
+	}
+	return nil
+}
+
+// Returns the JSON Schema of a field type.
+func (p *goPackage) schema(expr ast.Expr) map[string]any {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "string":
+			return map[string]any{"type": "string"}
+		case "bool":
+			return map[string]any{"type": "boolean"}
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+			return map[string]any{"type": "integer"}
+		case "float32", "float64":
+			return map[string]any{"type": "number"}
+		}
+		if _, ok := p.structs[expr.Name]; ok {
+			return map[string]any{"$ref": "#/components/schemas/" + expr.Name}
+		}
+	case *ast.StarExpr:
+		return p.schema(expr.X)
+	case *ast.ArrayType:
+		return map[string]any{"type": "array", "items": p.schema(expr.Elt)}
+	case *ast.MapType:
+		return map[string]any{"type": "object", "additionalProperties": p.schema(expr.Value)}
+	}
+	// any, interfaces and types of other packages.
+	return map[string]any{}
+}
+
+// Returns the AsyncAPI document of the WebSocket channel.
+func (p *goPackage) asyncAPI(names, received, sent []string) map[string]any {
+	schemas := map[string]any{
+		messageTypeEnum: map[string]any{"type": "string", "description": "The message types of the signaling protocol.", "enum": p.messageTypes},
+		errorCodeEnum:   map[string]any{"type": "string", "description": "The error codes of failed requests, see /api/errors.", "enum": p.errorCodes},
+	}
+	for _, name := range names {
+		st := p.structs[name]
+		properties := make(map[string]any)
+		required := []string{}
+		for _, f := range st.fields {
+			property := p.schema(f.expr)
+			if enum, ok := enumFields[name+"."+f.name]; ok {
+				property = map[string]any{"$ref": "#/components/schemas/" + enum}
+			}
+			if f.doc != "" {
+				if _, isRef := property["$ref"]; isRef {
+					property = map[string]any{"allOf": []any{property}}
+				}
+				property["description"] = f.doc
+			}
+			properties[f.name] = property
+			if !f.optional {
+				required = append(required, f.name)
+			}
+		}
+		schemas[name] = map[string]any{"type": "object", "description": st.doc, "properties": properties, "required": required}
+	}
+
+	messages := make(map[string]any)
+	messageRefs := func(names []string) []any {
+		refs := make([]any, len(names))
+		for i, name := range names {
+			messages[name] = map[string]any{"name": name, "summary": p.structs[name].doc, "payload": map[string]any{"$ref": "#/components/schemas/" + name}}
+			refs[i] = map[string]any{"$ref": "#/components/messages/" + name}
+		}
+		return refs
+	}
+
+	return map[string]any{
+		"asyncapi": "2.6.0",
+		"info": map[string]any{
+			"title":   "piirtul.io signaling",
+			"version": "2",
+			"description": "The WebSocket signaling protocol of piirtul.io. The piirtul.v1 subprotocol sends the messages as is, " +
+				"piirtul.v2 and piirtul.v2+msgpack wrap them in an Envelope.",
+		},
+		"defaultContentType": "application/json",
+		"channels": map[string]any{
+			"/websocket": map[string]any{
+				"publish":   map[string]any{"summary": "Messages the client sends.", "message": map[string]any{"oneOf": messageRefs(received)}},
+				"subscribe": map[string]any{"summary": "Messages the server sends.", "message": map[string]any{"oneOf": messageRefs(sent)}},
+			},
+		},
+		"components": map[string]any{"schemas": schemas, "messages": messages},
+	}
+}
+
+// Returns the TypeScript type of a field type.
+func (p *goPackage) tsType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "string":
+			return "string"
+		case "bool":
+			return "boolean"
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+			return "number"
+		}
+		if _, ok := p.structs[expr.Name]; ok {
+			return expr.Name
+		}
+	case *ast.StarExpr:
+		return p.tsType(expr.X)
+	case *ast.ArrayType:
+		return p.tsType(expr.Elt) + "[]"
+	case *ast.MapType:
+		return "Record<string, " + p.tsType(expr.Value) + ">"
+	}
+	return "unknown"
+}
+
+// Returns the TypeScript declarations of the messages.
+func (p *goPackage) typeScript(names, received, sent []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by schemagen from the Go message structs. DO NOT EDIT.\n\n")
+	writeUnion(&b, "The message types of the signaling protocol.", messageTypeEnum, quoteAll(p.messageTypes))
+	writeUnion(&b, "The error codes of failed requests, see /api/errors.", errorCodeEnum, quoteAll(p.errorCodes))
+	for _, name := range names {
+		st := p.structs[name]
+		writeDoc(&b, "", st.doc)
+		fmt.Fprintf(&b, "export interface %s {\n", name)
+		for _, f := range st.fields {
+			tsType := p.tsType(f.expr)
+			if enum, ok := enumFields[name+"."+f.name]; ok {
+				tsType = enum
+			}
+			optional := ""
+			if f.optional {
+				optional = "?"
+			}
+			writeDoc(&b, "    ", f.doc)
+			fmt.Fprintf(&b, "    %s%s: %s;\n", f.name, optional, tsType)
+		}
+		b.WriteString("}\n\n")
+	}
+	writeUnion(&b, "The messages a client sends.", "ClientMessage", received)
+	writeUnion(&b, "The messages the server sends.", "ServerMessage", sent)
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+func writeUnion(b *bytes.Buffer, doc, name string, members []string) {
+	writeDoc(b, "", doc)
+	fmt.Fprintf(b, "export type %s = %s;\n\n", name, strings.Join(members, " | "))
+}
+
+func writeDoc(b *bytes.Buffer, indent, doc string) {
+	if doc != "" {
+		fmt.Fprintf(b, "%s/** %s */\n", indent, strings.ReplaceAll(doc, "*/", "* /"))
+	}
+}
+
+func quoteAll(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return quoted
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Records the spans of the servers created after it, with the W3C trace context propagator.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestTraceContinuedOnRelay(t *testing.T) {
+	recorder := recordSpans(t)
+	_, ss := newTestApp(t, nil)
+	alice := connectMemory(t, ss, "alice")
+	bob := connectMemory(t, ss, "bob")
+	alice.request(SocketMessage{Type: "initiation", Name: "alice"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	alice.request(SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "creator"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"}, map[string]any{"success": true})
+
+	const traceID, spanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	bob.send(SocketMessage{Type: "offer", Name: "alice", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}, Trace: map[string]string{
+		"traceparent": "00-" + traceID + "-" + spanID + "-01",
+	}})
+	offer := alice.receive()
+	trace, _ := offer["trace"].(map[string]any)
+	traceparent, _ := trace["traceparent"].(string)
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[1] != traceID || parts[2] == spanID {
+		t.Fatalf("alice received the trace %v, want the trace %s continued in a span of the server", offer["trace"], traceID)
+	}
+
+	// The dispatch continues bob's span, and the relay whose span alice continues is its child.
+	// The spans end after the offer has been sent.
+	var dispatch, relay sdktrace.ReadOnlySpan
+	eventually(t, func() bool {
+		for _, span := range recorder.Ended() {
+			switch span.Name() {
+			case "dispatch offer":
+				dispatch = span
+			case "relay offer":
+				relay = span
+			}
+		}
+		return dispatch != nil && relay != nil
+	}, "the dispatch and the relay of the offer are not recorded")
+	if dispatch.SpanContext().TraceID().String() != traceID || dispatch.Parent().SpanID().String() != spanID {
+		t.Errorf("the dispatch is in the trace %s under %s, want %s under %s", dispatch.SpanContext().TraceID(), dispatch.Parent().SpanID(), traceID, spanID)
+	}
+	if relay.Parent().SpanID() != dispatch.SpanContext().SpanID() || relay.SpanContext().SpanID().String() != parts[2] {
+		t.Errorf("the relay span %s under %s, want the span of the relayed message under the dispatch", relay.SpanContext().SpanID(), relay.Parent().SpanID())
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// Returned by Transport.ReadFrame when the client closed the connection normally.
+	errClientClosed = errors.New("connection closed by the client")
+	// Returned by Transport.ReadFrame when the client sent a frame over the read limit.
+	// The transport has closed the connection.
+	errFrameTooLarge = errors.New("frame over the read limit")
+	// Returned by Transport.ReadFrame when the connection was lost without a close.
+	errConnectionLost = errors.New("connection lost")
+)
+
+// Sends, receives and closes the frames of a connection. Each way of connecting to the server has
+// an adapter implementing it, so the signaling logic is not tied to any of them.
+type Transport interface {
+	// Reads the next frame. Returns errClientClosed, errFrameTooLarge or errConnectionLost, wrapped,
+	// when the connection ends.
+	ReadFrame() ([]byte, error)
+	// Writes a frame of the frame type of the protocol. The session serializes the writes.
+	WriteFrame(frameType int, frame []byte) error
+	// Asks the client to close the connection because the server is going away. Safe to call
+	// concurrently with the writes.
+	GoAway(reason string) error
+	// Closes the connection without waiting for the client.
+	Close() error
+	RemoteAddr() string
+}
+
+// A Transport over a gorilla WebSocket connection.
+type WebSocketTransport struct {
+	conn *websocket.Conn
+}
+
+// Creates a transport reading and writing the WebSocket connection.
+func NewWebSocketTransport(conn *websocket.Conn) *WebSocketTransport {
+	return &WebSocketTransport{conn: conn}
+}
+
+func (t *WebSocketTransport) ReadFrame() ([]byte, error) {
+	_, frame, err := t.conn.ReadMessage()
+	switch {
+	case err == nil:
+		return frame, nil
+	// Client closed the browser
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+		return nil, fmt.Errorf("%w: %w", errClientClosed, err)
+	// The connection has been closed with 1009
+	case errors.Is(err, websocket.ErrReadLimit):
+		return nil, fmt.Errorf("%w: %w", errFrameTooLarge, err)
+	case websocket.IsUnexpectedCloseError(err):
+		return nil, fmt.Errorf("%w: %w", errConnectionLost, err)
+	}
+	return nil, err
+}
+
+func (t *WebSocketTransport) WriteFrame(frameType int, frame []byte) error {
+	return t.conn.WriteMessage(frameType, frame)
+}
+
+// Sends a going away close frame.
+func (t *WebSocketTransport) GoAway(reason string) error {
+	// WriteControl may be called concurrently with the other write methods.
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	return t.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(closeWriteTimeout))
+}
+
+func (t *WebSocketTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *WebSocketTransport) RemoteAddr() string {
+	return t.conn.RemoteAddr().String()
+}
+
+// One end of an in-memory connection, for tests. The frames written to one end are read from the other.
+type MemoryTransport struct {
+	remoteAddr string
+	in         <-chan memoryFrame
+	out        chan<- memoryFrame
+	// Closed when either end is closed.
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+// A frame in transit on an in-memory connection.
+type memoryFrame struct {
+	frameType int
+	data      []byte
+}
+
+// Creates the two ends of an in-memory connection: one for the server and one for the client.
+func NewMemoryTransports(clientAddr string) (server, client *MemoryTransport) {
+	toServer, toClient := make(chan memoryFrame, 16), make(chan memoryFrame, 16)
+	closed, closeOnce := make(chan struct{}), &sync.Once{}
+	server = &MemoryTransport{remoteAddr: clientAddr, in: toServer, out: toClient, closed: closed, closeOnce: closeOnce}
+	client = &MemoryTransport{remoteAddr: "server", in: toClient, out: toServer, closed: closed, closeOnce: closeOnce}
+	return server, client
+}
+
+func (t *MemoryTransport) ReadFrame() ([]byte, error) {
+	// The frames written before the close are still delivered.
+	select {
+	case frame := <-t.in:
+		return frame.data, nil
+	default:
+	}
+	select {
+	case frame := <-t.in:
+		return frame.data, nil
+	case <-t.closed:
+		return nil, errClientClosed
+	}
+}
+
+func (t *MemoryTransport) WriteFrame(frameType int, frame []byte) error {
+	select {
+	case <-t.closed:
+		return errors.New("write to a closed connection")
+	default:
+	}
+	select {
+	case t.out <- memoryFrame{frameType: frameType, data: frame}:
+		return nil
+	case <-t.closed:
+		return errors.New("write to a closed connection")
+	}
+}
+
+// Closes the connection, since there is no client to ask.
+func (t *MemoryTransport) GoAway(reason string) error {
+	return t.Close()
+}
+
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
+
+func (t *MemoryTransport) RemoteAddr() string {
+	return t.remoteAddr
+}
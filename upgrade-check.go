@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The cookie holding the random ID of the browser the upgrade tokens are bound to.
+const upgradeTokenCookie = "piirtul_upgrade"
+
+// The query parameter the page sends the upgrade token in.
+const upgradeTokenParam = "token"
+
+var (
+	errTokenMissing  = errors.New("upgrade token missing")
+	errTokenInvalid  = errors.New("upgrade token invalid")
+	errTokenExpired  = errors.New("upgrade token expired")
+	errTokenMismatch = errors.New("upgrade token is not bound to the cookie")
+)
+
+// An allowed origin. The host may start with "*." to allow every subdomain of the rest.
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+// Parses an allowed origin like "https://example.com" or "https://*.example.com:8443".
+func parseOriginPattern(origin string) (originPattern, error) {
+	originURL, err := url.Parse(strings.ToLower(origin))
+	if err != nil || originURL.Scheme == "" || originURL.Host == "" || (originURL.Path != "" && originURL.Path != "/") {
+		return originPattern{}, fmt.Errorf("%q is not an origin like https://example.com", origin)
+	}
+	pattern := originPattern{scheme: originURL.Scheme, host: originURL.Hostname(), port: originURL.Port()}
+	if suffix, ok := strings.CutPrefix(pattern.host, "*."); ok {
+		if suffix == "" || strings.Contains(suffix, "*") {
+			return originPattern{}, fmt.Errorf("%q has an invalid wildcard", origin)
+		}
+		pattern.host, pattern.wildcard = suffix, true
+	} else if strings.Contains(pattern.host, "*") {
+		return originPattern{}, fmt.Errorf("%q may only have a wildcard as the first label, like https://*.example.com", origin)
+	}
+	return pattern, nil
+}
+
+// Returns whether the origin matches the pattern. A wildcard matches subdomains only, not the domain itself.
+func (p originPattern) matches(origin *url.URL) bool {
+	if origin.Scheme != p.scheme || origin.Port() != p.port {
+		return false
+	}
+	host := origin.Hostname()
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// Decides which origins may open a WebSocket and logs the rejected ones.
+type OriginChecker struct {
+	patterns []originPattern
+	any      bool
+	logger   *slog.Logger
+}
+
+// Creates an OriginChecker for the allowed origins. Without allowed origins only same-origin
+// requests are accepted, and "*" accepts every origin.
+func NewOriginChecker(allowed []string, logger *slog.Logger) (*OriginChecker, error) {
+	oc := &OriginChecker{logger: logger}
+	for _, origin := range allowed {
+		if origin == "*" {
+			oc.any = true
+			continue
+		}
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		oc.patterns = append(oc.patterns, pattern)
+	}
+	return oc, nil
+}
+
+// Returns whether the origin of the request is allowed. Used as websocket.Upgrader.CheckOrigin.
+func (oc *OriginChecker) Check(r *http.Request) bool {
+	// Browsers always send an origin, so requests without one come from other clients.
+	origin := r.Header.Get("Origin")
+	if origin == "" || oc.any {
+		return true
+	}
+	if oc.allowed(origin, r.Host) {
+		return true
+	}
+	oc.logger.Warn("Rejected WebSocket upgrade from a disallowed origin", "origin", origin, logKeyRemoteAddr, r.RemoteAddr)
+	return false
+}
+
+func (oc *OriginChecker) allowed(origin, host string) bool {
+	originURL, err := url.Parse(strings.ToLower(origin))
+	if err != nil || originURL.Host == "" {
+		return false
+	}
+	if len(oc.patterns) == 0 {
+		return originURL.Host == strings.ToLower(host)
+	}
+	for _, pattern := range oc.patterns {
+		if pattern.matches(originURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mints and verifies the tokens that tie a WebSocket upgrade to a page rendered by this server.
+// A token is "<expiry>.<binding>.<mac>", where the binding is an HMAC of the ID of the browser the
+// token was minted for and the mac is an HMAC-SHA256 of the expiry and the binding.
+type UpgradeTokens struct {
+	secret []byte
+	ttl    time.Duration
+	secure bool
+}
+
+// Creates UpgradeTokens signing with the secret. An empty secret is replaced with a random one,
+// so the tokens of the pages rendered before a restart are no longer accepted.
+func NewUpgradeTokens(secret string, ttl time.Duration, secure bool) (*UpgradeTokens, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &UpgradeTokens{secret: key, ttl: ttl, secure: secure}, nil
+}
+
+// Returns a new token for the browser valid for the token lifetime.
+func (ut *UpgradeTokens) Mint(browser string, now time.Time) string {
+	payload := strconv.FormatInt(now.Add(ut.ttl).Unix(), 10) + "." + ut.mac("browser."+browser)
+	return payload + "." + ut.mac(payload)
+}
+
+// Checks that the token was minted by this server and has not expired.
+func (ut *UpgradeTokens) Verify(token string, now time.Time) error {
+	if token == "" {
+		return errTokenMissing
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return errTokenInvalid
+	}
+	payload, mac := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(ut.mac(payload))) {
+		return errTokenInvalid
+	}
+	expiry, _, _ := strings.Cut(payload, ".")
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return errTokenInvalid
+	}
+	if now.Unix() > expiresAt {
+		return errTokenExpired
+	}
+	return nil
+}
+
+// Checks that a verified token was minted for the browser.
+func (ut *UpgradeTokens) VerifyBrowser(token, browser string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[1]), []byte(ut.mac("browser."+browser))) {
+		return errTokenMismatch
+	}
+	return nil
+}
+
+func (ut *UpgradeTokens) mac(payload string) string {
+	h := hmac.New(sha256.New, ut.secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Mints a token for the page, bound to the browser ID in the same-site cookie. Browsers without
+// the cookie get a new ID. The page sends the token back when opening the WebSocket, and the
+// tokens of every page of the browser stay valid, so several tabs can connect.
+func (ut *UpgradeTokens) Issue(c echo.Context) (string, error) {
+	cookie, err := c.Cookie(upgradeTokenCookie)
+	if err != nil || cookie.Value == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return "", err
+		}
+		cookie = &http.Cookie{
+			Name:     upgradeTokenCookie,
+			Value:    base64.RawURLEncoding.EncodeToString(id),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   ut.secure,
+			SameSite: http.SameSiteStrictMode,
+		}
+		c.SetCookie(cookie)
+	}
+	return ut.Mint(cookie.Value, time.Now()), nil
+}
+
+// A middleware that rejects WebSocket upgrades and event streams without a valid token. Browsers,
+// recognised by the origin header, must also send the same-site cookie with the browser ID the
+// token was minted for, which a page on another site can't make them do.
+func (ut *UpgradeTokens) Guard(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			token := c.QueryParam(upgradeTokenParam)
+			err := ut.Verify(token, time.Now())
+			// WebTransport sessions are opened without cookies.
+			if err == nil && request.Header.Get("Origin") != "" && request.Proto != webTransportProto {
+				if cookie, cookieErr := request.Cookie(upgradeTokenCookie); cookieErr != nil {
+					err = errTokenMismatch
+				} else {
+					err = ut.VerifyBrowser(token, cookie.Value)
+				}
+			}
+			if err != nil {
+				logger.Warn("Rejected WebSocket upgrade", logKeyError, err, "origin", request.Header.Get("Origin"), logKeyRemoteAddr, request.RemoteAddr)
+				response := SocketResponse{Type: "error", Success: false, Error: codeUnauthorized, Message: err.Error()}
+				return c.JSON(http.StatusForbidden, response)
+			}
+			return next(c)
+		}
+	}
+}
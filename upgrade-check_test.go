@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestOriginPattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com", "https://www.example.com", false},
+		{"https://example.com:8443", "https://example.com:8443", true},
+		{"https://*.example.com", "https://www.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://badexample.com", false},
+		{"https://*.example.com", "https://example.com.evil.com", false},
+	} {
+		pattern, err := parseOriginPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", tt.pattern, err)
+		}
+		origin, err := url.Parse(strings.ToLower(tt.origin))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pattern.matches(origin); got != tt.want {
+			t.Errorf("%q matches %q: %t, want %t", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"example.com", "https://", "https://example.com/path", "https://*.", "https://*.*.example.com", "https://www.*.example.com"} {
+		if _, err := parseOriginPattern(invalid); err == nil {
+			t.Errorf("parsed %q, want an error", invalid)
+		}
+	}
+}
+
+func TestVerifyUpgradeToken(t *testing.T) {
+	tokens, err := NewUpgradeTokens("secret", time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	token := tokens.Mint("browser", now)
+	other, err := NewUpgradeTokens("other", time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry, rest, _ := strings.Cut(token, ".")
+	// The last character of the mac has unused bits, so the one before it is changed.
+	changed := byte('A')
+	if token[len(token)-2] == changed {
+		changed = 'B'
+	}
+	changedMAC := token[:len(token)-2] + string(changed) + token[len(token)-1:]
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		now   time.Time
+		want  error
+	}{
+		{"valid", token, now, nil},
+		{"missing", "", now, errTokenMissing},
+		{"expired", token, now.Add(time.Hour + time.Second), errTokenExpired},
+		{"without a mac", "garbage", now, errTokenInvalid},
+		{"with a changed expiry", expiry + "0." + rest, now, errTokenInvalid},
+		{"with a changed mac", changedMAC, now, errTokenInvalid},
+		{"of another secret", other.Mint("browser", now), now, errTokenInvalid},
+	} {
+		if err := tokens.Verify(tt.token, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("verifying a %s token returned %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := tokens.VerifyBrowser(token, "browser"); err != nil {
+		t.Errorf("verifying the browser of the token returned %v", err)
+	}
+	if err := tokens.VerifyBrowser(token, "another"); !errors.Is(err, errTokenMismatch) {
+		t.Errorf("verifying another browser returned %v, want %v", err, errTokenMismatch)
+	}
+}
+
+func TestUpgradeTokenGuard(t *testing.T) {
+	tokens, err := NewUpgradeTokens("", time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.GET("/token", func(c echo.Context) error {
+		token, err := tokens.Issue(c)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, token)
+	})
+	e.GET("/guarded", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, tokens.Guard(slog.New(slog.DiscardHandler)))
+
+	// Issues a token, with the cookie when given, and returns it and the cookie of the browser.
+	issue := func(cookie *http.Cookie) (string, *http.Cookie) {
+		request := httptest.NewRequest(http.MethodGet, "/token", nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		if cookies := recorder.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+		return recorder.Body.String(), cookie
+	}
+	firstTab, cookie := issue(nil)
+	if cookie == nil || cookie.Name != upgradeTokenCookie || cookie.Path != "/" || !cookie.HttpOnly {
+		t.Fatalf("issued the cookie %v, want the browser ID for every path", cookie)
+	}
+	secondTab, secondCookie := issue(cookie)
+	if secondCookie.Value != cookie.Value {
+		t.Errorf("issued the cookie %v to the second tab, want the same browser ID", secondCookie)
+	}
+	otherBrowser, _ := issue(nil)
+
+	for _, tt := range []struct {
+		name   string
+		token  string
+		origin string
+		cookie *http.Cookie
+		want   int
+	}{
+		{"a client without a token", "", "", nil, http.StatusForbidden},
+		{"a client with a token", firstTab, "", nil, http.StatusOK},
+		{"a browser without the cookie", firstTab, "http://example.com", nil, http.StatusForbidden},
+		{"the first tab", firstTab, "http://example.com", cookie, http.StatusOK},
+		{"the second tab", secondTab, "http://example.com", cookie, http.StatusOK},
+		{"a browser with the token of another", otherBrowser, "http://example.com", cookie, http.StatusForbidden},
+		{"a browser with an invalid token", "invalid", "http://example.com", cookie, http.StatusForbidden},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/guarded?"+url.Values{upgradeTokenParam: {tt.token}}.Encode(), nil)
+		if tt.origin != "" {
+			request.Header.Set("Origin", tt.origin)
+		}
+		if tt.cookie != nil {
+			request.AddCookie(tt.cookie)
+		}
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		if recorder.Code != tt.want {
+			t.Errorf("%s got %d, want %d", tt.name, recorder.Code, tt.want)
+		}
+	}
+}
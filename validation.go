@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"signaling/protocol"
+)
+
+// Limits of the fields of incoming socket messages.
+const (
+	maxNameLength             = 32
+	minRoomIDLength           = 4
+	maxRoomIDLength           = 16
+	maxSDPLength              = 32 * 1024
+	maxCandidateLength        = 512
+	maxSdpMidLength           = 32
+	maxSdpMLineIndex          = 1023
+	maxUsernameFragmentLength = 256
+	maxTraceEntries           = 4
+	maxTraceValueLength       = 512
+	maxRequestIDLength        = 64
+)
+
+// A single invalid field of a socket message.
+type FieldError = protocol.FieldError
+
+// The error returned for a socket message that is not valid, listing the offending fields.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (ve *ValidationError) Error() string {
+	messages := make([]string, len(ve.Fields))
+	for i, field := range ve.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return "invalid message: " + strings.Join(messages, "; ")
+}
+
+func (ve *ValidationError) add(field, format string, args ...any) {
+	ve.Fields = append(ve.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Returns the error, or nil when no field is invalid.
+func (ve *ValidationError) err() error {
+	if len(ve.Fields) == 0 {
+		return nil
+	}
+	return ve
+}
+
+// The response sent for a socket message that is malformed or not valid.
+type ValidationErrorResponse = protocol.ValidationErrorResponse
+
+// Creates the response for an error from decodeSocketMessage or SocketMessage.Validate.
+// An invalid request ID is not echoed.
+func newValidationErrorResponse(err error, requestID string) ValidationErrorResponse {
+	if !validRequestID(requestID) {
+		requestID = ""
+	}
+	response := ValidationErrorResponse{Type: "error", Success: false, Error: codeInvalidPayload, Message: "Incorrect message format", RequestID: requestID}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		response.Message = "Invalid message"
+		response.Fields = validationErr.Fields
+	}
+	return response
+}
+
+// Checks that the message has the payload fields its type requires, and no others, and that the
+// fields are within their limits. Besides the payload fields only the type, the request ID and
+// the trace context are allowed.
+func validateMessage(m SocketMessage, required []string) error {
+	ve := &ValidationError{}
+	if m.Type == "" {
+		ve.add("type", "is required")
+		return ve
+	}
+	if !validRequestID(m.RequestID) {
+		ve.add("request_id", "must be at most %d printable ASCII characters without spaces", maxRequestIDLength)
+	}
+
+	present := map[string]bool{
+		"name":      m.Name != "",
+		"room_id":   m.RoomID != "",
+		"role":      m.Role != "",
+		"offer":     m.Offer != nil,
+		"answer":    m.Answer != nil,
+		"candidate": m.Candidate != nil,
+	}
+	for _, field := range required {
+		if !present[field] {
+			ve.add(field, "is required for %s", m.Type)
+		}
+		delete(present, field)
+	}
+	for _, field := range []string{"name", "room_id", "role", "offer", "answer", "candidate"} {
+		if present[field] {
+			ve.add(field, "is not allowed for %s", m.Type)
+		}
+	}
+
+	if m.Name != "" {
+		validateName(ve, "name", m.Name)
+	}
+	if m.RoomID != "" {
+		validateRoomID(ve, "room_id", m.RoomID)
+	}
+	if m.Role != "" && m.Role != "creator" && m.Role != "participant" {
+		ve.add("role", "must be creator or participant")
+	}
+	if m.Offer != nil {
+		validateSessionDescription(ve, "offer", m.Offer.Type, m.Offer.Sdp)
+	}
+	if m.Answer != nil {
+		validateSessionDescription(ve, "answer", m.Answer.Type, m.Answer.Sdp)
+	}
+	if m.Candidate != nil {
+		validateCandidate(ve, m.Candidate)
+	}
+	validateTrace(ve, m.Trace)
+
+	return ve.err()
+}
+
+// Request IDs are echoed as they are, so they are kept short and printable.
+func validRequestID(requestID string) bool {
+	if len(requestID) > maxRequestIDLength {
+		return false
+	}
+	return strings.IndexFunc(requestID, func(r rune) bool { return r < 0x21 || r > 0x7e }) < 0
+}
+
+// Names are shown to the other users, so only letters, digits, spaces and _ - . are allowed,
+// and the name may not start or end with a space.
+func validateName(ve *ValidationError, field, name string) {
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxNameLength {
+		ve.add(field, "must be at most %d characters", maxNameLength)
+		return
+	}
+	if strings.TrimSpace(name) != name {
+		ve.add(field, "must not start or end with a space")
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" _-.", r) {
+			ve.add(field, "may only contain letters, digits, spaces and _ - .")
+			return
+		}
+	}
+}
+
+// Room IDs are upper case letters and digits.
+func validateRoomID(ve *ValidationError, field, roomID string) {
+	if len(roomID) < minRoomIDLength || len(roomID) > maxRoomIDLength {
+		ve.add(field, "must be %d to %d characters", minRoomIDLength, maxRoomIDLength)
+		return
+	}
+	for _, r := range roomID {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			ve.add(field, "may only contain upper case letters and digits")
+			return
+		}
+	}
+}
+
+func validateSessionDescription(ve *ValidationError, field, sdpType, sdp string) {
+	if sdpType != field {
+		ve.add(field+".type", "must be %s", field)
+	}
+	switch {
+	case sdp == "":
+		ve.add(field+".sdp", "is required")
+	case len(sdp) > maxSDPLength:
+		ve.add(field+".sdp", "must be at most %d bytes", maxSDPLength)
+	case !strings.HasPrefix(sdp, "v="):
+		ve.add(field+".sdp", "is not a session description")
+	}
+}
+
+// An empty candidate signals the end of the candidates.
+func validateCandidate(ve *ValidationError, candidate *Candidate) {
+	switch {
+	case len(candidate.Candidate) > maxCandidateLength:
+		ve.add("candidate.candidate", "must be at most %d bytes", maxCandidateLength)
+	case candidate.Candidate != "" && !strings.HasPrefix(candidate.Candidate, "candidate:"):
+		ve.add("candidate.candidate", "is not an ICE candidate")
+	}
+	if len(candidate.SdpMid) > maxSdpMidLength {
+		ve.add("candidate.sdpMid", "must be at most %d bytes", maxSdpMidLength)
+	}
+	if candidate.SdpMLineIndex < 0 || candidate.SdpMLineIndex > maxSdpMLineIndex {
+		ve.add("candidate.sdpMLineIndex", "must be between 0 and %d", maxSdpMLineIndex)
+	}
+	if len(candidate.UsernameFragment) > maxUsernameFragmentLength {
+		ve.add("candidate.usernameFragment", "must be at most %d bytes", maxUsernameFragmentLength)
+	}
+}
+
+func validateTrace(ve *ValidationError, traceContext map[string]string) {
+	if len(traceContext) > maxTraceEntries {
+		ve.add("trace", "must have at most %d entries", maxTraceEntries)
+		return
+	}
+	for key, value := range traceContext {
+		if len(key) > maxTraceValueLength || len(value) > maxTraceValueLength {
+			ve.add("trace."+key, "must be at most %d bytes", maxTraceValueLength)
+		}
+	}
+}
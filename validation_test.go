@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateMessage(t *testing.T) {
+	offer := &Offer{Type: "offer", Sdp: benchmarkSDP}
+	for _, tt := range []struct {
+		name    string
+		message SocketMessage
+		fields  []string
+		want    []string
+	}{
+		{"a valid initiation", SocketMessage{Type: "initiation", Name: "Alice B_1.-"}, []string{"name"}, nil},
+		{"a name of unicode letters", SocketMessage{Type: "initiation", Name: "Åsa Ünal"}, []string{"name"}, nil},
+		{"a missing type", SocketMessage{Name: "alice"}, []string{"name"}, []string{"type"}},
+		{"a missing field", SocketMessage{Type: "initiation"}, []string{"name"}, []string{"name"}},
+		{"a disallowed field", SocketMessage{Type: "initiation", Name: "alice", RoomID: "ROOM"}, []string{"name"}, []string{"room_id"}},
+		{"a name at the limit", SocketMessage{Type: "initiation", Name: strings.Repeat("ä", maxNameLength)}, []string{"name"}, nil},
+		{"a name over the limit", SocketMessage{Type: "initiation", Name: strings.Repeat("a", maxNameLength+1)}, []string{"name"}, []string{"name"}},
+		{"a name with markup", SocketMessage{Type: "initiation", Name: "<b>alice</b>"}, []string{"name"}, []string{"name"}},
+		{"a name with a trailing space", SocketMessage{Type: "initiation", Name: "alice "}, []string{"name"}, []string{"name"}},
+		{"a name of invalid UTF-8", SocketMessage{Type: "initiation", Name: "al\xffce"}, []string{"name"}, []string{"name"}},
+		{"a valid room initiation", SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM42", Role: "creator"}, []string{"name", "room_id", "role"}, nil},
+		{"a short room ID", SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ABC", Role: "creator"}, []string{"name", "room_id", "role"}, []string{"room_id"}},
+		{"a long room ID", SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: strings.Repeat("A", maxRoomIDLength+1), Role: "creator"}, []string{"name", "room_id", "role"}, []string{"room_id"}},
+		{"a lower case room ID", SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "room", Role: "creator"}, []string{"name", "room_id", "role"}, []string{"room_id"}},
+		{"an unknown role", SocketMessage{Type: "roomInitiation", Name: "alice", RoomID: "ROOM", Role: "admin"}, []string{"name", "room_id", "role"}, []string{"role"}},
+		{"a valid offer", SocketMessage{Type: "offer", Name: "bob", Offer: offer}, []string{"name", "offer"}, nil},
+		{"an offer of the wrong type", SocketMessage{Type: "offer", Name: "bob", Offer: &Offer{Type: "answer", Sdp: benchmarkSDP}}, []string{"name", "offer"}, []string{"offer.type"}},
+		{"an offer without SDP", SocketMessage{Type: "offer", Name: "bob", Offer: &Offer{Type: "offer"}}, []string{"name", "offer"}, []string{"offer.sdp"}},
+		{"an offer over the limit", SocketMessage{Type: "offer", Name: "bob", Offer: &Offer{Type: "offer", Sdp: "v=" + strings.Repeat("0", maxSDPLength)}}, []string{"name", "offer"}, []string{"offer.sdp"}},
+		{"an offer that is no SDP", SocketMessage{Type: "offer", Name: "bob", Offer: &Offer{Type: "offer", Sdp: "hello"}}, []string{"name", "offer"}, []string{"offer.sdp"}},
+		{"an answer instead of the offer", SocketMessage{Type: "offer", Name: "bob", Answer: &Answer{Type: "answer", Sdp: benchmarkSDP}}, []string{"name", "offer"}, []string{"offer", "answer"}},
+		{"the end of the candidates", SocketMessage{Type: "candidate", Name: "bob", Candidate: &Candidate{}}, []string{"name", "candidate"}, nil},
+		{"a candidate that is no candidate", SocketMessage{Type: "candidate", Name: "bob", Candidate: &Candidate{Candidate: "hello"}}, []string{"name", "candidate"}, []string{"candidate.candidate"}},
+		{"a candidate over the limits", SocketMessage{Type: "candidate", Name: "bob", Candidate: &Candidate{
+			Candidate:        "candidate:" + strings.Repeat("0", maxCandidateLength),
+			SdpMid:           strings.Repeat("0", maxSdpMidLength+1),
+			SdpMLineIndex:    maxSdpMLineIndex + 1,
+			UsernameFragment: strings.Repeat("0", maxUsernameFragmentLength+1),
+		}}, []string{"name", "candidate"}, []string{"candidate.candidate", "candidate.sdpMid", "candidate.sdpMLineIndex", "candidate.usernameFragment"}},
+		{"a negative m-line index", SocketMessage{Type: "candidate", Name: "bob", Candidate: &Candidate{SdpMLineIndex: -1}}, []string{"name", "candidate"}, []string{"candidate.sdpMLineIndex"}},
+		{"a request ID over the limit", SocketMessage{Type: "leaveRoom", RequestID: strings.Repeat("1", maxRequestIDLength+1)}, []string{}, []string{"request_id"}},
+		{"a request ID with a space", SocketMessage{Type: "leaveRoom", RequestID: "1 2"}, []string{}, []string{"request_id"}},
+		{"too many trace entries", SocketMessage{Type: "leaveRoom", Trace: map[string]string{"a": "", "b": "", "c": "", "d": "", "e": ""}}, []string{}, []string{"trace"}},
+		{"a trace value over the limit", SocketMessage{Type: "leaveRoom", Trace: map[string]string{"traceparent": strings.Repeat("0", maxTraceValueLength+1)}}, []string{}, []string{"trace.traceparent"}},
+	} {
+		got := validationFields(validateMessage(tt.message, tt.fields))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s has the invalid fields %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInitiateValidation(t *testing.T) {
+	e, _ := newTestApp(t, nil)
+	for _, tt := range []struct {
+		name, roomID string
+		want         int
+		fields       []string
+	}{
+		{"alice", "ROOM", http.StatusOK, nil},
+		{"", "ROOM", http.StatusBadRequest, []string{"name"}},
+		{"alice", "", http.StatusBadRequest, []string{"roomID"}},
+		{"<script>", "room", http.StatusBadRequest, []string{"name", "roomID"}},
+		{strings.Repeat("a", maxNameLength+1), "ROOM", http.StatusBadRequest, []string{"name"}},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/initiate?"+url.Values{"name": {tt.name}, "roomID": {tt.roomID}}.Encode(), nil)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		var response ValidationErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		fields := []string{}
+		for _, field := range response.Fields {
+			fields = append(fields, field.Field)
+		}
+		if recorder.Code != tt.want || (tt.fields != nil && (response.Error != codeInvalidPayload || !slices.Equal(fields, tt.fields))) {
+			t.Errorf("/initiate with %q and %q answered %d %s %v, want %d %v", tt.name, tt.roomID, recorder.Code, response.Error, fields, tt.want, tt.fields)
+		}
+	}
+}
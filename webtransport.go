@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// The error codes the server closes WebTransport sessions with, the same as the WebSocket close codes.
+const (
+	webTransportClosed    webtransport.SessionErrorCode = 0
+	webTransportGoingAway webtransport.SessionErrorCode = 1001
+	webTransportTooLarge  webtransport.SessionErrorCode = 1009
+)
+
+// The protocol of the extended CONNECT requests opening WebTransport sessions.
+const webTransportProto = "webtransport"
+
+// How long a client gets to open the signaling stream once the session is established.
+const webTransportStreamTimeout = 10 * time.Second
+
+// How long a write may take before the client is considered gone.
+const webTransportWriteTimeout = 10 * time.Second
+
+// How long the self-signed WebTransport certificates are valid. Browsers only accept certificates
+// by their hash when they are valid for at most two weeks.
+const webTransportCertValidity = 10 * 24 * time.Hour
+
+// A Transport over a bidirectional WebTransport stream. Streams have no message boundaries, so
+// every frame is prefixed with its length as a 32-bit big-endian integer.
+type WebTransportTransport struct {
+	session *webtransport.Session
+	stream  *webtransport.Stream
+	// The maximum frame size. Zero means unlimited.
+	readLimit int64
+	// Closed when a read fails, since the session is over then.
+	readFailed     chan struct{}
+	readFailedOnce sync.Once
+}
+
+// Creates a transport reading and writing the stream of the session.
+func NewWebTransportTransport(session *webtransport.Session, stream *webtransport.Stream, readLimit int64) *WebTransportTransport {
+	return &WebTransportTransport{session: session, stream: stream, readLimit: readLimit, readFailed: make(chan struct{})}
+}
+
+func (t *WebTransportTransport) ReadFrame() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(t.stream, header[:]); err != nil {
+		return nil, t.readError(err)
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if t.readLimit > 0 && int64(size) > t.readLimit {
+		t.session.CloseWithError(webTransportTooLarge, "message too large")
+		return nil, fmt.Errorf("%w: %d bytes", errFrameTooLarge, size)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(t.stream, frame); err != nil {
+		return nil, t.readError(err)
+	}
+	return frame, nil
+}
+
+// Maps the errors of an ended stream to the transport errors.
+func (t *WebTransportTransport) readError(err error) error {
+	t.readFailedOnce.Do(func() { close(t.readFailed) })
+	var sessionErr *webtransport.SessionError
+	var connErr *quic.ApplicationError
+	switch {
+	// The client closed its side of the stream
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: %w", errClientClosed, err)
+	// The client closed the session, or the server did
+	case errors.As(err, &sessionErr) && (!sessionErr.Remote || sessionErr.ErrorCode == webTransportClosed):
+		return fmt.Errorf("%w: %w", errClientClosed, err)
+	// The client closed the connection the session was on
+	case errors.As(err, &connErr) && connErr.Remote && connErr.ErrorCode == quic.ApplicationErrorCode(http3.ErrCodeNoError):
+		return fmt.Errorf("%w: %w", errClientClosed, err)
+	}
+	return fmt.Errorf("%w: %w", errConnectionLost, err)
+}
+
+// Writes a frame. A write to the stream of an ended session can block until the deadline, so
+// those fail right away.
+func (t *WebTransportTransport) WriteFrame(frameType int, frame []byte) error {
+	select {
+	case <-t.readFailed:
+		return errors.New("write to an ended WebTransport session")
+	case <-t.session.Context().Done():
+		return errors.New("write to a closed WebTransport session")
+	default:
+	}
+	t.stream.SetWriteDeadline(time.Now().Add(webTransportWriteTimeout))
+	message := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(message, uint32(len(frame)))
+	copy(message[4:], frame)
+	_, err := t.stream.Write(message)
+	return err
+}
+
+// Closes the session with the going away code.
+func (t *WebTransportTransport) GoAway(reason string) error {
+	return t.session.CloseWithError(webTransportGoingAway, reason)
+}
+
+func (t *WebTransportTransport) Close() error {
+	return t.session.CloseWithError(webTransportClosed, "")
+}
+
+func (t *WebTransportTransport) RemoteAddr() string {
+	return t.session.RemoteAddr().String()
+}
+
+// Serves the signaling over WebTransport on HTTP/3. The sessions are established through the
+// routes of the echo app, so they pass the same middleware as the WebSocket upgrades.
+type WebTransportServer struct {
+	server *webtransport.Server
+	ss     *SignalingServer
+	logger *slog.Logger
+	// Reloads the configured certificate. Nil when a self-signed certificate is used.
+	reloader       *certReloader
+	reloadInterval time.Duration
+	// The self-signed certificate the browsers accept by its hash. Nil when a certificate is configured.
+	devCert *webTransportCert
+}
+
+// Creates a WebTransport server serving the handler over HTTP/3. The configured certificate is
+// used, unless it is self-signed or TLS is disabled, in which case a short-lived self-signed
+// certificate is generated and its hash advertised in the client configuration.
+func NewWebTransportServer(config *Config, handler http.Handler, ss *SignalingServer, checkOrigin func(*http.Request) bool, logger *slog.Logger) (*WebTransportServer, error) {
+	wt := &WebTransportServer{ss: ss, logger: logger, reloadInterval: config.TLS.ReloadInterval}
+	var tlsConfig *tls.Config
+	if config.TLSEnabled() && !config.TLS.SelfSigned {
+		reloader, err := newCertReloader(config.TLS.CertFile, config.TLS.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		wt.reloader, tlsConfig = reloader, reloader.TLSConfig()
+	} else {
+		devCert, err := newWebTransportCert(config.selfSignedHosts())
+		if err != nil {
+			return nil, err
+		}
+		wt.devCert = devCert
+		tlsConfig = &tls.Config{GetCertificate: devCert.GetCertificate}
+	}
+	tlsConfig.MinVersion = tls.VersionTLS13
+
+	h3 := &http3.Server{
+		Addr:      config.WebTransport.ListenAddress,
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+	}
+	webtransport.ConfigureHTTP3Server(h3)
+	wt.server = &webtransport.Server{
+		H3:                   h3,
+		CheckOrigin:          checkOrigin,
+		ApplicationProtocols: supportedProtocols,
+	}
+	return wt, nil
+}
+
+// Listens on the UDP address of the configuration and serves until Close.
+func (wt *WebTransportServer) ListenAndServe(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", wt.server.H3.Addr)
+	if err != nil {
+		return err
+	}
+	return wt.Serve(ctx, conn)
+}
+
+// Serves on the connection until Close.
+func (wt *WebTransportServer) Serve(ctx context.Context, conn net.PacketConn) error {
+	if wt.reloader != nil {
+		go wt.reloader.Watch(ctx, wt.reloadInterval)
+	}
+	return wt.server.Serve(conn)
+}
+
+// Closes the sessions and stops serving.
+func (wt *WebTransportServer) Close() error {
+	return wt.server.Close()
+}
+
+// A handler for the /webtransport CONNECT requests. The client opens a bidirectional stream for
+// the signaling messages, and the protocol version is negotiated as the application protocol.
+func (wt *WebTransportServer) Handler(c echo.Context) error {
+	request := c.Request()
+	// The upgrade needs the HTTP/3 response writer, not the echo one wrapping it.
+	session, err := wt.server.Upgrade(c.Response().Writer, request)
+	if err != nil {
+		wt.logger.Warn("Rejected WebTransport session", logKeyError, err, logKeyRemoteAddr, request.RemoteAddr)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), webTransportStreamTimeout)
+	stream, err := session.AcceptStream(ctx)
+	cancel()
+	if err != nil {
+		wt.logger.Warn("WebTransport session opened no stream", logKeyError, err, logKeyRemoteAddr, request.RemoteAddr)
+		session.CloseWithError(webTransportClosed, "no signaling stream")
+		return nil
+	}
+
+	transport := NewWebTransportTransport(session, stream, wt.ss.limits.MaxMessageSize)
+	return wt.ss.Serve(request.Context(), NewSession(transport, protocolAdapter(session.SessionState().ApplicationProtocol)))
+}
+
+// Returns the base64 encoded SHA-256 hashes of the self-signed certificate, for the browsers'
+// serverCertificateHashes. Nil when a certificate is configured.
+func (wt *WebTransportServer) CertHashes() ([]string, error) {
+	if wt.devCert == nil {
+		return nil, nil
+	}
+	hash, err := wt.devCert.Hash()
+	if err != nil {
+		return nil, err
+	}
+	return []string{hash}, nil
+}
+
+// A self-signed WebTransport certificate for development, renewed a day before it expires.
+type webTransportCert struct {
+	hosts []string
+	mux   sync.Mutex
+	cert  *tls.Certificate
+	hash  [sha256.Size]byte
+}
+
+// Creates a self-signed certificate for the hosts.
+func newWebTransportCert(hosts []string) (*webTransportCert, error) {
+	wc := &webTransportCert{hosts: hosts}
+	if err := wc.renew(); err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// Returns the current certificate and its hash, renewing it when it is about to expire.
+func (wc *webTransportCert) current() (*tls.Certificate, [sha256.Size]byte, error) {
+	wc.mux.Lock()
+	defer wc.mux.Unlock()
+
+	if time.Until(wc.cert.Leaf.NotAfter) < 24*time.Hour {
+		if err := wc.renew(); err != nil {
+			return nil, wc.hash, err
+		}
+	}
+	return wc.cert, wc.hash, nil
+}
+
+func (wc *webTransportCert) renew() error {
+	der, key, err := newSelfSignedCert(wc.hosts, webTransportCertValidity)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	wc.cert = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	wc.hash = sha256.Sum256(der)
+	return nil
+}
+
+func (wc *webTransportCert) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _, err := wc.current()
+	return cert, err
+}
+
+// Returns the base64 encoded SHA-256 hash of the current certificate.
+func (wc *webTransportCert) Hash() (string, error) {
+	_, hash, err := wc.current()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/webtransport-go"
+)
+
+// Starts the app with WebTransport enabled. Returns the WebTransport URL and the client configuration.
+func newWebTransportServer(t *testing.T, env map[string]string) (*SignalingServer, string, ClientConfig) {
+	t.Helper()
+	env["PIIRTUL_WEBTRANSPORT_LISTEN_ADDRESS"] = "127.0.0.1:0"
+	config, err := LoadConfig(nil, func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ss, wt, _, err := newApp(&config, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go wt.Serve(context.Background(), conn)
+	t.Cleanup(func() { wt.Close() })
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	response, err := http.Get(server.URL + "/api/client-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var clientConfig ClientConfig
+	if err := json.NewDecoder(response.Body).Decode(&clientConfig); err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	return ss, "https://127.0.0.1:" + port + "/webtransport", clientConfig
+}
+
+// A client of a WebTransport session, speaking the negotiated protocol on one stream.
+type webTransportClient struct {
+	t       *testing.T
+	session *webtransport.Session
+	stream  *webtransport.Stream
+}
+
+// Opens a session trusting only the certificate with the hash, like a browser given serverCertificateHashes.
+func dialWebTransport(t *testing.T, url, certHash string, protocols ...string) *webTransportClient {
+	t.Helper()
+	dialer := webtransport.Dialer{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				hash := sha256.Sum256(rawCerts[0])
+				if base64.StdEncoding.EncodeToString(hash[:]) != certHash {
+					return errors.New("the certificate does not have the advertised hash")
+				}
+				return nil
+			},
+		},
+		ApplicationProtocols: protocols,
+	}
+	t.Cleanup(func() { dialer.Close() })
+	response, session, err := dialer.Dial(requestContext(t), url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("the session was answered with %s", response.Status)
+	}
+	stream, err := session.OpenStreamSync(requestContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.CloseWithError(0, "") })
+	return &webTransportClient{t: t, session: session, stream: stream}
+}
+
+func (c *webTransportClient) send(frame string) {
+	c.t.Helper()
+	message := binary.BigEndian.AppendUint32(nil, uint32(len(frame)))
+	if _, err := c.stream.Write(append(message, frame...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Returns the next message from the server, decoded in a map.
+func (c *webTransportClient) receive() map[string]any {
+	c.t.Helper()
+	c.stream.SetReadDeadline(time.Now().Add(testTimeout))
+	var header [4]byte
+	if _, err := io.ReadFull(c.stream, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := io.ReadFull(c.stream, frame); err != nil {
+		c.t.Fatal(err)
+	}
+	var message map[string]any
+	if err := json.Unmarshal(frame, &message); err != nil {
+		c.t.Fatal(err)
+	}
+	return message
+}
+
+func TestWebTransportMixedRoom(t *testing.T) {
+	ss, url, clientConfig := newWebTransportServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false"})
+	// The port is the configured one, which is 0 in the tests.
+	if want := "https://127.0.0.1:0/webtransport"; clientConfig.WebTransportURL != want {
+		t.Errorf("the client configuration advertises %s, want %s", clientConfig.WebTransportURL, want)
+	}
+	if len(clientConfig.WebTransportCertHashes) != 1 {
+		t.Fatalf("the client configuration advertises the hashes %v, want one", clientConfig.WebTransportCertHashes)
+	}
+
+	alice := dialWebTransport(t, url, clientConfig.WebTransportCertHashes[0], protocolV2)
+	if protocol := alice.session.SessionState().ApplicationProtocol; protocol != protocolV2 {
+		t.Errorf("negotiated %q, want %s", protocol, protocolV2)
+	}
+	bob := connectMemory(t, ss, "bob")
+
+	alice.send(`{"v":2,"type":"initiation","id":"1","data":{"name":"alice"}}`)
+	if got := alice.receive(); got["ok"] != true || got["id"] != "1" {
+		t.Errorf("alice's initiation answered %v", got)
+	}
+	alice.send(`{"v":2,"type":"roomInitiation","data":{"name":"alice","room_id":"ROOM","role":"creator"}}`)
+	alice.receive()
+	bob.request(SocketMessage{Type: "initiation", Name: "bob"}, map[string]any{"success": true})
+	bob.request(SocketMessage{Type: "roomInitiation", Name: "bob", RoomID: "ROOM", Role: "participant"}, map[string]any{"success": true})
+
+	bob.send(SocketMessage{Type: "offer", Name: "alice", Offer: &Offer{Type: "offer", Sdp: benchmarkSDP}})
+	if got := alice.receive(); got["type"] != "offer" {
+		t.Errorf("alice received %v, want an offer from bob", got)
+	}
+
+	alice.session.CloseWithError(0, "")
+	if got := bob.receive(); got["type"] != "peerLeavingRoom" || got["room_destroy"] != true {
+		t.Errorf("bob received %v, want alice leaving and destroying the room", got)
+	}
+	eventually(t, func() bool { return ss.UserCount() == 1 && ss.ConnCount() == 1 }, "alice's user and session are left after closing")
+}
+
+func TestWebTransportMessageTooLarge(t *testing.T) {
+	ss, url, clientConfig := newWebTransportServer(t, map[string]string{"PIIRTUL_REQUIRE_UPGRADE_TOKEN": "false", "PIIRTUL_MAX_MESSAGE_SIZE": "1024"})
+	alice := dialWebTransport(t, url, clientConfig.WebTransportCertHashes[0])
+	alice.send(`{"type":"initiation","name":"alice"}`)
+	if got := alice.receive(); got["success"] != true {
+		t.Fatalf("alice's initiation answered %v", got)
+	}
+
+	alice.send(strings.Repeat("a", 2048))
+	select {
+	case <-alice.session.Context().Done():
+	case <-time.After(testTimeout):
+		t.Fatal("the session was not closed")
+	}
+	var sessionErr *webtransport.SessionError
+	if _, err := alice.session.AcceptStream(context.Background()); !errors.As(err, &sessionErr) || sessionErr.ErrorCode != webTransportTooLarge {
+		t.Errorf("the session was closed with %v, want the code %d", err, webTransportTooLarge)
+	}
+	eventually(t, func() bool { return ss.UserCount() == 0 && ss.ConnCount() == 0 }, "alice's user and session are left after the message over the limit")
+}